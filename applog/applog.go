@@ -0,0 +1,146 @@
+// Package applog collects diagnostics in memory. The TUI owns the
+// terminal, so nothing may be printed while it runs: packages log here
+// instead and the TUI shows the recent entries in its log view.
+package applog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// Entry is one logged message.
+type Entry struct {
+	Time  time.Time
+	Level Level
+	Text  string
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %-5s %s", e.Time.Format("15:04:05"), e.Level, e.Text)
+}
+
+// Logger keeps the last entries it was given. Debug entries (e.g. raw IRC
+// traffic) are kept apart so that they don't push out the others.
+type Logger struct {
+	mtx     sync.Mutex
+	max     int
+	entries []Entry
+	debug   []Entry
+	seq     uint64 // number of entries ever logged
+}
+
+// DefaultMaxEntries is how many entries the default logger keeps.
+const DefaultMaxEntries = 1000
+
+func New(max int) *Logger {
+	if max <= 0 {
+		max = DefaultMaxEntries
+	}
+	return &Logger{max: max}
+}
+
+func (l *Logger) log(level Level, format string, args ...interface{}) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	e := Entry{Time: time.Now(), Level: level, Text: fmt.Sprintf(format, args...)}
+	if level == LevelDebug {
+		l.debug = appendBounded(l.debug, e, l.max)
+	} else {
+		l.entries = appendBounded(l.entries, e, l.max)
+	}
+	l.seq++
+}
+
+func appendBounded(entries []Entry, e Entry, max int) []Entry {
+	entries = append(entries, e)
+	if len(entries) > max {
+		entries = append([]Entry{}, entries[len(entries)-max:]...)
+	}
+	return entries
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) { l.log(LevelDebug, format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.log(LevelInfo, format, args...) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.log(LevelWarn, format, args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.log(LevelError, format, args...) }
+
+// Entries returns the kept entries at or above min, oldest first.
+func (l *Logger) Entries(min Level) []Entry {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	entries := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		if e.Level >= min {
+			entries = append(entries, e)
+		}
+	}
+	if min > LevelDebug {
+		return entries
+	}
+
+	// merge the debug entries in by time.
+	merged := make([]Entry, 0, len(entries)+len(l.debug))
+	i, j := 0, 0
+	for i < len(entries) || j < len(l.debug) {
+		if j == len(l.debug) || (i < len(entries) && !l.debug[j].Time.Before(entries[i].Time)) {
+			merged = append(merged, entries[i])
+			i++
+		} else {
+			merged = append(merged, l.debug[j])
+			j++
+		}
+	}
+	return merged
+}
+
+// Seq returns the number of entries logged so far, to tell whether
+// something new was logged.
+func (l *Logger) Seq() uint64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.seq
+}
+
+// Default is the logger of the application.
+var Default = New(DefaultMaxEntries)
+
+func Debugf(format string, args ...interface{}) { Default.Debugf(format, args...) }
+func Infof(format string, args ...interface{})  { Default.Infof(format, args...) }
+func Warnf(format string, args ...interface{})  { Default.Warnf(format, args...) }
+func Errorf(format string, args ...interface{}) { Default.Errorf(format, args...) }
+
+// IRCLogger adapts a Logger to the logging interface of goirc, see
+// github.com/fluffle/goirc/logging.SetLogger.
+type IRCLogger struct {
+	*Logger
+}
+
+func (l IRCLogger) Debug(format string, args ...interface{}) { l.Debugf("irc: "+format, args...) }
+func (l IRCLogger) Info(format string, args ...interface{})  { l.Infof("irc: "+format, args...) }
+func (l IRCLogger) Warn(format string, args ...interface{})  { l.Warnf("irc: "+format, args...) }
+func (l IRCLogger) Error(format string, args ...interface{}) { l.Errorf("irc: "+format, args...) }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"xdcc-tui/config"
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+)
+
+// listFlag is a flag that can be repeated, each value possibly a comma
+// separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, strings.ToLower(v))
+		}
+	}
+	return nil
+}
+
+// configFlags override settings of the config file for one run, to use
+// the binary in scripts without editing the config.
+type configFlags struct {
+	flagSet       *flag.FlagSet
+	downloadDir   string
+	nick          string
+	maxConcurrent int
+	rateLimit     int64
+	providers     listFlag
+}
+
+func addConfigFlags(flagSet *flag.FlagSet) *configFlags {
+	f := &configFlags{flagSet: flagSet}
+	flagSet.StringVar(&f.downloadDir, "download-dir", "", i18n.T("cli.flag.download_dir"))
+	flagSet.StringVar(&f.nick, "nick", "", i18n.T("cli.flag.nick"))
+	flagSet.IntVar(&f.maxConcurrent, "max-concurrent", 0, i18n.T("cli.flag.max_concurrent"))
+	flagSet.Int64Var(&f.rateLimit, "rate-limit", 0, i18n.T("cli.flag.rate_limit"))
+	flagSet.Var(&f.providers, "provider", i18n.T("cli.flag.provider", strings.Join(search.ProviderNames, ", ")))
+	return f
+}
+
+// apply overrides the config with the flags given once they are parsed;
+// the search providers are set up again when they changed. An invalid
+// value ends the program.
+func (f *configFlags) apply() {
+	given := make(map[string]bool)
+	f.flagSet.Visit(func(fl *flag.Flag) { given[fl.Name] = true })
+	if len(given) == 0 {
+		return
+	}
+	if err := f.validate(given); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err := cfg.Override(func(c *config.Config) {
+		if given["download-dir"] {
+			c.DownloadDir = f.downloadDir
+		}
+		if given["nick"] {
+			c.Nick = f.nick
+		}
+		if given["max-concurrent"] {
+			c.MaxConcurrentDownloads = f.maxConcurrent
+		}
+		if given["rate-limit"] {
+			c.RateLimitKB = f.rateLimit
+		}
+		if given["provider"] {
+			c.Providers = f.providers
+		}
+	})
+	if err != nil {
+		fmt.Println(i18n.T("cli.config_invalid", err))
+		os.Exit(1)
+	}
+	if given["provider"] {
+		searchEngine, err = search.NewAggregatorOf(cfg.Providers)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+}
+
+func (f *configFlags) validate(given map[string]bool) error {
+	if given["max-concurrent"] && f.maxConcurrent < 1 {
+		return i18n.Errorf("cli.invalid_flag", "max-concurrent", f.maxConcurrent)
+	}
+	if given["rate-limit"] && f.rateLimit < 0 {
+		return i18n.Errorf("cli.invalid_flag", "rate-limit", f.rateLimit)
+	}
+	if given["download-dir"] {
+		if err := os.MkdirAll(f.downloadDir, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
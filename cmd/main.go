@@ -8,9 +8,14 @@ import (
 	"fmt"
 	tea "github.com/charmbracelet/bubbletea"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
+	"xdcc-tui/config"
+	"xdcc-tui/i18n"
 	"xdcc-tui/pb"
 	"xdcc-tui/search"
 	table "xdcc-tui/table"
@@ -20,19 +25,44 @@ import (
 
 var searchEngine *search.ProviderAggregator
 
-func execTUI() {
-	m := tui.NewModel()
-	if err := tea.NewProgram(m).Start(); err != nil {
-		fmt.Printf("Error running program: %v\n", err)
+var cfg *config.Config
+
+func execTUI(args []string) {
+	tuiCmd := flag.NewFlagSet("tui", flag.ExitOnError)
+	exitWhenDone := tuiCmd.Bool("exit-when-done", false, i18n.T("cli.flag.exit_when_done"))
+	noColor := tuiCmd.Bool("no-color", false, i18n.T("cli.flag.no_color"))
+	ascii := tuiCmd.Bool("ascii", false, i18n.T("cli.flag.ascii"))
+	overrides := addConfigFlags(tuiCmd)
+	tuiCmd.Parse(args)
+	overrides.apply()
+
+	m := tui.NewModel(cfg)
+	m.SetExitWhenDone(*exitWhenDone)
+	if *noColor {
+		m.SetPlain(true)
+	}
+	if *ascii {
+		m.SetASCII(true)
+	}
+	final, err := tea.NewProgram(m).Run()
+	if err != nil {
+		fmt.Println(i18n.T("cli.tui_failed", err))
+		os.Exit(1)
+	}
+	fm, ok := final.(tui.Model)
+	if !ok {
+		return
+	}
+	if *exitWhenDone {
+		fmt.Println(fm.Summary())
+	}
+	errs := fm.ShutdownErrors()
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
 		os.Exit(1)
 	}
-}
-
-func init() {
-	searchEngine = search.NewProviderAggregator(
-		&search.XdccEuProvider{},
-		&search.SunXdccProvider{},
-	)
 }
 
 var defaultColWidths []int = []int{100, 10, -1}
@@ -61,15 +91,17 @@ func formatSize(size int64) string {
 
 func execSearch(args []string) {
 	searchCmd := flag.NewFlagSet("search", flag.ExitOnError)
-	sortByFilename := searchCmd.Bool("s", false, "sort results by filename")
+	sortByFilename := searchCmd.Bool("s", false, i18n.T("cli.flag.sort_by_name"))
+	overrides := addConfigFlags(searchCmd)
 
 	args = parseFlags(searchCmd, args)
+	overrides.apply()
 
-	printer := table.NewTablePrinter([]string{"File Name", "Size", "URL"})
+	printer := table.NewTablePrinter([]string{i18n.T("cli.column.file_name"), i18n.T("column.size"), i18n.T("cli.column.url")})
 	printer.SetMaxWidths(defaultColWidths)
 
 	if len(args) < 1 {
-		fmt.Println("search: no keyword provided.")
+		fmt.Println(i18n.T("cli.no_keyword"))
 		os.Exit(1)
 	}
 
@@ -99,11 +131,20 @@ func transferLoop(transfer xdcc.Transfer) {
 			bar.SetTotal(int(evtType.FileSize))
 			bar.SetFileName(evtType.FileName)
 			bar.SetState(pb.ProgressStateDownloading)
+			bar.SetCurrent(int(evtType.Offset))
 		case *xdcc.TransferProgessEvent:
 			bar.Increment(int(evtType.TransferBytes))
 		case *xdcc.TransferCompletedEvent:
 			bar.SetState(pb.ProgressStateCompleted)
 			quit = true
+		case *xdcc.TransferRejectedEvent:
+			bar.SetState(pb.ProgressStateAborted)
+			fmt.Println(evtType.Err)
+			quit = true
+		case *xdcc.TransferAbortedEvent:
+			bar.SetState(pb.ProgressStateAborted)
+			fmt.Println(evtType.Error)
+			quit = true
 		}
 	}
 	// TODO: do clean-up operations here
@@ -111,7 +152,7 @@ func transferLoop(transfer xdcc.Transfer) {
 
 func suggestUnknownAuthoritySwitch(err error) {
 	if err.Error() == (x509.UnknownAuthorityError{}.Error()) {
-		fmt.Println("use the --allow-unknown-authority flag to skip certificate verification")
+		fmt.Println(i18n.T("cli.unknown_authority"))
 	}
 }
 
@@ -168,19 +209,22 @@ func loadUrlListFile(filePath string) []string {
 }
 
 func printGetUsageAndExit(flagSet *flag.FlagSet) {
-	fmt.Printf("usage: get url1 url2 ... [-o path] [-i file] [--ssl-only]\n\nFlag set:\n")
+	fmt.Print(i18n.T("cli.get_usage"))
 	flagSet.PrintDefaults()
 	os.Exit(0)
 }
 
 func execGet(args []string) {
 	getCmd := flag.NewFlagSet("get", flag.ExitOnError)
-	path := getCmd.String("o", ".", "output folder of dowloaded file")
-	inputFile := getCmd.String("i", "", "input file containing a list of urls")
+	path := getCmd.String("o", "", i18n.T("cli.flag.output"))
+	inputFile := getCmd.String("i", "", i18n.T("cli.flag.input"))
 
-	sslOnly := getCmd.Bool("ssl-only", false, "force the client to use TSL connection")
+	sslOnly := getCmd.Bool("ssl-only", false, i18n.T("cli.flag.ssl_only"))
+	serverPassword := getCmd.String("server-password", "", i18n.T("cli.flag.server_password"))
+	overrides := addConfigFlags(getCmd)
 
 	urlList := parseFlags(getCmd, args)
+	overrides.apply()
 
 	if *inputFile != "" {
 		urlList = append(urlList, loadUrlListFile(*inputFile)...)
@@ -190,11 +234,16 @@ func execGet(args []string) {
 		printGetUsageAndExit(getCmd)
 	}
 
-	wg := sync.WaitGroup{}
+	transfers := make([]xdcc.Transfer, 0, len(urlList))
+	connections := xdcc.NewConnManager(cfg.IdleTimeout())
+	limiter := xdcc.NewRateLimiter(cfg.RateLimit())
+	// packs from the same bot are requested one at a time.
+	byBot := make(map[string][]xdcc.Transfer)
+	bots := make([]string, 0)
 	for _, urlStr := range urlList {
 		url, err := xdcc.ParseURL(urlStr)
 		if errors.Is(err, xdcc.ErrInvalidURL) {
-			fmt.Printf("no valid irc url: %s\n", urlStr)
+			fmt.Println(i18n.T("cli.invalid_url", urlStr))
 			continue
 		}
 
@@ -203,25 +252,178 @@ func execGet(args []string) {
 			os.Exit(1)
 		}
 
-		transfer := xdcc.NewTransfer(xdcc.Config{
-			File:    *url,
-			OutPath: *path,
-			SSLOnly: *sslOnly,
-		})
+		transferConf := cfg.TransferConfig(*url, *path, 0, time.Now())
+		transferConf.SSLOnly = *sslOnly
+		transferConf.Connections = connections
+		transferConf.RateLimiter = limiter
+		if *serverPassword != "" {
+			transferConf.ServerPassword = *serverPassword
+		}
+
+		transfer := xdcc.NewTransfer(transferConf)
+		transfers = append(transfers, transfer)
 
-		wg.Add(1)
-		go func(transfer xdcc.Transfer) {
-			doTransfer(transfer)
+		bot := url.BotKey()
+		if _, ok := byBot[bot]; !ok {
+			bots = append(bots, bot)
+		}
+		byBot[bot] = append(byBot[bot], transfer)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(bots))
+	for _, bot := range bots {
+		go func(queue []xdcc.Transfer) {
+			for i, transfer := range queue {
+				if i > 0 {
+					time.Sleep(cfg.Cooldown())
+				}
+				doTransfer(transfer)
+			}
 			wg.Done()
-		}(transfer)
+		}(byBot[bot])
 	}
+
+	go stopOnInterrupt(transfers, connections)
 	wg.Wait()
+	connections.Close()
+}
+
+// stopOnInterrupt stops all transfers cleanly (QUIT, close sockets, flush
+// files) when the process is interrupted.
+func stopOnInterrupt(transfers []xdcc.Transfer, connections *xdcc.ConnManager) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	<-interrupts
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(transfers))
+	for _, t := range transfers {
+		go func(t xdcc.Transfer) {
+			t.Stop()
+			wg.Done()
+		}(t)
+	}
+	wg.Wait()
+	connections.Close()
+	os.Exit(1)
+}
+
+// execQueue exports the queue saved by the TUI or imports a queue file
+// into it, to prepare batches elsewhere or move them between machines.
+func execQueue(args []string) {
+	if len(args) != 2 || (args[0] != "export" && args[0] != "import") {
+		fmt.Println(i18n.T("cli.queue_usage"))
+		os.Exit(1)
+	}
+
+	if args[0] == "export" {
+		n, err := tui.ExportQueue(args[1])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(i18n.T("queue.exported", n, args[1]))
+		return
+	}
+
+	n, err := tui.ImportQueue(args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println(i18n.T("cli.queue_imported", n))
+}
+
+// execAdd queues the urls of a list file, or a file of the download
+// history, for the next TUI session.
+func execAdd(args []string) {
+	addCmd := flag.NewFlagSet("add", flag.ExitOnError)
+	fromFile := addCmd.String("from-file", "", i18n.T("cli.flag.from_file"))
+	fromHistory := addCmd.String("from-history", "", i18n.T("cli.flag.from_history"))
+	outPath := addCmd.String("out", "", i18n.T("cli.flag.out"))
+	addCmd.Parse(args)
+
+	if *fromHistory != "" {
+		added, err := tui.AddFromHistory(*fromHistory)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if !added {
+			fmt.Println(i18n.T("queue.already_queued", *fromHistory))
+			return
+		}
+		fmt.Println(i18n.T("queue.queued_again", *fromHistory))
+		return
+	}
+
+	if *fromFile == "" {
+		fmt.Println(i18n.T("cli.add_usage"))
+		os.Exit(1)
+	}
+
+	added, invalid, err := tui.AddFromFile(*fromFile, *outPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, err := range invalid {
+		fmt.Println(err)
+	}
+	fmt.Println(i18n.T("cli.urls_queued", added, len(invalid)))
+}
+
+// execLocales lists the available translations, the active one marked;
+// with --missing it prints the messages the active one lacks instead.
+func execLocales(args []string) {
+	localesCmd := flag.NewFlagSet("locales", flag.ExitOnError)
+	missing := localesCmd.Bool("missing", false, i18n.T("cli.flag.missing"))
+	localesCmd.Parse(args)
+
+	if *missing {
+		for _, key := range i18n.Missing() {
+			fmt.Println(key)
+		}
+		return
+	}
+	for _, name := range i18n.Available(config.LocalesDir()) {
+		mark := " "
+		if name == i18n.Locale() {
+			mark = "*"
+		}
+		fmt.Println(mark, name)
+	}
 }
 
 func main() {
+	var err error
+	cfg, err = config.Load(config.DefaultPath())
+	if err != nil {
+		i18n.Setup("", config.LocalesDir())
+		fmt.Println(i18n.T("cli.config_failed", err))
+		os.Exit(1)
+	}
+	if err := i18n.Setup(cfg.Language, config.LocalesDir()); err != nil {
+		fmt.Println(err)
+	}
+	for alias, network := range cfg.NetworkAliases {
+		xdcc.RegisterNetworkAlias(alias, network)
+	}
+	searchEngine, err = search.NewAggregatorOf(cfg.Providers)
+	if err != nil {
+		fmt.Println(i18n.T("cli.config_invalid", err))
+		os.Exit(1)
+	}
+
 	// If no arguments provided, start in TUI mode by default
 	if len(os.Args) < 2 {
-		execTUI()
+		execTUI(nil)
+		return
+	}
+	// flags alone are those of the TUI, e.g. xdcc --nick name
+	if strings.HasPrefix(os.Args[1], "-") {
+		execTUI(os.Args[1:])
 		return
 	}
 
@@ -232,9 +434,15 @@ func main() {
 	case "get":
 		execGet(os.Args[2:])
 	case "tui":
-		execTUI()
+		execTUI(os.Args[2:])
+	case "queue":
+		execQueue(os.Args[2:])
+	case "add":
+		execAdd(os.Args[2:])
+	case "locales":
+		execLocales(os.Args[2:])
 	default:
 		// If unrecognized command, assume user wants TUI mode with the arguments as search terms
-		execTUI()
+		execTUI(nil)
 	}
 }
@@ -0,0 +1,582 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"xdcc-tui/history"
+	"xdcc-tui/util"
+	"xdcc-tui/xdcc"
+)
+
+const (
+	appDirName     = "xdcc-tui"
+	configFileName = "config.json"
+	localesDirName = "locales"
+)
+
+// Network holds settings that only apply to a single IRC network.
+type Network struct {
+	ServerPassword string `json:"server_password,omitempty"`
+}
+
+// Bot holds settings for bots that don't understand the usual
+// "xdcc send #n" request.
+type Bot struct {
+	// RequestTemplate replaces the request text; {slot} and {bot} are
+	// substituted, e.g. "xdcc get {slot}" or "!pack {slot}".
+	RequestTemplate string `json:"request_template,omitempty"`
+	// RequestInChannel sends the request to the channel instead of the bot.
+	RequestInChannel bool `json:"request_in_channel,omitempty"`
+}
+
+type Config struct {
+	// ServerPassword is sent via PASS to every network that does not
+	// define its own password.
+	ServerPassword string             `json:"server_password,omitempty"`
+	Networks       map[string]Network `json:"networks,omitempty"`
+
+	// NetworkAliases maps short names usable in irc:// urls to a network
+	// address, e.g. "rizon" -> "irc.rizon.net:6697".
+	NetworkAliases map[string]string `json:"network_aliases,omitempty"`
+
+	// DCCPortMin and DCCPortMax restrict the local ports opened for
+	// reverse DCC. Leave both at zero to let the OS choose.
+	DCCPortMin int `json:"dcc_port_min,omitempty"`
+	DCCPortMax int `json:"dcc_port_max,omitempty"`
+
+	// ExternalIP is advertised to bots for reverse DCC; "auto" discovers
+	// it via STUN (STUNServer, or a public default).
+	ExternalIP string `json:"external_ip,omitempty"`
+	STUNServer string `json:"stun_server,omitempty"`
+
+	// BindAddress binds IRC and DCC connections to a local IP or to a
+	// network interface such as a VPN's "tun0".
+	BindAddress string `json:"bind_address,omitempty"`
+
+	// Preallocate reserves the full file size on disk when a download
+	// starts.
+	Preallocate bool `json:"preallocate,omitempty"`
+
+	// BufferSize is the download buffer size in bytes; 0 uses the default
+	// (64 KiB). Raise it on gigabit links.
+	BufferSize int `json:"buffer_size,omitempty"`
+
+	// RequestTemplate is the default request text sent to bots; Bots
+	// overrides it per bot, keyed by "network/bot" or just "bot".
+	RequestTemplate string         `json:"request_template,omitempty"`
+	Bots            map[string]Bot `json:"bots,omitempty"`
+
+	// ConnectionIdleTimeout is how long, in seconds, an IRC connection
+	// with no active transfer is kept open for the next one; 0 uses the
+	// default (2 minutes).
+	ConnectionIdleTimeout int `json:"connection_idle_timeout,omitempty"`
+
+	// MaxConcurrentDownloads limits how many queued downloads run at the
+	// same time; 0 uses DefaultMaxConcurrentDownloads.
+	MaxConcurrentDownloads int `json:"max_concurrent_downloads,omitempty"`
+
+	// PauseActiveDownloads makes the global pause suspend running
+	// transfers too, instead of only holding back queued ones.
+	PauseActiveDownloads bool `json:"pause_active_downloads,omitempty"`
+
+	// BotCooldown is the minimum time, in seconds, between the end of a
+	// transfer and the next request to the same bot.
+	BotCooldown int `json:"bot_cooldown,omitempty"`
+
+	// MaxRetries is how many times a failed download is queued again
+	// before giving up; 0 uses DefaultMaxRetries, a negative value
+	// disables retries. RetryDelay is the wait in seconds before each
+	// retry, 0 uses DefaultRetryDelay.
+	MaxRetries int `json:"max_retries,omitempty"`
+	RetryDelay int `json:"retry_delay,omitempty"`
+
+	// BotFailureLimit is how many consecutive failures of a bot make its
+	// queued packs wait BotFailureBackoff seconds (or move to another
+	// bot), to avoid being banned for hammering it. 0 uses the defaults,
+	// a negative limit disables the backoff.
+	BotFailureLimit   int `json:"bot_failure_limit,omitempty"`
+	BotFailureBackoff int `json:"bot_failure_backoff,omitempty"`
+
+	// DownloadDir is where files are saved ("~" is expanded); Rules can
+	// route files elsewhere, the first matching rule wins.
+	DownloadDir string `json:"download_dir,omitempty"`
+	Rules       []Rule `json:"rules,omitempty"`
+
+	// FilenameTemplate is the path of saved files relative to their
+	// directory, e.g. "{show}/Season {season}/{original_name}". Empty
+	// keeps the name announced by the bot.
+	FilenameTemplate string `json:"filename_template,omitempty"`
+
+	// IncompleteDir holds downloads in progress; finished files are moved
+	// to their destination, so that watched folders only see complete
+	// files.
+	IncompleteDir string `json:"incomplete_dir,omitempty"`
+
+	// WatchDir is scanned by the TUI for job files (queue exports or url
+	// lists) dropped by other tools; their downloads are queued.
+	WatchDir string `json:"watch_dir,omitempty"`
+
+	// SessionQuotaMB and DailyQuotaMB limit the data downloaded per
+	// session and per day, in MiB; 0 means no limit. Once reached, no new
+	// download is started.
+	SessionQuotaMB int64 `json:"session_quota_mb,omitempty"`
+	DailyQuotaMB   int64 `json:"daily_quota_mb,omitempty"`
+
+	// ConfirmBatchFiles and ConfirmBatchMB ask for a confirmation before
+	// queueing more files, or more MiB, at once; 0 uses the defaults and
+	// a negative number never asks.
+	ConfirmBatchFiles int   `json:"confirm_batch_files,omitempty"`
+	ConfirmBatchMB    int64 `json:"confirm_batch_mb,omitempty"`
+
+	// RateLimitKB caps the combined download speed in KiB/s, shared fairly
+	// between the running transfers; 0 means no limit.
+	RateLimitKB int64 `json:"rate_limit,omitempty"`
+
+	// HistoryMaxDays and HistoryMaxEntries bound the download history;
+	// failed downloads are kept HistoryFailedDays instead, when set, to
+	// help troubleshooting. 0 means no limit.
+	HistoryMaxDays    int `json:"history_max_days,omitempty"`
+	HistoryMaxEntries int `json:"history_max_entries,omitempty"`
+	HistoryFailedDays int `json:"history_failed_days,omitempty"`
+
+	// FilterPresets are offered in the filter presets menu of the
+	// results, see Presets.
+	FilterPresets []FilterPreset `json:"filter_presets,omitempty"`
+
+	// PageSize is the number of results per page; 0 fits the pages to
+	// the height of the terminal.
+	PageSize int `json:"page_size,omitempty"`
+
+	// RestoreSession saves the search tabs (query, results, selection
+	// and cursor) on quit and restores them on the next start.
+	RestoreSession bool `json:"restore_session,omitempty"`
+
+	// Language is the locale of the messages, e.g. "fr" or "pt_BR"; empty
+	// follows LC_ALL, LC_MESSAGES or LANG.
+	Language string `json:"language,omitempty"`
+
+	// Plain renders the TUI without colors, emoji nor unicode marks, for
+	// screen readers and dumb terminals. NO_COLOR has the same effect.
+	Plain bool `json:"plain,omitempty"`
+
+	// Compact drops the blank lines and the key hints footer to fit more
+	// results on small terminals.
+	Compact bool `json:"compact,omitempty"`
+
+	// ASCII replaces the emoji and unicode marks with ASCII ones, for
+	// terminals and fonts that show them as boxes; unlike Plain it keeps
+	// the colors.
+	ASCII bool `json:"ascii,omitempty"`
+
+	// NoTerminalTitle leaves the title of the terminal alone instead of
+	// showing the progress of the downloads in it.
+	NoTerminalTitle bool `json:"no_terminal_title,omitempty"`
+
+	// AlertOnComplete and AlertOnFailure get the attention of a user who
+	// backgrounded the terminal when a download completes or fails:
+	// AlertBell rings the terminal bell, AlertFlash flashes the screen.
+	// Empty or "off" stays silent.
+	AlertOnComplete string `json:"alert_on_complete,omitempty"`
+	AlertOnFailure  string `json:"alert_on_failure,omitempty"`
+
+	// MessageLines is the number of past status messages shown above the
+	// status line; 0 shows DefaultMessageLines, a negative number none.
+	MessageLines int `json:"message_lines,omitempty"`
+
+	// Nick is the IRC nickname used on new connections; a number is
+	// appended when it is taken. Empty picks a random one.
+	Nick string `json:"nick,omitempty"`
+
+	// Providers lists the search providers used, by name (see
+	// search.ProviderNames); empty uses all of them.
+	Providers []string `json:"providers,omitempty"`
+
+	// Theme customizes the colors of the TUI, see Theme.
+	Theme *Theme `json:"theme,omitempty"`
+
+	// overrides are the encoded values of the fields set for this run
+	// only, see Override.
+	overrides map[string]json.RawMessage
+}
+
+// Alerts of AlertOnComplete and AlertOnFailure.
+const (
+	AlertOff   = "off"
+	AlertBell  = "bell"
+	AlertFlash = "flash"
+)
+
+// ValidAlert reports whether alert is a value of AlertOnComplete and
+// AlertOnFailure.
+func ValidAlert(alert string) bool {
+	switch alert {
+	case "", AlertOff, AlertBell, AlertFlash:
+		return true
+	}
+	return false
+}
+
+// HistoryRetention returns the retention policy of the download history.
+func (c *Config) HistoryRetention() history.Retention {
+	day := 24 * time.Hour
+	return history.Retention{
+		MaxAge:       time.Duration(c.HistoryMaxDays) * day,
+		MaxEntries:   c.HistoryMaxEntries,
+		FailedMaxAge: time.Duration(c.HistoryFailedDays) * day,
+	}
+}
+
+// RateLimit returns the speed cap in bytes/s, 0 if unlimited.
+func (c *Config) RateLimit() int64 {
+	return util.MaxInt64(c.RateLimitKB, 0) << 10
+}
+
+// SessionQuota returns the session quota in bytes, 0 if unlimited.
+func (c *Config) SessionQuota() uint64 {
+	return uint64(util.MaxInt64(c.SessionQuotaMB, 0)) << 20
+}
+
+// DailyQuota returns the daily quota in bytes, 0 if unlimited.
+func (c *Config) DailyQuota() uint64 {
+	return uint64(util.MaxInt64(c.DailyQuotaMB, 0)) << 20
+}
+
+const (
+	DefaultConfirmBatchFiles = 50
+	DefaultConfirmBatchMB    = 50 << 10
+)
+
+// BatchFiles returns the number of files queued at once above which a
+// confirmation is asked, 0 if never.
+func (c *Config) BatchFiles() int {
+	if c.ConfirmBatchFiles < 0 {
+		return 0
+	}
+	if c.ConfirmBatchFiles == 0 {
+		return DefaultConfirmBatchFiles
+	}
+	return c.ConfirmBatchFiles
+}
+
+// BatchSize returns the size in bytes queued at once above which a
+// confirmation is asked, 0 if never.
+func (c *Config) BatchSize() uint64 {
+	if c.ConfirmBatchMB < 0 {
+		return 0
+	}
+	if c.ConfirmBatchMB == 0 {
+		return DefaultConfirmBatchMB << 20
+	}
+	return uint64(c.ConfirmBatchMB) << 20
+}
+
+// DefaultMaxConcurrentDownloads is used when MaxConcurrentDownloads is
+// not set.
+const DefaultMaxConcurrentDownloads = 3
+
+// Cooldown returns BotCooldown as a duration.
+func (c *Config) Cooldown() time.Duration {
+	return time.Duration(c.BotCooldown) * time.Second
+}
+
+const (
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = time.Minute
+)
+
+// Retries returns the number of retries of a failed download.
+func (c *Config) Retries() int {
+	if c.MaxRetries < 0 {
+		return 0
+	}
+	if c.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	return c.MaxRetries
+}
+
+// RetryWait returns the delay before retrying a failed download.
+func (c *Config) RetryWait() time.Duration {
+	if c.RetryDelay <= 0 {
+		return DefaultRetryDelay
+	}
+	return time.Duration(c.RetryDelay) * time.Second
+}
+
+const (
+	DefaultBotFailureLimit   = 3
+	DefaultBotFailureBackoff = 15 * time.Minute
+)
+
+// FailureLimit returns the consecutive failures after which a bot is
+// backed off, 0 when disabled.
+func (c *Config) FailureLimit() int {
+	if c.BotFailureLimit < 0 {
+		return 0
+	}
+	if c.BotFailureLimit == 0 {
+		return DefaultBotFailureLimit
+	}
+	return c.BotFailureLimit
+}
+
+// FailureBackoff returns how long a failing bot is left alone.
+func (c *Config) FailureBackoff() time.Duration {
+	if c.BotFailureBackoff <= 0 {
+		return DefaultBotFailureBackoff
+	}
+	return time.Duration(c.BotFailureBackoff) * time.Second
+}
+
+// DefaultMessageLines is used when MessageLines is not set.
+const DefaultMessageLines = 3
+
+// Messages returns the number of past status messages shown.
+func (c *Config) Messages() int {
+	if c.MessageLines < 0 {
+		return 0
+	}
+	if c.MessageLines == 0 {
+		return DefaultMessageLines
+	}
+	return c.MessageLines
+}
+
+// MaxConcurrent returns the number of downloads allowed to run at once.
+func (c *Config) MaxConcurrent() int {
+	if c.MaxConcurrentDownloads <= 0 {
+		return DefaultMaxConcurrentDownloads
+	}
+	return c.MaxConcurrentDownloads
+}
+
+// IdleTimeout returns ConnectionIdleTimeout as a duration.
+func (c *Config) IdleTimeout() time.Duration {
+	return time.Duration(c.ConnectionIdleTimeout) * time.Second
+}
+
+func Default() *Config {
+	return &Config{
+		Networks: make(map[string]Network),
+	}
+}
+
+// Dir returns the directory holding the config file and the application
+// state (e.g. ~/.config/xdcc-tui).
+func Dir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, appDirName)
+}
+
+// LocalesDir returns the directory of the translations installed by the
+// user, which override the built-in ones (e.g. ~/.config/xdcc-tui/locales).
+func LocalesDir() string {
+	return filepath.Join(Dir(), localesDirName)
+}
+
+// DefaultPath returns the location of the config file inside the user's
+// config directory (e.g. ~/.config/xdcc-tui/config.json).
+func DefaultPath() string {
+	return filepath.Join(Dir(), configFileName)
+}
+
+// Load reads the config file at path, then the environment variables
+// overriding it (see EnvPrefix). A missing file is not an error: the
+// default configuration is used instead.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if cfg.Networks == nil {
+		cfg.Networks = make(map[string]Network)
+	}
+
+	// bot names are case-insensitive on IRC
+	bots := make(map[string]Bot, len(cfg.Bots))
+	for name, bot := range cfg.Bots {
+		bots[strings.ToLower(name)] = bot
+	}
+	cfg.Bots = bots
+	return cfg, nil
+}
+
+// Save writes the config to path. Keys of the file the config doesn't
+// know about (e.g. written by a newer version) are kept, and so are the
+// values of the fields overridden for this run.
+func (c *Config) Save(path string) error {
+	fields, err := c.fields()
+	if err != nil {
+		return err
+	}
+
+	old, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	oldFields := make(map[string]json.RawMessage)
+	if err == nil {
+		if err := json.Unmarshal(old, &oldFields); err != nil {
+			return err
+		}
+		known := jsonKeys(reflect.TypeOf(*c))
+		for key, value := range oldFields {
+			if !known[key] {
+				fields[key] = value
+			}
+		}
+	}
+	for key, value := range c.overrides {
+		if string(fields[key]) != string(value) {
+			// changed again since, e.g. in the settings view.
+			continue
+		}
+		if old, ok := oldFields[key]; ok {
+			fields[key] = old
+		} else {
+			delete(fields, key)
+		}
+	}
+
+	data, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// fields returns the config encoded, by json key.
+func (c *Config) fields() (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Override changes fields of the config with set for this run only, e.g.
+// from command-line flags: Save keeps the values of the file for them
+// unless they are changed again.
+func (c *Config) Override(set func(c *Config)) error {
+	before, err := c.fields()
+	if err != nil {
+		return err
+	}
+	set(c)
+	after, err := c.fields()
+	if err != nil {
+		return err
+	}
+	if c.overrides == nil {
+		c.overrides = make(map[string]json.RawMessage)
+	}
+	for key, value := range after {
+		if string(before[key]) != string(value) {
+			c.overrides[key] = value
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			c.overrides[key] = nil
+		}
+	}
+	return nil
+}
+
+// jsonKeys returns the keys the fields of struct type t are encoded as.
+func jsonKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		keys[name] = true
+	}
+	return keys
+}
+
+// Network returns the settings for the given network, falling back to the
+// global values for anything the network doesn't override.
+func (c *Config) Network(name string) Network {
+	n := c.Networks[name]
+	if n.ServerPassword == "" {
+		n.ServerPassword = c.ServerPassword
+	}
+	return n
+}
+
+// Bot returns the settings for the given bot, falling back to the global
+// request template.
+func (c *Config) Bot(network, name string) Bot {
+	bot, ok := c.Bots[strings.ToLower(network+"/"+name)]
+	if !ok {
+		bot = c.Bots[strings.ToLower(name)]
+	}
+	if bot.RequestTemplate == "" {
+		bot.RequestTemplate = c.RequestTemplate
+	}
+	return bot
+}
+
+// TransferConfig builds the xdcc transfer configuration for file. An
+// empty outPath saves to the path chosen by FilePath.
+// expectedSize is the size reported by the search provider (or 0), date
+// is passed on to FilePath.
+func (c *Config) TransferConfig(file xdcc.IRCFile, outPath string, expectedSize int64, date time.Time) xdcc.Config {
+	var destination func(string) string
+	outPath = expandHome(outPath)
+	if outPath == "" {
+		// route by the name announced by the bot, which may differ from
+		// the one reported by search providers.
+		outPath = c.DownloadDirectory()
+		destination = func(name string) string {
+			return c.FilePath(file, name, date)
+		}
+	}
+
+	return xdcc.Config{
+		File:           file,
+		ExpectedSize:   expectedSize,
+		OutPath:        outPath,
+		Destination:    destination,
+		IncompleteDir:  expandHome(c.IncompleteDir),
+		ServerPassword: c.Network(file.Network).ServerPassword,
+		ListenPorts:    xdcc.PortRange{Min: c.DCCPortMin, Max: c.DCCPortMax},
+		Preallocate:    c.Preallocate,
+		ExternalIP:     c.ExternalIP,
+		STUNServer:     c.STUNServer,
+		BindAddress:    c.BindAddress,
+		BufferSize:     c.BufferSize,
+		Nick:           c.Nick,
+
+		RequestTemplate:  c.Bot(file.Network, file.UserName).RequestTemplate,
+		RequestInChannel: c.Bot(file.Network, file.UserName).RequestInChannel,
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables overriding the keys of the
+// config file: the key follows in upper case, e.g. XDCC_TUI_DOWNLOAD_DIR
+// for download_dir.
+const EnvPrefix = "XDCC_TUI_"
+
+// EnvName returns the environment variable overriding the config key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// applyEnv overrides the fields of the config with the environment
+// variables set for them, the natural way to configure containers; like
+// command-line flags, they are not written to the file, see Override.
+// Strings are taken as is, booleans as strconv.ParseBool does, lists of
+// strings may be comma separated and anything else is JSON, e.g.
+// XDCC_TUI_NETWORKS='{"irc.example.net": {"server_password": "secret"}}'.
+// An empty variable resets the key.
+func (c *Config) applyEnv(lookup func(key string) (string, bool)) error {
+	var err error
+	overrideErr := c.Override(func(c *Config) {
+		v := reflect.ValueOf(c).Elem()
+		for i := 0; i < v.NumField() && err == nil; i++ {
+			key := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+			if key == "" || key == "-" {
+				continue
+			}
+			value, ok := lookup(EnvName(key))
+			if !ok {
+				continue
+			}
+			if e := setField(v.Field(i), value); e != nil {
+				err = fmt.Errorf("%s: %w", EnvName(key), e)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return overrideErr
+}
+
+// setField sets field to the value of an environment variable.
+func setField(field reflect.Value, value string) error {
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+		return nil
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(value, "["):
+		var list []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+	return json.Unmarshal([]byte(value), field.Addr().Interface())
+}
@@ -0,0 +1,36 @@
+package config
+
+import "strings"
+
+// FilterPreset is a named results filter, picked from a menu instead of
+// typed, e.g. {"name": "1080p video", "filter": "type:video 1080p"}.
+type FilterPreset struct {
+	Name   string `json:"name"`
+	Filter string `json:"filter"`
+}
+
+// DefaultFilterPresets are offered along with the presets of the config.
+var DefaultFilterPresets = []FilterPreset{
+	{Name: "video only", Filter: "type:video"},
+	{Name: "larger than 1GB", Filter: ">1GB"},
+	{Name: "1080p", Filter: "1080p"},
+	{Name: "not HEVC", Filter: "!hevc !x265 !h265"},
+}
+
+// Presets returns the filter presets: the defaults, then the ones of the
+// config file. A preset named like a default one replaces it.
+func (c *Config) Presets() []FilterPreset {
+	presets := append([]FilterPreset{}, DefaultFilterPresets...)
+	for _, p := range c.FilterPresets {
+		replaced := false
+		for i := range presets {
+			if strings.EqualFold(presets[i].Name, p.Name) {
+				presets[i], replaced = p, true
+			}
+		}
+		if !replaced {
+			presets = append(presets, p)
+		}
+	}
+	return presets
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"xdcc-tui/xdcc"
+)
+
+// Rule routes matching files to Dir. All the non-empty conditions must
+// hold: Match is a glob on the file name (e.g. "*.mkv", "*S??E??*"),
+// Keyword a substring of it and Channel one of the channels of the pack.
+// Comparisons ignore case. Template overrides the filename template for
+// the matching files.
+type Rule struct {
+	Match    string `json:"match,omitempty"`
+	Keyword  string `json:"keyword,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+	Dir      string `json:"dir"`
+	Template string `json:"template,omitempty"`
+}
+
+func (r *Rule) matches(file xdcc.IRCFile, name string) bool {
+	name = strings.ToLower(name)
+	if r.Match != "" {
+		ok, err := path.Match(strings.ToLower(r.Match), name)
+		if err != nil || !ok {
+			return false
+		}
+	}
+	if r.Keyword != "" && !strings.Contains(name, strings.ToLower(r.Keyword)) {
+		return false
+	}
+	if r.Channel != "" && !containsFold(file.Channels(), r.Channel) {
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// DownloadDirectory returns the directory of files not matched by any
+// rule, the current directory by default.
+func (c *Config) DownloadDirectory() string {
+	if c.DownloadDir == "" {
+		return "."
+	}
+	return expandHome(c.DownloadDir)
+}
+
+// WatchDirectory returns WatchDir with "~" expanded, empty when no
+// directory is watched.
+func (c *Config) WatchDirectory() string {
+	if c.WatchDir == "" {
+		return ""
+	}
+	return expandHome(c.WatchDir)
+}
+
+// Destination returns the directory a file should be saved to: the Dir
+// of the first matching rule, or DownloadDirectory.
+func (c *Config) Destination(file xdcc.IRCFile, name string) string {
+	for i := range c.Rules {
+		if c.Rules[i].matches(file, name) && c.Rules[i].Dir != "" {
+			return expandHome(c.Rules[i].Dir)
+		}
+	}
+	return c.DownloadDirectory()
+}
+
+// expandHome replaces a leading "~" with the user's home directory.
+func expandHome(dir string) string {
+	if dir != "~" && !strings.HasPrefix(dir, "~/") {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dir
+	}
+	return filepath.Join(home, dir[1:])
+}
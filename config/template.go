@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"xdcc-tui/util"
+	"xdcc-tui/xdcc"
+)
+
+// placeholderRegexp matches the {field} placeholders of a template.
+var placeholderRegexp = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// templateFields returns the values of the placeholders usable in
+// filename templates. show, season and episode are empty unless the name
+// looks like an episode.
+func templateFields(file xdcc.IRCFile, name string, date time.Time) map[string]string {
+	ext := filepath.Ext(name)
+	fields := map[string]string{
+		"original_name": name,
+		"name":          strings.TrimSuffix(name, ext),
+		"ext":           ext,
+		"date":          date.Format("2006-01-02"),
+		"network":       file.Network,
+		"channel":       strings.TrimPrefix(file.Channels()[0], "#"),
+		"bot":           file.UserName,
+	}
+	if ep, ok := util.ParseEpisode(name); ok {
+		fields["show"] = ep.Show
+		fields["season"] = fmt.Sprintf("%02d", ep.Season)
+		fields["episode"] = fmt.Sprintf("%02d", ep.Number)
+	}
+	return fields
+}
+
+// renderTemplate expands a filename template into a relative path. Each
+// component is sanitized so that templates can't escape the destination,
+// and components using a field without value (e.g. {season} for a movie)
+// are dropped.
+func renderTemplate(tmpl string, fields map[string]string) string {
+	parts := make([]string, 0)
+	for _, part := range strings.Split(tmpl, "/") {
+		missing := false
+		part = placeholderRegexp.ReplaceAllStringFunc(part, func(p string) string {
+			v := fields[strings.Trim(p, "{}")]
+			if v == "" {
+				missing = true
+			}
+			return v
+		})
+		part = strings.TrimSpace(part)
+		if missing || part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts = append(parts, xdcc.SanitizeFileName(part))
+	}
+	if len(parts) == 0 {
+		return fields["original_name"]
+	}
+	return filepath.Join(parts...)
+}
+
+// FilePath returns where a file announced as name is saved: its
+// Destination directory joined with the rendered filename template.
+// date fills {date}; it's fixed when the file is first queued so that a
+// download resumed on another day keeps its path.
+func (c *Config) FilePath(file xdcc.IRCFile, name string, date time.Time) string {
+	dir := c.Destination(file, name)
+
+	tmpl := c.FilenameTemplate
+	for i := range c.Rules {
+		if c.Rules[i].matches(file, name) {
+			if c.Rules[i].Template != "" {
+				tmpl = c.Rules[i].Template
+			}
+			break
+		}
+	}
+	if tmpl == "" {
+		return filepath.Join(dir, name)
+	}
+	return filepath.Join(dir, renderTemplate(tmpl, templateFields(file, name, date)))
+}
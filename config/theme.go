@@ -0,0 +1,67 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Theme customizes the colors of the TUI.
+type Theme struct {
+	// FileTypes tag and color the results by extension. Entries replace
+	// the default category of the same name, or add a new one; an empty
+	// color shows the tag without coloring it.
+	FileTypes []FileType `json:"file_types,omitempty"`
+}
+
+// FileType is a category of files recognized by their extension.
+type FileType struct {
+	Name       string   `json:"name"`
+	Color      string   `json:"color,omitempty"` // ANSI color number or "#rrggbb"
+	Extensions []string `json:"extensions"`      // e.g. ".mkv"
+}
+
+// DefaultFileTypes are the categories of the default theme.
+var DefaultFileTypes = []FileType{
+	{Name: "video", Color: "81", Extensions: []string{".mkv", ".mp4", ".avi", ".m4v", ".mov", ".wmv", ".webm", ".ts", ".mpg"}},
+	{Name: "archive", Color: "179", Extensions: []string{".zip", ".rar", ".7z", ".tar", ".gz", ".bz2", ".xz", ".tgz"}},
+	{Name: "iso", Color: "168", Extensions: []string{".iso", ".img", ".bin", ".cue", ".nrg"}},
+	{Name: "audio", Color: "114", Extensions: []string{".mp3", ".flac", ".ogg", ".m4a", ".aac", ".wav", ".opus"}},
+	{Name: "text", Color: "252", Extensions: []string{".txt", ".nfo", ".pdf", ".epub", ".mobi", ".srt", ".ass"}},
+}
+
+// FileTypes returns the file categories of the theme: the defaults with
+// the ones of the config file applied.
+func (c *Config) FileTypes() []FileType {
+	types := append([]FileType{}, DefaultFileTypes...)
+	if c.Theme == nil {
+		return types
+	}
+	for _, t := range c.Theme.FileTypes {
+		replaced := false
+		for i := range types {
+			if strings.EqualFold(types[i].Name, t.Name) {
+				types[i], replaced = t, true
+			}
+		}
+		if !replaced {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// FileTypeOf returns the category of the file name among types.
+func FileTypeOf(types []FileType, name string) (FileType, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return FileType{}, false
+	}
+	for _, t := range types {
+		for _, e := range t.Extensions {
+			if strings.EqualFold(e, ext) {
+				return t, true
+			}
+		}
+	}
+	return FileType{}, false
+}
@@ -0,0 +1,248 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Entry records the outcome of one download.
+type Entry struct {
+	Name   string    `json:"name"`
+	URL    string    `json:"url"`
+	Size   int64     `json:"size"`
+	Path   string    `json:"path,omitempty"`
+	Status Status    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Date   time.Time `json:"date"`
+
+	// Duration is how long the file took to receive, 0 when unknown.
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// QueueWait is the time spent in the queue of the bot before the
+	// transfer started.
+	QueueWait time.Duration `json:"queue_wait,omitempty"`
+
+	// Suspect is set when the received size didn't match the announced
+	// or provider-reported size.
+	Suspect bool `json:"suspect,omitempty"`
+
+	// Log is what happened to the download: retries, bot replies, errors.
+	Log []LogEntry `json:"log,omitempty"`
+}
+
+// Speed returns the average speed of the download in bytes/s, 0 when
+// unknown.
+func (e Entry) Speed() float64 {
+	if e.Duration <= 0 || e.Size <= 0 || e.Status != StatusCompleted {
+		return 0
+	}
+	return float64(e.Size) / e.Duration.Seconds()
+}
+
+// LogEntry is a timestamped line of the event log of a download.
+type LogEntry struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// MaxLogEntries bounds the event log kept for each download.
+const MaxLogEntries = 30
+
+// AppendLog adds a line to log, dropping the oldest ones beyond
+// MaxLogEntries.
+func AppendLog(log []LogEntry, text string) []LogEntry {
+	// never append in place: copies of the log may share its array.
+	log = append(log[:len(log):len(log)], LogEntry{Time: time.Now(), Text: text})
+	if len(log) > MaxLogEntries {
+		log = append([]LogEntry{}, log[len(log)-MaxLogEntries:]...)
+	}
+	return log
+}
+
+// Store is the download history, kept as a JSON file.
+type Store struct {
+	mtx     sync.Mutex
+	path    string
+	entries []Entry
+}
+
+const FileName = "history.json"
+
+// Open loads the history stored at path. A missing file yields an empty
+// history.
+func Open(path string) (*Store, error) {
+	store := &Store{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.entries); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Add appends an entry and writes the history back to disk.
+func (store *Store) Add(e Entry) error {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	if e.Date.IsZero() {
+		e.Date = time.Now()
+	}
+	store.entries = append(store.entries, e)
+	return store.save()
+}
+
+// Remove deletes the entry recorded for the same download as e and
+// writes the history back. It reports whether the entry was found.
+func (store *Store) Remove(e Entry) (bool, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	for i, old := range store.entries {
+		if old.Name == e.Name && old.URL == e.URL && old.Date.Equal(e.Date) {
+			store.entries = append(store.entries[:i:i], store.entries[i+1:]...)
+			return true, store.save()
+		}
+	}
+	return false, nil
+}
+
+// Retention says which entries Prune drops: entries older than MaxAge,
+// and the oldest ones beyond MaxEntries. Failed entries are kept for
+// FailedMaxAge instead, and aren't dropped for the count before that, to
+// help finding out why they failed. Zero values disable a limit.
+type Retention struct {
+	MaxAge       time.Duration
+	MaxEntries   int
+	FailedMaxAge time.Duration
+}
+
+// Prune drops the entries the retention policy doesn't keep and writes
+// the history back when some were. It returns the number dropped.
+func (store *Store) Prune(r Retention) (int, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	now := time.Now()
+	// failedKept reports whether a failed entry is still within its own
+	// age limit, which protects it from the count limit.
+	failedKept := func(e Entry) bool {
+		return e.Status == StatusFailed && r.FailedMaxAge > 0 && now.Sub(e.Date) <= r.FailedMaxAge
+	}
+	expired := func(e Entry) bool {
+		maxAge := r.MaxAge
+		if e.Status == StatusFailed && r.FailedMaxAge > 0 {
+			maxAge = r.FailedMaxAge
+		}
+		return maxAge > 0 && now.Sub(e.Date) > maxAge
+	}
+
+	// walk from the newest entry so that the count keeps the latest ones.
+	kept := make([]Entry, 0, len(store.entries))
+	count := 0
+	for i := len(store.entries) - 1; i >= 0; i-- {
+		e := store.entries[i]
+		if expired(e) {
+			continue
+		}
+		if !failedKept(e) {
+			if r.MaxEntries > 0 && count >= r.MaxEntries {
+				continue
+			}
+			count++
+		}
+		kept = append(kept, e)
+	}
+
+	dropped := len(store.entries) - len(kept)
+	if dropped == 0 {
+		return 0, nil
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	store.entries = kept
+	return dropped, store.save()
+}
+
+// Entries returns a copy of all entries, oldest first.
+func (store *Store) Entries() []Entry {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	return append([]Entry{}, store.entries...)
+}
+
+// FindCompleted returns the latest completed download of a file with the
+// given name and a similar size. A zero size matches any size, since
+// search providers do not always know it.
+func (store *Store) FindCompleted(name string, size int64) (Entry, bool) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	for i := len(store.entries) - 1; i >= 0; i-- {
+		e := store.entries[i]
+		if e.Status == StatusCompleted && e.Name == name && SimilarSize(e.Size, size) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Latest returns the most recent entry of a file with the given name,
+// whatever its outcome.
+func (store *Store) Latest(name string) (Entry, bool) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	for i := len(store.entries) - 1; i >= 0; i-- {
+		if store.entries[i].Name == name {
+			return store.entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// sizeTolerance is the relative difference under which two sizes are
+// considered the same file; providers round sizes (e.g. "1.4G").
+const sizeTolerance = 0.05
+
+// SimilarSize reports whether a and b may be the size of the same file.
+func SimilarSize(a, b int64) bool {
+	if a <= 0 || b <= 0 {
+		return true
+	}
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	return float64(diff) <= sizeTolerance*float64(a)
+}
+
+func (store *Store) save() error {
+	data, err := json.MarshalIndent(store.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(store.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(store.path, data, 0644)
+}
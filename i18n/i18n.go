@@ -0,0 +1,195 @@
+// Package i18n translates the user-visible strings of the TUI and the
+// CLI. Messages are looked up by key in the catalog of the active locale,
+// a JSON object of key -> message in locales/<locale>.json; missing keys
+// fall back to the English catalog.
+//
+// Messages are fmt formats. Translations may reorder the arguments with
+// explicit indexes, e.g. "%[2]s: %[1]d".
+//
+// Contributed translations go to locales/ and are built in; users can
+// also drop a catalog in the locales folder of the config directory,
+// which overrides the built-in one of the same name.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultLocale is the locale of the messages in the code's catalog and
+// the fallback of every other one.
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+var (
+	fallback = mustLoadBuiltin(DefaultLocale)
+	active   = fallback
+	locale   = DefaultLocale
+)
+
+func mustLoadBuiltin(name string) map[string]string {
+	catalog, err := loadBuiltin(name)
+	if err != nil {
+		panic(fmt.Sprintf("i18n: %s catalog: %v", name, err))
+	}
+	return catalog
+}
+
+func loadBuiltin(name string) (map[string]string, error) {
+	data, err := builtin.ReadFile("locales/" + name + ".json")
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+func parse(data []byte) (map[string]string, error) {
+	var catalog map[string]string
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// T returns the message of key in the active locale, formatted with args
+// as by fmt.Sprintf. Without args the message is returned as is, so that
+// it can be passed on as a format. An unknown key is returned unchanged.
+func T(key string, args ...interface{}) string {
+	msg, ok := active[key]
+	if !ok {
+		if msg, ok = fallback[key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Errorf is fmt.Errorf with the message of key as format.
+func Errorf(key string, args ...interface{}) error {
+	return fmt.Errorf(T(key), args...)
+}
+
+// Locale returns the active locale.
+func Locale() string {
+	return locale
+}
+
+// Setup activates the catalog of the locale name, or of the environment
+// (LC_ALL, LC_MESSAGES, LANG) when name is empty. dir is searched before
+// the built-in catalogs. A locale without catalog keeps English; only a
+// locale asked for by name is an error then.
+func Setup(name, dir string) error {
+	explicit := name != ""
+	if !explicit {
+		name = FromEnv()
+	}
+	for _, candidate := range candidates(name) {
+		catalog, err := load(candidate, dir)
+		if err == nil {
+			active, locale = catalog, candidate
+			return nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("locale %s: %v", candidate, err)
+		}
+	}
+	active, locale = fallback, DefaultLocale
+	if !explicit {
+		return nil
+	}
+	return fmt.Errorf("no translation for locale %s, using %s", name, DefaultLocale)
+}
+
+func load(name, dir string) (map[string]string, error) {
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+		if err == nil {
+			return parse(data)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return loadBuiltin(name)
+}
+
+// FromEnv returns the locale of the environment, empty for the C and
+// POSIX locales.
+func FromEnv() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(env); v != "" {
+			if v == "C" || v == "POSIX" || strings.HasPrefix(v, "C.") {
+				return ""
+			}
+			return v
+		}
+	}
+	return ""
+}
+
+// candidates turns a locale such as "pt_BR.UTF-8" into the catalog
+// names to try, most specific first: "pt_BR", "pt".
+func candidates(name string) []string {
+	name, _, _ = strings.Cut(name, ".")
+	name, _, _ = strings.Cut(name, "@")
+	name = strings.ReplaceAll(name, "-", "_")
+	if name == "" {
+		return nil
+	}
+	lang, region, ok := strings.Cut(name, "_")
+	lang = strings.ToLower(lang)
+	if !ok {
+		return []string{lang}
+	}
+	return []string{lang + "_" + strings.ToUpper(region), lang}
+}
+
+// Available returns the locales with a catalog, built-in or in dir.
+func Available(dir string) []string {
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if strings.HasSuffix(file, ".json") {
+			seen[strings.TrimSuffix(file, ".json")] = true
+		}
+	}
+	if entries, err := builtin.ReadDir("locales"); err == nil {
+		for _, e := range entries {
+			add(e.Name())
+		}
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			add(e.Name())
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Missing returns the keys of the English catalog that the catalog of
+// the active locale lacks, for translators.
+func Missing() []string {
+	var keys []string
+	for key := range fallback {
+		if _, ok := active[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -19,6 +19,7 @@ const (
 
 type ProgressBar interface {
 	Increment(n int)
+	SetCurrent(n int)
 	SetTotal(n int)
 	SetFileName(fileName string)
 	SetState(state ProgressState)
@@ -106,6 +107,10 @@ func (bar *progressBarImpl) Increment(n int) {
 	bar.DecoratorEwmaUpdate(time.Second)
 }
 
+func (bar *progressBarImpl) SetCurrent(n int) {
+	bar.Bar.SetCurrent(int64(n))
+}
+
 func (bar *progressBarImpl) SetState(state ProgressState) {
 	if state != bar.state {
 		oldBar := bar.Bar
@@ -2,8 +2,14 @@ package search
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"xdcc-tui/applog"
 	"xdcc-tui/xdcc"
 )
 
@@ -12,12 +18,41 @@ type XdccFileInfo struct {
 	Name string
 	Size int64
 	Slot int
+	Gets int // downloads reported by the provider, -1 if unknown
 }
 
 type XdccSearchProvider interface {
+	// Name is a short name of the provider for messages, e.g. "sunxdcc".
+	Name() string
 	Search(keywords []string) ([]XdccFileInfo, error)
 }
 
+// ProviderError is the failure of one provider during a search.
+type ProviderError struct {
+	Provider string
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Provider + ": " + e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// ProviderErrors lists the providers that failed during a search; the
+// results of the others are still returned along with it.
+type ProviderErrors []*ProviderError
+
+func (errs ProviderErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
 type ProviderAggregator struct {
 	providerList []XdccSearchProvider
 }
@@ -30,23 +65,98 @@ func NewProviderAggregator(providers ...XdccSearchProvider) *ProviderAggregator
 	}
 }
 
+// ProviderNames are the names of the available providers.
+var ProviderNames = []string{"xdcc.eu", "sunxdcc"}
+
+// NewProvider returns the provider called name.
+func NewProvider(name string) (XdccSearchProvider, error) {
+	switch strings.ToLower(name) {
+	case "xdcc.eu":
+		return &XdccEuProvider{}, nil
+	case "sunxdcc":
+		return &SunXdccProvider{}, nil
+	}
+	return nil, fmt.Errorf("unknown search provider %q (available: %s)", name, strings.Join(ProviderNames, ", "))
+}
+
+// NewAggregatorOf returns an aggregator of the providers called names,
+// or of all of them when names is empty.
+func NewAggregatorOf(names []string) (*ProviderAggregator, error) {
+	if len(names) == 0 {
+		names = ProviderNames
+	}
+	aggr := NewProviderAggregator()
+	for _, name := range names {
+		p, err := NewProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		aggr.AddProvider(p)
+	}
+	return aggr, nil
+}
+
 func (registry *ProviderAggregator) AddProvider(provider XdccSearchProvider) {
 	registry.providerList = append(registry.providerList, provider)
 }
 
 const MaxResults = 1024
 
+// ProviderStatus is how one provider fared during a search.
+type ProviderStatus struct {
+	Provider string
+	Results  int // before removing the duplicates of other providers
+	Duration time.Duration
+	Err      error
+}
+
+// TimedOut reports whether the provider failed to answer in time.
+func (s ProviderStatus) TimedOut() bool {
+	var netErr net.Error
+	return errors.As(s.Err, &netErr) && netErr.Timeout()
+}
+
+// String renders e.g. "xdcc.eu: 142 (0.4s)" or "sunxdcc: timeout".
+func (s ProviderStatus) String() string {
+	switch {
+	case s.TimedOut():
+		return s.Provider + ": timeout"
+	case s.Err != nil:
+		return s.Provider + ": failed"
+	}
+	return fmt.Sprintf("%s: %d (%.1fs)", s.Provider, s.Results, s.Duration.Seconds())
+}
+
+// Search queries all providers at once. When some of them fail the
+// error is a ProviderErrors, returned with the results of the others.
 func (registry *ProviderAggregator) Search(keywords []string) ([]XdccFileInfo, error) {
+	results, _, err := registry.SearchWithStatus(keywords)
+	return results, err
+}
+
+// SearchWithStatus is Search also reporting the outcome of each
+// provider, in the order they were added.
+func (registry *ProviderAggregator) SearchWithStatus(keywords []string) ([]XdccFileInfo, []ProviderStatus, error) {
 	allResults := make(map[xdcc.IRCFile]XdccFileInfo)
+	statuses := make([]ProviderStatus, len(registry.providerList))
+	var failed ProviderErrors
 
 	mtx := sync.Mutex{}
 
 	wg := sync.WaitGroup{}
 	wg.Add(len(registry.providerList))
-	for _, p := range registry.providerList {
-		go func(p XdccSearchProvider) {
+	for i, p := range registry.providerList {
+		go func(i int, p XdccSearchProvider) {
+			defer wg.Done()
+			start := time.Now()
 			resList, err := p.Search(keywords)
+			statuses[i] = ProviderStatus{Provider: p.Name(), Results: len(resList), Duration: time.Since(start), Err: err}
 			if err != nil {
+				applog.Warnf("search provider %s: %v", p.Name(), err)
+				statuses[i].Results = 0
+				mtx.Lock()
+				failed = append(failed, &ProviderError{Provider: p.Name(), Err: err})
+				mtx.Unlock()
 				return
 			}
 
@@ -55,9 +165,7 @@ func (registry *ProviderAggregator) Search(keywords []string) ([]XdccFileInfo, e
 				allResults[res.URL] = res
 			}
 			mtx.Unlock()
-
-			wg.Done()
-		}(p)
+		}(i, p)
 	}
 	wg.Wait()
 
@@ -65,7 +173,10 @@ func (registry *ProviderAggregator) Search(keywords []string) ([]XdccFileInfo, e
 	for _, res := range allResults {
 		results = append(results, res)
 	}
-	return results, nil
+	if len(failed) > 0 {
+		return results, statuses, failed
+	}
+	return results, statuses, nil
 }
 
 const (
@@ -74,6 +185,16 @@ const (
 	GigaByte = MegaByte * 1024
 )
 
+// parseGets parses a download count such as "42x", -1 if it isn't one.
+func parseGets(s string) int {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "x"))
+	gets, err := strconv.Atoi(s)
+	if err != nil || gets < 0 {
+		return -1
+	}
+	return gets
+}
+
 func parseFileSize(sizeStr string) (int64, error) {
 	if len(sizeStr) == 0 {
 		return -1, errors.New("empty string")
@@ -30,6 +30,7 @@ func (p *SunXdccProvider) parseResponseEntry(entry *SunXdccResponse, index int)
 
 	info.Size, _ = parseFileSize(sizeString) // ignoring error
 	info.Name = entry.Fname[index]
+	info.Gets = parseGets(entry.Gets[index])
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +50,10 @@ type SunXdccResponse struct {
 	Fname   []string
 }
 
+func (*SunXdccProvider) Name() string {
+	return "sunxdcc"
+}
+
 func (p *SunXdccProvider) Search(keywords []string) ([]XdccFileInfo, error) {
 	keywordString := strings.Join(keywords, " ")
 	searchkey := strings.Join(strings.Fields(keywordString), "+")
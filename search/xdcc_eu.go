@@ -32,6 +32,7 @@ func (p *XdccEuProvider) parseFields(fields []string) (*XdccFileInfo, error) {
 		return nil, err
 	}
 
+	fInfo.Gets = parseGets(fields[4])
 	fInfo.Size, _ = parseFileSize(fields[5]) // ignoring error
 
 	fInfo.Name = fields[6]
@@ -43,6 +44,10 @@ func (p *XdccEuProvider) parseFields(fields []string) (*XdccFileInfo, error) {
 	return fInfo, nil
 }
 
+func (*XdccEuProvider) Name() string {
+	return "xdcc.eu"
+}
+
 func (p *XdccEuProvider) Search(keywords []string) ([]XdccFileInfo, error) {
 	keywordString := strings.Join(keywords, " ")
 	searchkey := strings.Join(strings.Fields(keywordString), "+")
@@ -0,0 +1,45 @@
+package tui
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/config"
+	"xdcc-tui/i18n"
+)
+
+// flashDuration is how long the screen stays reversed for AlertFlash.
+const flashDuration = 150 * time.Millisecond
+
+// alertCmd rings the bell or flashes the screen as configured by alert,
+// see config.AlertOnComplete.
+func alertCmd(alert string) tea.Cmd {
+	switch alert {
+	case config.AlertBell:
+		return func() tea.Msg {
+			os.Stdout.WriteString("\a")
+			return nil
+		}
+	case config.AlertFlash:
+		// reverse video (DECSCNM), the "flash" of terminfo.
+		return func() tea.Msg {
+			os.Stdout.WriteString("\x1b[?5h")
+			time.Sleep(flashDuration)
+			os.Stdout.WriteString("\x1b[?5l")
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseAlert checks an alert typed in the settings view.
+func parseAlert(value string) (string, error) {
+	value = strings.ToLower(value)
+	if !config.ValidAlert(value) {
+		return "", i18n.Errorf("settings.invalid_alert", value)
+	}
+	return value, nil
+}
@@ -0,0 +1,61 @@
+package tui
+
+import (
+	"time"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+)
+
+// batchSize returns the number and the total size of the files not
+// queued yet.
+func (m *Model) batchSize(files []search.XdccFileInfo) (int, int64) {
+	count, size := 0, int64(0)
+	for _, file := range files {
+		if m.isQueued(file) {
+			continue
+		}
+		count++
+		if file.Size > 0 {
+			size += file.Size
+		}
+	}
+	return count, size
+}
+
+// largeBatch reports whether queueing files needs a confirmation, see
+// config.BatchFiles and config.BatchSize.
+func (m *Model) largeBatch(files []search.XdccFileInfo) bool {
+	count, size := m.batchSize(files)
+	if limit := m.config.BatchFiles(); limit > 0 && count > limit {
+		return true
+	}
+	limit := m.config.BatchSize()
+	return limit > 0 && uint64(size) > limit
+}
+
+// batchSummary sums up a large batch for its confirmation: the number of
+// files, their size and how long they should take.
+func (m *Model) batchSummary(files []search.XdccFileInfo) string {
+	count, size := m.batchSize(files)
+	speed := m.expectedSpeed()
+	if speed <= 0 {
+		return i18n.T("confirm.batch", count, FormatSize(size))
+	}
+	eta := time.Duration(float64(size) / speed * float64(time.Second))
+	return i18n.T("confirm.batch_eta", count, FormatSize(size), formatEstimate(eta))
+}
+
+// expectedSpeed returns the speed the downloads can be expected to go at:
+// the average of the history, capped by the speed limit; 0 when unknown.
+func (m *Model) expectedSpeed() float64 {
+	var all botStats
+	for _, e := range m.history.Entries() {
+		all.add(e)
+	}
+	speed := all.speed()
+	if limit := float64(m.limiter.Rate()); limit > 0 && (speed == 0 || limit < speed) {
+		speed = limit
+	}
+	return speed
+}
@@ -0,0 +1,99 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/xdcc"
+)
+
+// botQueue follows the position of a request queued by a bot, from the
+// position notices it sends.
+type botQueue struct {
+	position  int
+	total     int
+	remaining time.Duration // announced by the bot, 0 if not
+	updated   time.Time     // when the last notice came
+	entered   time.Time     // when the first notice came
+
+	// first notice with a position, to estimate the pace of the queue
+	firstPosition int
+	first         time.Time
+}
+
+// update takes a new notice of the bot into account.
+func (q *botQueue) update(e *xdcc.TransferQueuedEvent, now time.Time) {
+	q.updated = now
+	if q.entered.IsZero() {
+		q.entered = now
+	}
+	q.remaining = e.Remaining
+	if e.Total > 0 {
+		q.total = e.Total
+	}
+	if e.Position <= 0 {
+		return
+	}
+	q.position = e.Position
+	if q.first.IsZero() {
+		q.firstPosition, q.first = e.Position, now
+	}
+}
+
+// estimate returns the wait left, preferring the one announced by the bot
+// over the pace of the positions seen so far; 0 if unknown.
+func (q *botQueue) estimate(now time.Time) time.Duration {
+	if q.remaining > 0 {
+		if left := q.remaining - now.Sub(q.updated); left > 0 {
+			return left
+		}
+		return 0
+	}
+	moved := q.firstPosition - q.position
+	if moved <= 0 {
+		return 0
+	}
+	perPosition := q.updated.Sub(q.first) / time.Duration(moved)
+	if left := perPosition*time.Duration(q.position) - now.Sub(q.updated); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// waited returns the time spent in the queue up to end, 0 if the bot
+// never queued the request.
+func (q *botQueue) waited(end time.Time) time.Duration {
+	if q.entered.IsZero() {
+		return 0
+	}
+	return end.Sub(q.entered)
+}
+
+// String renders e.g. "queued: position 4/20, est. 12 min".
+func (q *botQueue) String() string {
+	if q.position == 0 {
+		return i18n.T("botqueue.queued")
+	}
+	position := strconv.Itoa(q.position)
+	if q.total > 0 {
+		position += fmt.Sprintf("/%d", q.total)
+	}
+	if est := q.estimate(time.Now()); est > 0 {
+		return i18n.T("botqueue.position_estimate", position, formatEstimate(est))
+	}
+	return i18n.T("botqueue.position", position)
+}
+
+// formatEstimate renders a rough duration: "< 1 min", "12 min", "1h05".
+func formatEstimate(d time.Duration) string {
+	d = d.Round(time.Minute)
+	switch {
+	case d < time.Minute:
+		return i18n.T("duration.under_minute")
+	case d < time.Hour:
+		return i18n.T("duration.minutes", int(d/time.Minute))
+	}
+	return fmt.Sprintf("%dh%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
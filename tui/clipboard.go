@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/muesli/termenv"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/xdcc"
+)
+
+// copyToClipboard puts text in the system clipboard. Without one (e.g.
+// over SSH) the terminal is asked to do it with an OSC 52 sequence, which
+// most terminals support.
+func copyToClipboard(text string) {
+	if err := clipboard.WriteAll(text); err != nil {
+		termenv.Copy(text)
+	}
+}
+
+// requestCommand returns the IRC client command asking the bot for the
+// pack of file, e.g. "/msg Bot xdcc send #3".
+func (m *Model) requestCommand(file xdcc.IRCFile) string {
+	conf := m.config.TransferConfig(file, "", 0, time.Now())
+	req := xdcc.XdccSendReq{Slot: file.Slot, Bot: file.UserName, Template: conf.RequestTemplate}
+	target := file.UserName
+	if channels := file.Channels(); conf.RequestInChannel && len(channels) > 0 {
+		target = channels[0]
+	}
+	return fmt.Sprintf("/msg %s %s", target, req.String())
+}
+
+// copyFile copies the irc:// url of file, or with command set the
+// request to type in a regular IRC client.
+func (m *Model) copyFile(file xdcc.IRCFile, command bool) {
+	text := file.String()
+	if command {
+		text = m.requestCommand(file)
+	}
+	copyToClipboard(text)
+	m.status = i18n.T("clipboard.copied", text)
+}
@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+)
+
+// runCommand runs a line typed after ":", e.g. "download 3-7,9".
+func (m *Model) runCommand(line string) tea.Cmd {
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	args = strings.TrimSpace(args)
+
+	switch strings.ToLower(name) {
+	case "":
+		return nil
+	case "download", "d":
+		return m.downloadCommand(args)
+	case "filter", "f":
+		if !m.searchDone {
+			m.status = i18n.T("command.nothing_to_filter")
+			return nil
+		}
+		m.currentView = viewSearch
+		m.filterInput.SetValue(args)
+		m.applyFilter()
+	case "sort", "s":
+		for c := sortSize; c <= sortRelevance; c++ {
+			if strings.EqualFold(args, c.String()) {
+				m.sortBy = c
+				m.resort()
+				m.status = i18n.T("results.sorted_by", c.label())
+				return nil
+			}
+		}
+		m.status = i18n.T("command.unknown_sort", args)
+	case "limit":
+		m.limitCommand(args)
+	case "compact":
+		m.toggleCompact()
+	case "stats":
+		m.currentView = viewStats
+	case "quit", "q":
+		return m.requestQuit()
+	case "quit!", "q!":
+		return m.shutdown()
+	default:
+		if _, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(name), "p")); err == nil && args == "" {
+			m.currentView = viewSearch
+			m.jumpToInput(name)
+			return nil
+		}
+		m.status = i18n.T("command.unknown", name)
+	}
+	return nil
+}
+
+// downloadCommand queues the results numbered by args, counting from 1,
+// such as "3", "3-7" or "1,4-6".
+func (m *Model) downloadCommand(args string) tea.Cmd {
+	results := m.getCurrentResults()
+	if len(results) == 0 {
+		m.status = i18n.T("command.no_results")
+		return nil
+	}
+	indexes, err := parseRanges(args, len(results))
+	if err != nil {
+		m.status = i18n.T("command.download_failed", err)
+		return nil
+	}
+	files := make([]search.XdccFileInfo, 0, len(indexes))
+	for _, i := range indexes {
+		files = append(files, results[i])
+	}
+	return m.requestFiles(files)
+}
+
+// parseRanges parses a comma separated list of numbers and ranges of
+// numbers from 1 to max, returning 0-based indexes without duplicates.
+func parseRanges(s string, max int) ([]int, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, i18n.Errorf("command.expected_numbers")
+	}
+	seen := make(map[int]bool)
+	var indexes []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, i18n.Errorf("command.not_a_number", part)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+				return nil, i18n.Errorf("command.not_a_range", part)
+			}
+		}
+		if first > last {
+			first, last = last, first
+		}
+		if first < 1 || last > max {
+			return nil, i18n.Errorf("command.out_of_range", part, max)
+		}
+		for n := first; n <= last; n++ {
+			if !seen[n] {
+				seen[n] = true
+				indexes = append(indexes, n-1)
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// limitCommand changes the speed limit of the session, e.g. "500k" or
+// "2m"; a bare number is in KiB/s like rate_limit. "0" or "off" goes back
+// to the configured limit. The config file is left as is.
+func (m *Model) limitCommand(args string) {
+	if args == "" {
+		m.status = i18n.T("command.limit_expected")
+		return
+	}
+	if args == "0" || strings.EqualFold(args, "off") {
+		m.sessionLimit = false
+		m.limiter.SetRate(m.config.RateLimit())
+		if rate := m.config.RateLimit(); rate > 0 {
+			m.status = i18n.T("command.limit_configured", FormatSpeed(float64(rate)))
+			return
+		}
+		m.status = i18n.T("command.limit_removed")
+		return
+	}
+	speed := args
+	if _, err := strconv.ParseFloat(speed, 64); err == nil {
+		speed += "k"
+	}
+	rate, err := parseSizeFilter(speed)
+	if err != nil || rate <= 0 {
+		m.status = i18n.T("command.limit_invalid", args)
+		return
+	}
+	m.sessionLimit = true
+	m.limiter.SetRate(rate)
+	m.status = i18n.T("command.limit_set", FormatSpeed(float64(rate)))
+}
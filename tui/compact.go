@@ -0,0 +1,28 @@
+package tui
+
+import "xdcc-tui/i18n"
+
+// compactPageChrome is pageChrome in compact mode: the title shares its
+// line with the search input and the blank lines are gone.
+const compactPageChrome = 7
+
+// gap ends a block of a view: with a blank line, or just the line in
+// compact mode.
+func (m Model) gap() string {
+	if m.compact {
+		return "\n"
+	}
+	return "\n\n"
+}
+
+// toggleCompact switches the compact mode for the rest of the session.
+func (m *Model) toggleCompact() {
+	m.compact = !m.compact
+	// the page size changed, the cursor stays put.
+	m.page = m.cursor / m.pageSize()
+	if m.compact {
+		m.status = i18n.T("compact.on")
+		return
+	}
+	m.status = i18n.T("compact.off")
+}
@@ -0,0 +1,90 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"xdcc-tui/history"
+	"xdcc-tui/i18n"
+)
+
+const (
+	// maxErrorDetails bounds the lines of context kept with an error, the
+	// most recent ones.
+	maxErrorDetails = 12
+	errorPanelWidth = 100
+)
+
+var errorPanelStyle = lipgloss.NewStyle().
+	Border(lipgloss.RoundedBorder()).
+	BorderForeground(lipgloss.Color("203")).
+	Padding(0, 1).
+	Width(errorPanelWidth)
+
+// errorDetail is the last error, kept in full until the next one: the
+// status line only shows a line of it and is overwritten by any event.
+type errorDetail struct {
+	time    time.Time
+	subject string   // what failed, e.g. a file name
+	text    string   // the complete error
+	details []string // what led to it: bot notices, retries...
+	seen    bool     // the panel was opened since
+}
+
+// recordError keeps the error text as the last error, with the lines
+// explaining it, if any.
+func (m *Model) recordError(subject, text string, details []string) {
+	if len(details) > maxErrorDetails {
+		details = details[len(details)-maxErrorDetails:]
+	}
+	m.lastError = &errorDetail{time: time.Now(), subject: subject, text: text, details: details}
+}
+
+// logLines renders the event log of a download as error details.
+func logLines(log []history.LogEntry) []string {
+	lines := make([]string, 0, len(log))
+	for _, e := range log {
+		lines = append(lines, fmt.Sprintf("%s  %s", e.Time.Format("15:04:05"), e.Text))
+	}
+	return lines
+}
+
+// toggleErrorPanel expands or collapses the details of the last error.
+func (m *Model) toggleErrorPanel() {
+	if m.lastError == nil {
+		m.status = i18n.T("errors.none")
+		return
+	}
+	m.errorPanel = !m.errorPanel
+	m.lastError.seen = true
+}
+
+// errorHint tells about the details of an error not looked at yet.
+func (m Model) errorHint() string {
+	if m.lastError == nil || m.lastError.seen {
+		return ""
+	}
+	return i18n.T("errors.hint")
+}
+
+// errorPanelView renders the expanded error, empty when collapsed.
+func (m Model) errorPanelView() string {
+	if !m.errorPanel || m.lastError == nil {
+		return ""
+	}
+	e := m.lastError
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%s  %s\n", e.time.Format("15:04:05"), e.subject))
+	b.WriteString(pausedStyle.Render(e.text))
+	if len(e.details) > 0 {
+		b.WriteString("\n")
+		for _, d := range e.details {
+			b.WriteString("\n" + statusBarStyle.Render(d))
+		}
+	}
+	b.WriteString("\n\n" + statusBarStyle.Render(i18n.T("errors.help")))
+	return errorPanelStyle.Render(b.String()) + "\n"
+}
@@ -0,0 +1,59 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"xdcc-tui/config"
+	"xdcc-tui/search"
+)
+
+// fileTypeTag returns the category of the file name, shown in the Type
+// column of the results; empty if it has none.
+func (m Model) fileTypeTag(name string) string {
+	t, ok := config.FileTypeOf(m.fileTypes, name)
+	if !ok {
+		return ""
+	}
+	return t.Name
+}
+
+// colorFileTypes colors the Type column of the rendered rows of the
+// results table with the colors of the theme.
+func (m Model) colorFileTypes(table string, results []search.XdccFileInfo, selected int) string {
+	if m.plain {
+		return table
+	}
+	lines := strings.Split(table, "\n")
+	restore := strings.SplitN(cursorStyle.Render("x"), "x", 2)[0]
+	for i, res := range results {
+		// the header takes the first line.
+		if i+1 >= len(lines) {
+			break
+		}
+		t, ok := config.FileTypeOf(m.fileTypes, res.Name)
+		if !ok || t.Color == "" {
+			continue
+		}
+		// the tag comes right after the selection box, before any text
+		// that could contain it.
+		line := lines[i+1]
+		box := strings.Index(line, "]")
+		if box < 0 {
+			continue
+		}
+		pos := strings.Index(line[box:], t.Name)
+		if pos < 0 {
+			continue
+		}
+		pos += box
+		after := line[pos+len(t.Name):]
+		if i == selected {
+			after = restore + after
+		}
+		style := lipgloss.NewStyle().Foreground(lipgloss.Color(t.Color))
+		lines[i+1] = line[:pos] + style.Render(t.Name) + after
+	}
+	return strings.Join(lines, "\n")
+}
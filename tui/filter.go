@@ -0,0 +1,198 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/config"
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+)
+
+type filterKind int
+
+const (
+	filterText filterKind = iota // part of the name
+	filterExt                    // ".mkv"
+	filterSize                   // ">1GB", "<500MB"
+	filterType                   // "type:video", see config.FileType
+	filterBot                    // "bot:name", the nick of the bot
+)
+
+// filterTerm is one of the space separated conditions of a filter, all
+// of which a result must meet. "!" in front negates it.
+type filterTerm struct {
+	kind   filterKind
+	negate bool
+	text   string // lower case
+	size   int64
+	less   bool
+}
+
+// parseFilter parses a filter such as "type:video >1GB !hevc".
+func parseFilter(filter string, types []config.FileType) ([]filterTerm, error) {
+	var terms []filterTerm
+	for _, field := range strings.Fields(strings.ToLower(filter)) {
+		t := filterTerm{kind: filterText, text: field}
+		if strings.HasPrefix(field, "!") && len(field) > 1 {
+			t.negate, t.text = true, field[1:]
+		}
+		switch {
+		case t.text[0] == '>' || t.text[0] == '<':
+			size, err := parseSizeFilter(t.text[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", field, err)
+			}
+			t.kind, t.size, t.less = filterSize, size, t.text[0] == '<'
+		case t.text[0] == '.':
+			t.kind = filterExt
+		case strings.HasPrefix(t.text, "bot:"):
+			t.kind, t.text = filterBot, strings.TrimPrefix(t.text, "bot:")
+		case strings.HasPrefix(t.text, "type:"):
+			t.kind, t.text = filterType, strings.TrimPrefix(t.text, "type:")
+			if !knownFileType(types, t.text) {
+				return nil, i18n.Errorf("filter.unknown_type", t.text)
+			}
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+func knownFileType(types []config.FileType, name string) bool {
+	for _, t := range types {
+		if strings.EqualFold(t.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t filterTerm) matches(r search.XdccFileInfo, types []config.FileType) bool {
+	var ok bool
+	switch t.kind {
+	case filterSize:
+		ok = r.Size > t.size
+		if t.less {
+			ok = r.Size >= 0 && r.Size < t.size
+		}
+	case filterExt:
+		ok = strings.HasSuffix(strings.ToLower(r.Name), t.text)
+	case filterBot:
+		ok = strings.EqualFold(r.URL.UserName, t.text)
+	case filterType:
+		ft, found := config.FileTypeOf(types, r.Name)
+		ok = found && strings.EqualFold(ft.Name, t.text)
+	default:
+		ok = strings.Contains(strings.ToLower(r.Name), t.text)
+	}
+	return ok != t.negate
+}
+
+// matchesFilter reports whether r meets all the terms.
+func (m Model) matchesFilter(terms []filterTerm, r search.XdccFileInfo) bool {
+	for _, t := range terms {
+		if !t.matches(r, m.fileTypes) {
+			return false
+		}
+	}
+	return true
+}
+
+// moreFromBot filters the results down to the files of the bot of the
+// highlighted one, keeping it highlighted. "b" then fetches the full pack
+// list of the bot.
+func (m *Model) moreFromBot() {
+	results := m.getCurrentResults()
+	if m.cursor >= len(results) {
+		return
+	}
+	file := results[m.cursor]
+	m.filterInput.SetValue("bot:" + file.URL.UserName)
+	m.applyFilter()
+	for i, r := range m.filteredResults {
+		if r.URL == file.URL {
+			m.jumpTo(i)
+			break
+		}
+	}
+	m.status = i18n.T("results.more_from_bot", len(m.filteredResults), file.URL.UserName)
+}
+
+// selectMatching selects every result matching the filter, on all pages,
+// then clears the filter: the selection stays for queueing along with
+// the other results.
+func (m *Model) selectMatching() {
+	filter := strings.TrimSpace(m.filterInput.Value())
+	if filter == "" || len(m.filteredResults) == 0 {
+		m.status = i18n.T("filter.select_none")
+		return
+	}
+	for _, r := range m.filteredResults {
+		m.selected[r.URL] = struct{}{}
+	}
+	n := len(m.filteredResults)
+	m.filterInput.Reset()
+	m.filteredResults = nil
+	m.cursor = 0
+	m.page = 0
+	m.status = i18n.T("filter.selected", n, filter, len(m.selected))
+}
+
+// openPresetMenu shows the filter presets over the results.
+func (m *Model) openPresetMenu() {
+	m.presetMenu = true
+	if m.presetCursor >= len(m.config.Presets()) {
+		m.presetCursor = 0
+	}
+}
+
+// updatePresetMenu handles the keys of the filter presets menu: enter or
+// the number of a preset applies it, esc closes the menu.
+func (m *Model) updatePresetMenu(key string) tea.Cmd {
+	presets := m.config.Presets()
+	switch key {
+	case "up", "k":
+		if m.presetCursor > 0 {
+			m.presetCursor--
+		}
+	case "down", "j":
+		if m.presetCursor < len(presets)-1 {
+			m.presetCursor++
+		}
+	case "enter":
+		m.applyPreset(presets[m.presetCursor])
+	case "esc", "F":
+		m.presetMenu = false
+	default:
+		if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(presets) {
+			m.presetCursor = n - 1
+			m.applyPreset(presets[n-1])
+		}
+	}
+	return nil
+}
+
+func (m *Model) applyPreset(p config.FilterPreset) {
+	m.presetMenu = false
+	m.filterInput.SetValue(p.Filter)
+	m.applyFilter()
+}
+
+// presetMenuView lists the filter presets, numbered.
+func (m Model) presetMenuView() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(i18n.T("presets.header")) + "\n")
+	for i, p := range m.config.Presets() {
+		line := fmt.Sprintf("%d. %-20s %s", i+1, p.Name, p.Filter)
+		if i == m.presetCursor {
+			b.WriteString(cursorStyle.Render("> "+line) + "\n")
+			continue
+		}
+		b.WriteString("  " + line + "\n")
+	}
+	return b.String()
+}
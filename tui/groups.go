@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/xdcc"
+)
+
+// rowFile returns the pack of a row of the downloads view: the started
+// downloads of ids first, then the queue.
+func (m *Model) rowFile(ids []int, row int) xdcc.IRCFile {
+	if row < len(ids) {
+		return m.downloads[ids[row]].file.URL
+	}
+	return m.queue[row-len(ids)].URL
+}
+
+// rowBot returns the bot of a row, see xdcc.IRCFile.BotKey.
+func (m *Model) rowBot(ids []int, row int) string {
+	url := m.rowFile(ids, row)
+	return url.BotKey()
+}
+
+// rowOrder returns the rows of the downloads view in the order they are
+// shown. Rows keep their index (the one of downloadCursor) when grouped:
+// only the order changes, the bots in the order they first appear.
+func (m *Model) rowOrder() []int {
+	ids := m.downloadIDs()
+	rows := make([]int, len(ids)+len(m.queue))
+	for i := range rows {
+		rows[i] = i
+	}
+	if !m.groupDownloads {
+		return rows
+	}
+	first := make(map[string]int)
+	for _, row := range rows {
+		bot := m.rowBot(ids, row)
+		if _, ok := first[bot]; !ok {
+			first[bot] = row
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return first[m.rowBot(ids, rows[i])] < first[m.rowBot(ids, rows[j])]
+	})
+	return rows
+}
+
+// moveDownloadCursor moves the cursor delta rows down the downloads view,
+// in the order shown.
+func (m *Model) moveDownloadCursor(delta int) {
+	order := m.rowOrder()
+	if len(order) == 0 {
+		return
+	}
+	pos := 0
+	for i, row := range order {
+		if row == m.downloadCursor {
+			pos = i
+		}
+	}
+	pos += delta
+	if pos < 0 {
+		pos = 0
+	}
+	if pos >= len(order) {
+		pos = len(order) - 1
+	}
+	m.downloadCursor = order[pos]
+}
+
+// neighbourInQueue returns the index of the queued item to swap queue
+// item i with when moving it up (delta -1) or down: the next one, or the
+// next one of the same bot when grouped. -1 when there is none.
+func (m *Model) neighbourInQueue(i, delta int) int {
+	for j := i + delta; j >= 0 && j < len(m.queue); j += delta {
+		if !m.groupDownloads || m.queue[j].URL.BotKey() == m.queue[i].URL.BotKey() {
+			return j
+		}
+	}
+	return -1
+}
+
+// toggleGroups groups the rows of the downloads view by network and bot,
+// or lists them in the order they were queued.
+func (m *Model) toggleGroups() {
+	m.groupDownloads = !m.groupDownloads
+	if m.groupDownloads {
+		m.status = i18n.T("groups.on")
+		return
+	}
+	m.status = i18n.T("groups.off")
+}
+
+// downloadRows renders the rows of the downloads view, under a header per
+// bot when grouped.
+func (m Model) downloadRows() string {
+	ids := m.downloadIDs()
+	order := m.rowOrder()
+	var b strings.Builder
+	for i, row := range order {
+		if m.groupDownloads {
+			url := m.rowFile(ids, row)
+			if i == 0 || m.rowBot(ids, order[i-1]) != m.rowBot(ids, row) {
+				b.WriteString(headerStyle.Render(m.groupHeader(ids, order[i:], url)) + "\n")
+			}
+		}
+		if row < len(ids) {
+			b.WriteString(m.downloadLine(row, m.downloads[ids[row]]))
+			continue
+		}
+		b.WriteString(m.queueLine(row, m.queue[row-len(ids)]))
+	}
+	return b.String()
+}
+
+// groupHeader sums up the rows of the bot of url, the first of rows: how
+// many run, wait in the queue, completed and failed, and its backoff.
+func (m *Model) groupHeader(ids, rows []int, url xdcc.IRCFile) string {
+	var running, queued, done, failed int
+	for _, row := range rows {
+		if m.rowBot(ids, row) != url.BotKey() {
+			break
+		}
+		state := stateQueued
+		if row < len(ids) {
+			state = m.downloads[ids[row]].state
+		}
+		switch {
+		case state.active():
+			running++
+		case state == stateDone:
+			done++
+		case state == stateFailed:
+			failed++
+		default:
+			queued++
+		}
+	}
+	parts := []string{fmt.Sprintf("▼ %s / %s", url.Network, url.UserName)}
+	for _, p := range []struct {
+		n   int
+		key string
+	}{{running, "groups.running"}, {queued, "groups.queued"}, {done, "groups.done"}, {failed, "groups.failed"}} {
+		if p.n > 0 {
+			parts = append(parts, i18n.T(p.key, p.n))
+		}
+	}
+	if d := time.Until(m.botBackoff[url.BotKey()]); d > 0 {
+		parts = append(parts, i18n.T("downloads.bot_backoff", formatETA(d)))
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/history"
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+	"xdcc-tui/xdcc"
+)
+
+// historyProvider searches the completed downloads of the history, the
+// only source left in offline mode.
+type historyProvider struct {
+	store *history.Store
+}
+
+func (p historyProvider) Name() string {
+	return "history"
+}
+
+// Search returns the latest download of each file whose name contains
+// every keyword.
+func (p historyProvider) Search(keywords []string) ([]search.XdccFileInfo, error) {
+	entries := p.store.Entries()
+	seen := make(map[xdcc.IRCFile]bool)
+	results := make([]search.XdccFileInfo, 0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Status != history.StatusCompleted || !containsAll(e.Name, keywords) {
+			continue
+		}
+		url, err := xdcc.ParseURL(e.URL)
+		if err != nil || seen[*url] {
+			continue
+		}
+		seen[*url] = true
+		results = append(results, search.XdccFileInfo{URL: *url, Name: e.Name, Size: e.Size, Gets: -1})
+	}
+	return results, nil
+}
+
+// containsAll reports whether name contains each keyword, ignoring case.
+func containsAll(name string, keywords []string) bool {
+	name = strings.ToLower(name)
+	for _, k := range keywords {
+		if !strings.Contains(name, strings.ToLower(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// historyEntries returns the entries listed by the history view, newest
+// first, only those matching the search if there is one.
+func (m Model) historyEntries() []history.Entry {
+	all := m.history.Entries()
+	query := strings.ToLower(strings.TrimSpace(m.historyFilter.Value()))
+	entries := make([]history.Entry, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		e := all[i]
+		if query != "" && !strings.Contains(strings.ToLower(e.Name), query) &&
+			!strings.Contains(string(e.Status), query) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// historyLine renders an entry of the history view.
+func historyLine(e history.Entry) string {
+	mark := "✔"
+	if e.Status == history.StatusFailed {
+		mark = "✘"
+	}
+	speed := "--"
+	if s := e.Speed(); s > 0 {
+		speed = FormatSpeed(s)
+	}
+	return fmt.Sprintf("%s %s  %9s  %10s  %s", mark, e.Date.Format("2006-01-02 15:04"), FormatSize(e.Size), speed, historyName(e))
+}
+
+// historyName returns the name of a history entry, with its error when it
+// failed.
+func historyName(e history.Entry) string {
+	if e.Status == history.StatusFailed && e.Error != "" {
+		return e.Name + " – " + e.Error
+	}
+	return e.Name
+}
+
+// highlightedEntry returns the entry under the cursor of the history view.
+func (m Model) highlightedEntry() (history.Entry, bool) {
+	entries := m.historyEntries()
+	if m.historyCursor < 0 || m.historyCursor >= len(entries) {
+		return history.Entry{}, false
+	}
+	return entries[m.historyCursor], true
+}
+
+// updateHistoryView handles the keys of the history view. It reports
+// whether the key was used; the global ones (tab, q...) are not.
+func (m *Model) updateHistoryView(msg tea.KeyMsg) (tea.Cmd, bool) {
+	key := msg.String()
+	if m.historyFiltering {
+		switch key {
+		case "enter":
+			m.historyFiltering = false
+			m.historyFilter.Blur()
+		case "esc":
+			m.historyFiltering = false
+			m.historyFilter.Blur()
+			m.historyFilter.Reset()
+			m.historyCursor = 0
+		default:
+			var cmd tea.Cmd
+			m.historyFilter, cmd = m.historyFilter.Update(msg)
+			m.historyCursor = 0
+			return cmd, true
+		}
+		return nil, true
+	}
+
+	entries := m.historyEntries()
+	switch key {
+	case "up", "k":
+		if m.historyCursor > 0 {
+			m.historyCursor--
+		}
+	case "down", "j":
+		if m.historyCursor < len(entries)-1 {
+			m.historyCursor++
+		}
+	case "left", "h", "pgup":
+		m.historyCursor -= m.pageSize()
+		if m.historyCursor < 0 {
+			m.historyCursor = 0
+		}
+	case "right", "l", "pgdown":
+		m.historyCursor += m.pageSize()
+		if m.historyCursor >= len(entries) {
+			m.historyCursor = len(entries) - 1
+		}
+	case "home":
+		m.historyCursor = 0
+	case "end":
+		if len(entries) > 0 {
+			m.historyCursor = len(entries) - 1
+		}
+	case "/":
+		m.historyFiltering = true
+		return m.historyFilter.Focus(), true
+	case "esc":
+		m.historyFilter.Reset()
+		m.historyCursor = 0
+	case "enter", "R":
+		if e, ok := m.highlightedEntry(); ok {
+			m.requeueEntry(e)
+		}
+	case "v", "f":
+		if e, ok := m.highlightedEntry(); ok {
+			m.openPath(e.Name, e.Path, key == "f")
+		}
+	case "d":
+		if e, ok := m.highlightedEntry(); ok {
+			m.deleteEntry(e)
+		}
+	case "y", "Y":
+		if e, ok := m.highlightedEntry(); ok {
+			url, err := xdcc.ParseURL(e.URL)
+			if err != nil {
+				m.status = fmt.Sprintf("%s: %v", e.Name, err)
+				break
+			}
+			m.copyFile(*url, key == "Y")
+		}
+	case "tab", "q", "ctrl+c", "ctrl+o":
+		return nil, false
+	}
+	return nil, true
+}
+
+// deleteEntry removes the record of e from the history; the file itself
+// is left alone.
+func (m *Model) deleteEntry(e history.Entry) {
+	_, err := m.history.Remove(e)
+	m.indexHistory()
+	if err != nil {
+		m.status = i18n.T("history.save_failed", err)
+		return
+	}
+	m.status = i18n.T("history.removed", e.Name)
+	if n := len(m.historyEntries()); m.historyCursor >= n && n > 0 {
+		m.historyCursor = n - 1
+	}
+}
+
+// historyView renders the page of the history view around the cursor.
+func (m Model) historyView() string {
+	var b strings.Builder
+	entries := m.historyEntries()
+
+	if m.historyFiltering || m.historyFilter.Value() != "" {
+		b.WriteString(i18n.T("history.search", m.historyFilter.View()) + m.gap())
+	}
+	b.WriteString(headerStyle.Render(i18n.T("history.header",
+		len(entries))) + "\n")
+	if len(entries) == 0 {
+		b.WriteString("\n  " + i18n.T("history.none") + "\n")
+		return b.String()
+	}
+
+	size := m.pageSize()
+	start := m.historyCursor / size * size
+	end := start + size
+	if end > len(entries) {
+		end = len(entries)
+	}
+	for i := start; i < end; i++ {
+		line := historyLine(entries[i])
+		if m.width > 2 {
+			line = ellipsize(line, m.width-2)
+		}
+
+		prefix := "  "
+		style := rowEvenStyle
+		if i%2 == 1 {
+			style = rowOddStyle
+		}
+		if i == m.historyCursor {
+			prefix = "> "
+			style = cursorStyle
+		}
+		b.WriteString(style.Render(prefix+line) + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,264 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/util"
+)
+
+// keyMode is what the keys currently act on, see Model.keyMode.
+type keyMode int
+
+const (
+	modeSearchInput keyMode = iota // typing the query of a new search
+	modeResults
+	modeDownloads
+	modeHistory
+	modeStats
+	modeSettings
+	modeFilter  // typing a results filter
+	modePresets // the filter presets menu
+	modeEditing // a prompt, the history search or a setting being edited
+	modeConfirm // a yes/no question
+	modeLog
+	modePreview // the viewer of a text pack
+)
+
+// keyBinding is an entry of the key map shown in the footer: keys as
+// displayed, the catalog key of their help, the modes they work in and,
+// when set, whether they are of any use in the current state.
+type keyBinding struct {
+	keys   string
+	help   string
+	modes  []keyMode
+	usable func(m Model) bool
+}
+
+var (
+	browsing = []keyMode{modeSearchInput, modeResults, modeDownloads, modeHistory, modeStats, modeSettings}
+	searches = []keyMode{modeSearchInput, modeResults}
+)
+
+// keyMap lists the keys by mode, most useful first: the footer drops the
+// last ones when the terminal is too narrow.
+var keyMap = []keyBinding{
+	{"enter", "keys.search", []keyMode{modeSearchInput}, nil},
+	{"esc", "keys.quit", []keyMode{modeSearchInput}, nil},
+	{"↑", "keys.last_query", []keyMode{modeSearchInput}, func(m Model) bool { return m.lastQuery != "" && m.searchInput.Value() == "" }},
+
+	{"space", "keys.select", []keyMode{modeResults}, hasResults},
+	{"A", "keys.select_matching", []keyMode{modeResults}, func(m Model) bool { return len(m.filteredResults) > 0 }},
+	{"enter", "keys.download", []keyMode{modeResults}, hasResults},
+	{"/", "keys.filter", []keyMode{modeResults}, func(m Model) bool { return len(m.results) > 0 }},
+	{"F", "keys.presets", []keyMode{modeResults}, func(m Model) bool { return len(m.results) > 0 }},
+	{"o", "keys.order", []keyMode{modeResults}, hasResults},
+	{"s", "keys.sort", []keyMode{modeResults}, hasResults},
+	{"pgup/pgdn", "keys.page", []keyMode{modeResults}, func(m Model) bool { return len(m.getCurrentResults()) > m.pageSize() }},
+	{"S", "keys.season", []keyMode{modeResults}, highlightsEpisode},
+	{"m", "keys.more_from_bot", []keyMode{modeResults}, func(m Model) bool { return hasResults(m) && m.packList == nil }},
+	{"b", "keys.packs", []keyMode{modeResults}, func(m Model) bool { return hasResults(m) && m.packList == nil }},
+	{"esc", "keys.back", []keyMode{modeResults}, func(m Model) bool { return m.packList != nil }},
+	{"esc", "keys.new_search", []keyMode{modeResults}, func(m Model) bool { return m.packList == nil }},
+	{"e", "keys.edit_query", []keyMode{modeResults}, nil},
+	{"y/Y", "keys.copy", []keyMode{modeResults}, hasResults},
+	{"n", "keys.save_as", []keyMode{modeResults}, hasResults},
+	{"v", "keys.preview", []keyMode{modeResults}, highlightsText},
+
+	{"space", "keys.pause", []keyMode{modeDownloads}, func(m Model) bool { return m.highlightedQueued() >= 0 || m.highlightedActive() }},
+	{"P", "keys.pause_all", []keyMode{modeDownloads}, func(m Model) bool { return !m.paused && (len(m.downloads) > 0 || len(m.queue) > 0) }},
+	{"P", "keys.resume_all", []keyMode{modeDownloads}, func(m Model) bool { return m.paused }},
+	{"u", "keys.undo", []keyMode{modeDownloads}, func(m Model) bool { return len(m.undo) > 0 }},
+	{"p", "keys.priority", []keyMode{modeDownloads}, func(m Model) bool { return m.highlightedQueued() >= 0 }},
+	{"J/K", "keys.move", []keyMode{modeDownloads}, func(m Model) bool { return m.highlightedQueued() >= 0 && len(m.queue) > 1 }},
+	{"v/f", "keys.open", []keyMode{modeDownloads}, func(m Model) bool { return m.highlightedState(stateDone) }},
+	{"R", "keys.download_again", []keyMode{modeDownloads}, func(m Model) bool { return m.highlightedState(stateDone) || m.highlightedState(stateFailed) }},
+	{"r", "keys.retry_failed", []keyMode{modeDownloads}, func(m Model) bool { return m.hasState(stateFailed) }},
+	{"x", "keys.clear_failed", []keyMode{modeDownloads}, func(m Model) bool { return m.hasState(stateFailed) }},
+	{"c", "keys.clear_completed", []keyMode{modeDownloads}, func(m Model) bool { return m.hasState(stateDone) }},
+	{"d", "keys.remove", []keyMode{modeDownloads}, hasRows},
+	{"L", "keys.event_log", []keyMode{modeDownloads}, hasRows},
+	{"g", "keys.group", []keyMode{modeDownloads}, func(m Model) bool { return !m.groupDownloads && hasRows(m) }},
+	{"g", "keys.ungroup", []keyMode{modeDownloads}, func(m Model) bool { return m.groupDownloads }},
+
+	{"enter", "keys.download_again", []keyMode{modeHistory}, hasEntries},
+	{"/", "keys.search_history", []keyMode{modeHistory}, nil},
+	{"esc", "keys.clear_search", []keyMode{modeHistory}, func(m Model) bool { return m.historyFilter.Value() != "" }},
+	{"v/f", "keys.open", []keyMode{modeHistory}, hasEntries},
+	{"d", "keys.delete_record", []keyMode{modeHistory}, hasEntries},
+	{"y/Y", "keys.copy", []keyMode{modeHistory}, hasEntries},
+
+	{"enter", "keys.edit", []keyMode{modeSettings}, nil},
+
+	{"enter", "keys.apply", []keyMode{modeFilter}, nil},
+	{"esc", "keys.cancel", []keyMode{modeFilter}, nil},
+	{"enter/1-9", "keys.apply", []keyMode{modePresets}, nil},
+	{"esc", "keys.close", []keyMode{modePresets}, nil},
+	{"enter", "keys.confirm", []keyMode{modeEditing}, nil},
+	{"esc", "keys.cancel", []keyMode{modeEditing}, nil},
+	{"y", "keys.yes", []keyMode{modeConfirm}, nil},
+	{"n", "keys.no", []keyMode{modeConfirm}, nil},
+	{"↑/↓ pgup/pgdn", "keys.scroll", []keyMode{modeLog}, nil},
+	{"v", "keys.debug_entries", []keyMode{modeLog}, nil},
+	{"ctrl+l/esc", "keys.close", []keyMode{modeLog}, nil},
+	{"↑/↓ pgup/pgdn", "keys.scroll", []keyMode{modePreview}, func(m Model) bool { return len(m.preview.lines) > m.pageSize() }},
+	{"esc", "keys.close", []keyMode{modePreview}, nil},
+
+	{":", "keys.command", []keyMode{modeResults, modeDownloads}, nil},
+	{"tab", "keys.switch_view", browsing, nil},
+	{"ctrl+t", "keys.new_tab", searches, func(m Model) bool { return len(m.tabs) < maxTabs }},
+	{"1-9", "keys.switch_tab", []keyMode{modeResults}, func(m Model) bool { return len(m.tabs) > 1 }},
+	{"alt+1-9", "keys.switch_tab", []keyMode{modeSearchInput}, func(m Model) bool { return len(m.tabs) > 1 }},
+	{"ctrl+w", "keys.close_tab", searches, func(m Model) bool { return len(m.tabs) > 1 }},
+	{"ctrl+e", "keys.errors", browsing, func(m Model) bool { return m.lastError != nil && m.lastError.seen }},
+	{"ctrl+o", "keys.go_offline", browsing, func(m Model) bool { return !m.offline }},
+	{"ctrl+o", "keys.go_online", browsing, func(m Model) bool { return m.offline }},
+	{"q", "keys.quit", []keyMode{modeResults, modeDownloads, modeHistory, modeStats, modeSettings}, nil},
+	{"ctrl+l", "keys.log", browsing, nil},
+	{"ctrl+↑/↓", "keys.messages", browsing, func(m Model) bool { return len(m.pastMessages()) > m.stripLines() && m.stripLines() > 0 }},
+
+	// less used keys of the downloads view.
+	{"n", "keys.rename", []keyMode{modeDownloads}, func(m Model) bool { return m.highlightedQueued() >= 0 }},
+	{"o", "keys.destination", []keyMode{modeDownloads}, func(m Model) bool { return m.highlightedQueued() >= 0 }},
+	{"e", "keys.export", []keyMode{modeDownloads}, func(m Model) bool { return len(m.queue) > 0 }},
+	{"i", "keys.import", []keyMode{modeDownloads}, nil},
+	{"a", "keys.add_urls", []keyMode{modeDownloads}, nil},
+	{"H", "keys.from_history", []keyMode{modeDownloads}, nil},
+	{"Q", "keys.exit_when_done", []keyMode{modeDownloads}, nil},
+}
+
+func hasResults(m Model) bool {
+	return len(m.getCurrentResults()) > 0
+}
+
+func hasRows(m Model) bool {
+	return len(m.downloads)+len(m.queue) > 0
+}
+
+func hasEntries(m Model) bool {
+	return len(m.historyEntries()) > 0
+}
+
+func highlightsText(m Model) bool {
+	results := m.getCurrentResults()
+	return m.cursor < len(results) && previewable(results[m.cursor])
+}
+
+func highlightsEpisode(m Model) bool {
+	results := m.getCurrentResults()
+	if m.cursor >= len(results) {
+		return false
+	}
+	_, ok := util.ParseEpisode(results[m.cursor].Name)
+	return ok
+}
+
+// highlightedQueued returns the queue index of the highlighted row of the
+// downloads view, -1 when it is not a queued item.
+func (m Model) highlightedQueued() int {
+	i := m.downloadCursor - len(m.downloads)
+	if i < 0 || i >= len(m.queue) {
+		return -1
+	}
+	return i
+}
+
+func (m Model) highlightedActive() bool {
+	ds := m.highlightedDownload()
+	return ds != nil && ds.state.active()
+}
+
+func (m Model) highlightedState(s itemState) bool {
+	ds := m.highlightedDownload()
+	return ds != nil && ds.state == s
+}
+
+// hasState reports whether a started download is in state s.
+func (m Model) hasState(s itemState) bool {
+	for _, ds := range m.downloads {
+		if ds.state == s {
+			return true
+		}
+	}
+	return false
+}
+
+// keyMode returns what the keys act on, checked in the order update
+// hands the keys out.
+func (m Model) keyMode() keyMode {
+	switch {
+	case m.logPanel:
+		return modeLog
+	case m.preview != nil:
+		return modePreview
+	case m.confirm != nil || m.quitPrompt:
+		return modeConfirm
+	case m.pathPrompt != nil:
+		return modeEditing
+	case m.filterMode:
+		return modeFilter
+	case m.presetMenu:
+		return modePresets
+	}
+	switch m.currentView {
+	case viewHistory:
+		if m.historyFiltering {
+			return modeEditing
+		}
+		return modeHistory
+	case viewSettings:
+		if m.settingEdit != nil {
+			return modeEditing
+		}
+		return modeSettings
+	case viewDownloads:
+		return modeDownloads
+	case viewStats:
+		return modeStats
+	}
+	if m.searchDone {
+		return modeResults
+	}
+	return modeSearchInput
+}
+
+// keyHints renders the keys usable in the current mode and state as
+// "key: help" pairs, as many as fit in width (0 for no limit).
+func (m Model) keyHints(width int) string {
+	mode := m.keyMode()
+	sep := " · "
+	var b strings.Builder
+	for _, k := range keyMap {
+		if !k.applies(mode) || (k.usable != nil && !k.usable(m)) {
+			continue
+		}
+		hint := k.keys + ": " + i18n.T(k.help)
+		if b.Len() > 0 {
+			hint = sep + hint
+		}
+		if width > 0 && lipgloss.Width(b.String()+hint) > width {
+			break
+		}
+		b.WriteString(hint)
+	}
+	return b.String()
+}
+
+func (k keyBinding) applies(mode keyMode) bool {
+	for _, md := range k.modes {
+		if md == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// footerView renders the key hints line, none in compact mode.
+func (m Model) footerView() string {
+	if m.compact {
+		return ""
+	}
+	return "\n" + statusBarStyle.Render(m.keyHints(m.width))
+}
@@ -0,0 +1,354 @@
+package tui
+
+import (
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/xdcc"
+)
+
+// downloadManager owns the queue and runs the transfers outside of the
+// Bubble Tea loop. Its goroutine (run) keeps the queue, picks the items
+// to start and waits for the bot cooldowns, retry delays and quota reset
+// on its own; the model changes the queue with queue ops, tells it the
+// room left for transfers with setCapacity and gets back queueMsg
+// snapshots with the items to start. Each transfer gets a goroutine that
+// connects it and forwards its events. Everything reaches the model
+// through a single channel that listen bridges to Bubble Tea messages:
+// Update never waits for the manager nor the network.
+type downloadManager struct {
+	msgs chan tea.Msg
+	cmds chan func(*scheduler)
+	done chan struct{}
+
+	mtx     sync.Mutex
+	running map[int]chan struct{} // closed to stop forwarding events
+	closed  bool
+}
+
+// queueOp changes the queue. Ops run on the queue of the manager and on
+// the snapshot of the model, which shows their effect at once: they only
+// depend on the queue they are given and the values they captured, and
+// find items by url since the two queues differ by the items starting.
+type queueOp func([]queueItem) []queueItem
+
+// capacity is what the model tells the manager about the running
+// transfers, for it to pick the items to start.
+type capacity struct {
+	held      bool                 // offline, paused or session quota used up
+	until     time.Time            // nothing starts before, e.g. daily quota
+	free      int                  // transfer slots left
+	busy      map[string]bool      // bots with a running transfer
+	notBefore map[string]time.Time // when each bot may be asked again
+	ack       int                  // seq of the last queueMsg handled
+}
+
+// queueMsg is sent by the manager when the queue changed: a snapshot of
+// the queue and the items to start, which left it.
+type queueMsg struct {
+	queue   []queueItem
+	start   []queueItem
+	applied int // queue ops included in the snapshot
+	seq     int
+}
+
+// scheduler is the state of the manager goroutine.
+type scheduler struct {
+	queue    []queueItem
+	room     capacity
+	applied  int
+	seq      int
+	starting []startingItem // sent to the model, not acknowledged yet
+	changed  bool           // the model's snapshot is out of date
+	out      *queueMsg      // waiting to be sent
+	stopped  bool
+}
+
+// startingItem is an item to start sent in the queueMsg seq.
+type startingItem struct {
+	seq  int
+	item queueItem
+}
+
+func newDownloadManager(queue []queueItem) *downloadManager {
+	dm := &downloadManager{
+		msgs:    make(chan tea.Msg),
+		cmds:    make(chan func(*scheduler)),
+		done:    make(chan struct{}),
+		running: make(map[int]chan struct{}),
+	}
+	go dm.run(append([]queueItem(nil), queue...))
+	return dm
+}
+
+// run is the manager goroutine: it applies the commands of the model,
+// schedules after each of them and when the earliest wait elapsed, and
+// sends the pending queueMsg whenever the model listens.
+func (dm *downloadManager) run(queue []queueItem) {
+	s := &scheduler{queue: queue}
+	wake := time.NewTimer(time.Hour)
+	wake.Stop()
+	for {
+		var out chan tea.Msg
+		var msg tea.Msg
+		if s.out != nil {
+			out, msg = dm.msgs, *s.out
+		}
+		select {
+		case cmd := <-dm.cmds:
+			cmd(s)
+		case <-wake.C:
+		case out <- msg:
+			s.out = nil
+			continue
+		case <-dm.done:
+			return
+		}
+		if s.stopped {
+			continue
+		}
+		wait := s.schedule(time.Now())
+		if !wake.Stop() {
+			select {
+			case <-wake.C:
+			default:
+			}
+		}
+		if wait > 0 {
+			wake.Reset(wait)
+		}
+	}
+}
+
+// do runs cmd on the manager goroutine. It returns false once the
+// manager is closed.
+func (dm *downloadManager) do(cmd func(*scheduler)) bool {
+	select {
+	case dm.cmds <- cmd:
+		return true
+	case <-dm.done:
+		return false
+	}
+}
+
+// edit applies op to the queue of the manager.
+func (dm *downloadManager) edit(op queueOp) {
+	dm.do(func(s *scheduler) {
+		if s.stopped {
+			return
+		}
+		s.queue = op(s.queue)
+		s.applied++
+		s.changed = true
+	})
+}
+
+// setCapacity replaces the room for transfers, which schedules again.
+// The items the model acknowledged are in its running transfers from now
+// on.
+func (dm *downloadManager) setCapacity(c capacity) {
+	dm.do(func(s *scheduler) {
+		s.room = c
+		starting := s.starting[:0]
+		for _, st := range s.starting {
+			if st.seq > c.ack {
+				starting = append(starting, st)
+			}
+		}
+		s.starting = starting
+	})
+}
+
+// finish stops scheduling and returns the queue, the items the model
+// didn't start yet first, once the manager got to it.
+func (dm *downloadManager) finish() <-chan []queueItem {
+	final := make(chan []queueItem, 1)
+	ok := dm.do(func(s *scheduler) {
+		items := make([]queueItem, 0, len(s.starting)+len(s.queue))
+		for _, st := range s.starting {
+			items = append(items, st.item)
+		}
+		final <- append(items, s.queue...)
+		s.stopped = true
+	})
+	if !ok {
+		close(final)
+	}
+	return final
+}
+
+// schedule takes the items to start out of the queue, highest priority
+// first, while transfer slots remain, and updates the message for the
+// model. Bots get one request at a time. It returns how long until the
+// earliest item waiting for its bot, its retry delay or the quota may
+// start, 0 if none.
+func (s *scheduler) schedule(now time.Time) time.Duration {
+	starts, wait := s.pick(now)
+	if len(starts) == 0 && !s.changed {
+		return wait
+	}
+	s.seq++
+	for _, item := range starts {
+		s.starting = append(s.starting, startingItem{seq: s.seq, item: item})
+	}
+	if s.out != nil {
+		starts = append(s.out.start, starts...)
+	}
+	s.out = &queueMsg{
+		queue:   append([]queueItem(nil), s.queue...),
+		start:   starts,
+		applied: s.applied,
+		seq:     s.seq,
+	}
+	s.changed = false
+	return wait
+}
+
+func (s *scheduler) pick(now time.Time) ([]queueItem, time.Duration) {
+	if s.room.held {
+		return nil, 0
+	}
+	if now.Before(s.room.until) {
+		return nil, s.room.until.Sub(now)
+	}
+
+	var earliest time.Duration
+	asked := make(map[string]bool)
+	for _, st := range s.starting {
+		asked[st.item.URL.BotKey()] = true
+	}
+	ready := func(item queueItem) bool {
+		bot := item.URL.BotKey()
+		if asked[bot] || s.room.busy[bot] {
+			return false
+		}
+		d := s.room.notBefore[bot].Sub(now)
+		if r := item.retryAt.Sub(now); r > d {
+			d = r
+		}
+		if d > 0 {
+			if earliest == 0 || d < earliest {
+				earliest = d
+			}
+			return false
+		}
+		return true
+	}
+
+	var starts []queueItem
+	for len(starts) < s.room.free-len(s.starting) {
+		i := nextQueued(s.queue, ready)
+		if i < 0 {
+			break
+		}
+		starts = append(starts, s.queue[i])
+		asked[s.queue[i].URL.BotKey()] = true
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+	}
+	return starts, earliest
+}
+
+// listen waits for the next message of the manager. The model calls it
+// again after handling each one, so that a single listener is pending.
+func (dm *downloadManager) listen() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case msg := <-dm.msgs:
+			return msg
+		case <-dm.done:
+			return nil
+		}
+	}
+}
+
+func (dm *downloadManager) send(msg tea.Msg) bool {
+	select {
+	case dm.msgs <- msg:
+		return true
+	case <-dm.done:
+		return false
+	}
+}
+
+// start connects transfer and forwards its events as downloadEventMsg
+// tagged with id, followed by a final one with done set once the transfer
+// completed, failed or was rejected.
+func (dm *downloadManager) start(id int, transfer xdcc.Transfer) {
+	events := transfer.PollEvents()
+	quit := make(chan struct{})
+	dm.mtx.Lock()
+	dm.running[id] = quit
+	dm.mtx.Unlock()
+
+	go func() {
+		defer dm.forget(id)
+		defer transfer.Unsubscribe(events)
+
+		// connecting blocks until the server accepted us.
+		if err := transfer.Start(); err != nil {
+			dm.send(downloadEventMsg{id: id, err: err})
+			return
+		}
+		for {
+			select {
+			case evt := <-events:
+				if !dm.send(downloadEventMsg{id: id, evt: evt}) {
+					return
+				}
+				if transferEnded(evt) {
+					dm.send(downloadEventMsg{id: id, done: true})
+					return
+				}
+			case <-quit:
+				return
+			case <-dm.done:
+				return
+			}
+		}
+	}()
+}
+
+// transferEnded reports whether evt is the last event of a transfer.
+func transferEnded(evt xdcc.TransferEvent) bool {
+	switch evt.(type) {
+	case *xdcc.TransferCompletedEvent, *xdcc.TransferAbortedEvent, *xdcc.TransferRejectedEvent:
+		return true
+	}
+	return false
+}
+
+// stop stops the transfer of a download the model dropped (paused,
+// removed) and the forwarding of its events. The returned command does
+// the stopping, which waits for the DCC connection to close.
+func (dm *downloadManager) stop(id int, transfer xdcc.Transfer) tea.Cmd {
+	dm.forget(id)
+	return func() tea.Msg {
+		transfer.Stop()
+		return nil
+	}
+}
+
+func (dm *downloadManager) forget(id int) {
+	dm.mtx.Lock()
+	defer dm.mtx.Unlock()
+
+	if quit, ok := dm.running[id]; ok {
+		close(quit)
+		delete(dm.running, id)
+	}
+}
+
+// close stops the manager goroutine and the forwarding of messages;
+// transfers still running are left to the caller to stop.
+func (dm *downloadManager) close() {
+	dm.mtx.Lock()
+	defer dm.mtx.Unlock()
+
+	if dm.closed {
+		return
+	}
+	dm.closed = true
+	close(dm.done)
+}
@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"strings"
+	"time"
+
+	"xdcc-tui/i18n"
+)
+
+// maxMessages bounds the status messages kept for the message strip.
+const maxMessages = 100
+
+// statusMessage is a past status line, shown in the message strip.
+type statusMessage struct {
+	time time.Time
+	text string
+	err  bool // it came with an error, see recordError
+}
+
+// recordMessage keeps text for the message strip. A strip scrolled back
+// stays on the same messages.
+func (m *Model) recordMessage(text string, err bool) {
+	m.messages = append(m.messages, statusMessage{time: time.Now(), text: text, err: err})
+	if len(m.messages) > maxMessages {
+		m.messages = m.messages[len(m.messages)-maxMessages:]
+	}
+	if m.messageOffset > 0 {
+		m.messageOffset++
+	}
+	m.clampMessages()
+}
+
+// stripLines returns the number of lines of the message strip, none in
+// compact mode.
+func (m Model) stripLines() int {
+	if m.compact || m.config == nil {
+		return 0
+	}
+	return m.config.Messages()
+}
+
+// pastMessages returns the messages of the strip: all but the one still
+// on the status line.
+func (m Model) pastMessages() []statusMessage {
+	msgs := m.messages
+	if n := len(msgs); n > 0 && msgs[n-1].text == m.status {
+		msgs = msgs[:n-1]
+	}
+	return msgs
+}
+
+// scrollMessages moves the message strip delta messages back.
+func (m *Model) scrollMessages(delta int) {
+	m.messageOffset += delta
+	m.clampMessages()
+}
+
+func (m *Model) clampMessages() {
+	if max := len(m.pastMessages()) - m.stripLines(); m.messageOffset > max {
+		m.messageOffset = max
+	}
+	if m.messageOffset < 0 {
+		m.messageOffset = 0
+	}
+}
+
+// messageStripView renders the last messages above the status line, so
+// that an error isn't lost as soon as the next message comes.
+func (m Model) messageStripView() string {
+	lines := m.stripLines()
+	msgs := m.pastMessages()
+	if lines == 0 || len(msgs) == 0 {
+		return ""
+	}
+	end := len(msgs) - m.messageOffset
+	start := end - lines
+	if start < 0 {
+		start = 0
+	}
+	var b strings.Builder
+	for i, msg := range msgs[start:end] {
+		line := "  " + msg.time.Format("15:04:05") + " " + msg.text
+		if i == end-start-1 && m.messageOffset > 0 {
+			line += " " + i18n.T("messages.newer", m.messageOffset)
+		}
+		line = ellipsize(line, m.width)
+		if msg.err {
+			b.WriteString(pausedStyle.Render(line) + "\n")
+			continue
+		}
+		b.WriteString(statusBarStyle.Render(line) + "\n")
+	}
+	return b.String()
+}
@@ -1,17 +1,27 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/fluffle/goirc/logging"
 
+	"xdcc-tui/applog"
+	"xdcc-tui/config"
+	"xdcc-tui/history"
+	"xdcc-tui/i18n"
 	"xdcc-tui/search"
+	"xdcc-tui/util"
 	xdcc "xdcc-tui/xdcc"
 )
 
@@ -24,35 +34,80 @@ var (
 	headerStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("99")).Bold(true)
 	rowEvenStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("252"))
 	rowOddStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("250"))
+	pausedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true)
+	matchStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("0")).Background(lipgloss.Color("220"))
 )
 
 // Messages used with Bubble Tea ------------------------------------------------
 
 type searchResultsMsg struct {
-	results []search.XdccFileInfo
-	err     error
+	tab       int // id of the search tab
+	results   []search.XdccFileInfo
+	providers []search.ProviderStatus
+	err       error
 }
 
 type downloadEventMsg struct {
-	index int
-	evt   xdcc.TransferEvent
-	err   error
-	done  bool
+	id   int
+	evt  xdcc.TransferEvent
+	err  error
+	done bool
 }
 
 type errMsg struct{ error }
 
-// Model -----------------------------------------------------------------------
+// resumeQueueMsg starts the downloads restored from the previous session.
+type resumeQueueMsg struct{}
+
+// shutdownMsg ends the shutdown sequence, with what couldn't be saved.
+type shutdownMsg struct{ errs []error }
 
-// downloadState tracks simple progress data to show in the list.
-// We only keep transferred bytes and total for a text-based progress display.
+// Model -----------------------------------------------------------------------
 
+// downloadState tracks a started download: its state and simple progress
+// data for a text-based progress display.
 type downloadState struct {
+	file           search.XdccFileInfo
+	transfer       xdcc.Transfer
+	state          itemState
+	phase          transferPhase // before the first bytes, see phaseStatus
+	detail         string        // e.g. "retry 2"
+	reason         string        // why the transfer failed
 	bytesTotal     uint64
 	bytesCompleted uint64
-	completed      bool
+	suspect        bool   // received size differs from the announced one
+	path           string // where the completed file was written
 	speed          float64
-	ch             <-chan xdcc.TransferEvent
+	rateLimit      float64 // share of the speed limit, 0 if unlimited
+	eta            time.Duration
+	attempts       int // retries already made
+	alternates     []xdcc.IRCFile
+	outPath        string    // destination override, empty for the default
+	fileName       string    // name override, empty for the announced one
+	date           time.Time // fills {date} in filename templates
+	log            []history.LogEntry
+	started        time.Time // when the first bytes arrived
+	botQueue       botQueue  // position in the queue of the bot, if queued
+	rates          rateHistory
+}
+
+// queueItem returns the item to queue to run the download again.
+func (ds *downloadState) queueItem() queueItem {
+	return queueItem{XdccFileInfo: ds.file, Attempts: ds.attempts, Alternates: ds.alternates, OutPath: ds.outPath, FileName: ds.fileName, Date: ds.date, Log: ds.log}
+}
+
+// logf adds a line to the event log of the download.
+func (ds *downloadState) logf(format string, args ...interface{}) {
+	ds.log = history.AppendLog(ds.log, fmt.Sprintf(format, args...))
+}
+
+// setState moves the download to state; invalid transitions are ignored,
+// e.g. an IRC reconnection in the background while bytes flow.
+func (ds *downloadState) setState(state itemState, detail string) {
+	if ds.state.canMoveTo(state) {
+		ds.state = state
+		ds.detail = detail
+	}
 }
 
 type Model struct {
@@ -64,20 +119,118 @@ type Model struct {
 	results         []search.XdccFileInfo
 	filteredResults []search.XdccFileInfo
 	cursor          int
-	selected        map[int]struct{}
-	downloads       map[int]*downloadState
-
-	page int
+	selected        map[xdcc.IRCFile]struct{} // by url: filters and sorts keep it
+	sortBy          sortColumn
+	packList        *packList               // the results are the packs of a bot
+	providers       []search.ProviderStatus // of the last search
+
+	// search tabs, see saveTab
+	tabs      []searchTab
+	activeTab int
+	nextTabID int
+
+	// downloads are keyed by an id given when the transfer starts and
+	// never reused: events of a transfer removed or paused since then
+	// find no download and are dropped, whatever happened to the rows.
+	downloads      map[int]*downloadState
+	nextDownloadID int
+	queuePath      string
+
+	page          int
+	height, width int // of the terminal, 0 until known
 
 	// helpers
-	aggregator *search.ProviderAggregator
+	aggregator  *search.ProviderAggregator
+	offlineAggr *search.ProviderAggregator // searches the history, see historyProvider
+	config      *config.Config
+	fileTypes   []config.FileType // of the theme, to tag the results
+	connections *xdcc.ConnManager
+	manager     *downloadManager
+	limiter     *xdcc.RateLimiter
+	history     *history.Store
+	completed   map[string][]history.Entry // of the history by name, see indexHistory
+
+	// sessionLimit is set by :limit, whose speed then stays until cleared
+	// even when the setting changes.
+	sessionLimit bool
+
+	// shutdownErrs are the failures of the shutdown sequence, reported
+	// once the terminal is restored, see ShutdownErrors.
+	shutdownErrs []error
 
 	// ui feedback
-	status string
-	busy   bool
-
-	searchDone bool
-	filterMode bool
+	status       string
+	busy         bool
+	toasts       []toast     // notifications shown for a few seconds
+	toastTicking bool        // a toastTickMsg is pending
+	spinFrame    int         // frame of the spinner of connecting transfers
+	spinTicking  bool        // a spinTickMsg is pending
+	rates        rateHistory // combined throughput, see sampleRates
+	rateTicking  bool        // a rateTickMsg is pending
+	title        string      // of the terminal, see updateTitle
+	alert        string      // to raise after the update, see alertCmd
+
+	searchDone   bool
+	filterMode   bool
+	presetMenu   bool // the filter presets are shown, see updatePresetMenu
+	presetCursor int
+
+	// queue holds downloads waiting for one of the MaxConcurrent slots: the
+	// last snapshot of the manager, which owns it, with the unapplied ops
+	// on top. applied counts the ops the manager included, queueAck is the
+	// seq of the last queueMsg. offline disables all network activity; the
+	// queue is then held until the user goes back online.
+	queue      []queueItem
+	unapplied  []queueOp
+	applied    int
+	queueAck   int
+	offline    bool
+	paused     bool                 // no new transfers are started
+	botFreed   map[string]time.Time // when each bot's last transfer ended
+	botFails   map[string]int       // consecutive failures of each bot
+	botBackoff map[string]time.Time // until when failing bots are left alone
+	confirm    *confirmation
+	quitPrompt bool // quitting waits for the user to confirm, see requestQuit
+	pathPrompt *pathPrompt
+	preview    *preview         // text pack shown in the viewer, see openPreview
+	undo       [][]removedEntry // removals that u restores, latest last
+
+	// exitWhenDone quits once the queue drained; finished lists the
+	// downloads completed or failed during the session for the summary.
+	exitWhenDone bool
+	finished     []history.Entry
+	shuttingDown bool // once shutdown started, see shutdown
+
+	plain bool // ASCII only, without colors, see SetPlain
+	ascii bool // ASCII markers with colors, see SetASCII
+
+	compact bool // no blank lines and short headers, see toggleCompact
+
+	// data downloaded, checked against the quotas
+	sessionBytes   uint64
+	sessionStart   time.Time
+	daily          dailyUsage
+	downloadCursor int             // highlighted row of the downloads view
+	logPanel       bool            // the application log is shown, see updateLogPanel
+	logOffset      int             // lines scrolled up from the end of the log
+	logDebug       bool            // debug entries are shown in the log
+	lastQuery      string          // recalled by up in an empty search input
+	groupDownloads bool            // the downloads view is grouped by bot, see rowOrder
+	messages       []statusMessage // past status lines, see messageStripView
+	messageOffset  int             // messages scrolled back in the strip
+	showLog        bool            // the event log of the highlighted row is expanded
+	lastError      *errorDetail
+	errorPanel     bool // lastError is expanded, see errorPanelView
+
+	// history view, see updateHistoryView
+	historyCursor    int
+	historyFilter    textinput.Model
+	historyFiltering bool // keys go to historyFilter
+
+	// settings view, see updateSettingsView
+	settingsCursor int
+	settingEdit    *textinput.Model // the value being edited
+	configPath     string
 
 	currentView view
 }
@@ -87,40 +240,135 @@ type view int
 const (
 	viewSearch view = iota
 	viewDownloads
+	viewHistory
+	viewStats
+	viewSettings
 )
 
-const pageSize = 20
+const (
+	// defaultPageSize is used until the terminal told its height.
+	defaultPageSize = 20
+	minPageSize     = 5
+	// pageChrome is the number of lines of the search view around the
+	// results: title, tabs, search input, headers, status bars and key
+	// hints.
+	pageChrome = 15
+)
+
+// pageSize returns the number of results per page: the one of the
+// config, or as many as the terminal height allows.
+func (m Model) pageSize() int {
+	if m.config != nil && m.config.PageSize > 0 {
+		return m.config.PageSize
+	}
+	if m.height == 0 {
+		return defaultPageSize
+	}
+	chrome := pageChrome + m.stripLines()
+	if m.compact {
+		chrome = compactPageChrome
+	}
+	if n := m.height - chrome; n > minPageSize {
+		return n
+	}
+	return minPageSize
+}
 
-func NewModel() Model {
+func NewModel(cfg *config.Config) Model {
 	ti := textinput.New()
 	ti.Focus()
-	ti.Placeholder = "search keywords…"
+	ti.Placeholder = i18n.T("input.search_placeholder")
 	ti.CharLimit = 256
 	ti.Width = 40
 
 	fi := textinput.New()
-	fi.Placeholder = "filter results (e.g., .mp4, >1GB)"
+	fi.Placeholder = i18n.T("input.filter_placeholder")
 	fi.CharLimit = 100
 	fi.Width = 40
 
-	aggr := search.NewProviderAggregator(
-		&search.XdccEuProvider{},
-		&search.SunXdccProvider{},
-	)
+	aggr, err := search.NewAggregatorOf(cfg.Providers)
+	if err != nil {
+		applog.Warnf("providers: %v", err)
+		aggr, _ = search.NewAggregatorOf(nil)
+	}
+
+	hi := textinput.New()
+	hi.Placeholder = i18n.T("input.history_placeholder")
+	hi.CharLimit = 100
+	hi.Width = 40
+
+	m := Model{
+		searchInput:   ti,
+		filterInput:   fi,
+		historyFilter: hi,
+		tabs:          []searchTab{{}},
+		nextTabID:     1,
+		selected:      make(map[xdcc.IRCFile]struct{}),
+		downloads:     make(map[int]*downloadState),
+		botFreed:      make(map[string]time.Time),
+		botFails:      make(map[string]int),
+		botBackoff:    make(map[string]time.Time),
+		queuePath:     QueuePath(),
+		configPath:    config.DefaultPath(),
+		aggregator:    aggr,
+		config:        cfg,
+		fileTypes:     cfg.FileTypes(),
+		connections:   xdcc.NewConnManager(cfg.IdleTimeout()),
+		limiter:       xdcc.NewRateLimiter(cfg.RateLimit()),
+		status:        i18n.T("status.welcome"),
+		sessionStart:  time.Now(),
+	}
+
+	queue, err := loadQueue(m.queuePath)
+	if err != nil {
+		m.status = i18n.T("queue.restore_failed", err)
+	}
+	m.queue = queue
+	m.manager = newDownloadManager(queue)
+
+	if cfg.RestoreSession {
+		s, err := loadSession(sessionPath())
+		if err != nil {
+			m.status = i18n.T("session.restore_failed", err)
+		} else if m.restoreSession(s) {
+			m.status = m.sessionStatus()
+		}
+	}
+
+	m.daily, err = loadUsage(usagePath())
+	if err != nil {
+		m.status = i18n.T("quota.load_failed", err)
+	}
+
+	m.SetPlain(cfg.Plain || noColorRequested())
+	m.SetASCII(cfg.ASCII)
+	m.compact = cfg.Compact
+
+	// goirc logs connection problems; the terminal belongs to the TUI.
+	logging.SetLogger(applog.IRCLogger{Logger: applog.Default})
 
-	return Model{
-		searchInput: ti,
-		filterInput: fi,
-		selected:    make(map[int]struct{}),
-		downloads:   make(map[int]*downloadState),
-		aggregator:  aggr,
-		status:      "Enter keywords and press <enter> to search | Tab: switch view | /: filter",
+	m.history, err = history.Open(filepath.Join(config.Dir(), history.FileName))
+	if err != nil {
+		m.status = i18n.T("history.load_failed", err)
+		m.history = &history.Store{}
+	} else if _, err := m.history.Prune(cfg.HistoryRetention()); err != nil {
+		m.status = i18n.T("history.prune_failed", err)
 	}
+	m.indexHistory()
+	m.offlineAggr = search.NewProviderAggregator(historyProvider{m.history})
+	return m
 }
 
 // Init implements tea.Model
 func (m Model) Init() tea.Cmd {
-	return textinput.Blink
+	cmds := []tea.Cmd{textinput.Blink, m.manager.listen()}
+	if len(m.queue) > 0 {
+		cmds = append(cmds, func() tea.Msg { return resumeQueueMsg{} })
+	}
+	if dir := m.config.WatchDirectory(); dir != "" {
+		cmds = append(cmds, scanWatchDirCmd(dir))
+	}
+	return tea.Batch(cmds...)
 }
 
 // getCurrentResults returns the current results slice (filtered or unfiltered)
@@ -134,62 +382,62 @@ func (m *Model) getCurrentResults() []search.XdccFileInfo {
 	return m.results
 }
 
+// showResults shows the results of a search of the active tab.
+func (m *Model) showResults(msg searchResultsMsg) {
+	m.busy = false
+	m.searchDone = true
+	m.searchInput.Blur()
+	m.providers = msg.providers
+	// some providers failing still leaves the results of the others.
+	m.notifyProviderErrors(msg.err)
+	if msg.err != nil && len(msg.results) == 0 {
+		m.status = i18n.T("search.failed", msg.err)
+		return
+	}
+	// sort results by size descending for convenience
+	sortResults(msg.results, m.sortBy, m.searchInput.Value())
+	m.results = msg.results
+	m.packList = nil
+	m.filteredResults = nil
+	m.cursor = 0
+	m.page = 0
+	m.selected = make(map[xdcc.IRCFile]struct{})
+	m.status = i18n.T("search.found", len(msg.results))
+}
+
 func (m *Model) applyFilter() {
 	filter := strings.TrimSpace(m.filterInput.Value())
 	if filter == "" {
 		m.filteredResults = nil
 		m.cursor = 0
 		m.page = 0
-		m.status = "Filter cleared"
+		m.status = i18n.T("filter.cleared")
 		return
 	}
 
-	var filtered []search.XdccFileInfo
-
-	// Check for size filters (e.g., >1GB, <500MB)
-	if filter[0] == '>' || filter[0] == '<' {
-		// Parse size filter
-		compareFunc := func(a, b int64) bool { return a > b }
-		if filter[0] == '<' {
-			compareFunc = func(a, b int64) bool { return a < b }
-		}
+	terms, err := parseFilter(filter, m.fileTypes)
+	if err != nil {
+		m.status = i18n.T("filter.invalid", err)
+		return
+	}
 
-		size, err := parseSizeFilter(strings.TrimSpace(filter[1:]))
-		if err == nil {
-			for _, r := range m.results {
-				if compareFunc(r.Size, size) {
-					filtered = append(filtered, r)
-				}
-			}
-		}
-	} else if strings.HasPrefix(filter, ".") {
-		// File extension filter
-		ext := strings.ToLower(filter)
-		for _, r := range m.results {
-			if strings.HasSuffix(strings.ToLower(r.Name), ext) {
-				filtered = append(filtered, r)
-			}
-		}
-	} else {
-		// Simple filename filter (case insensitive)
-		filterLower := strings.ToLower(filter)
-		for _, r := range m.results {
-			if strings.Contains(strings.ToLower(r.Name), filterLower) {
-				filtered = append(filtered, r)
-			}
+	var filtered []search.XdccFileInfo
+	for _, r := range m.results {
+		if m.matchesFilter(terms, r) {
+			filtered = append(filtered, r)
 		}
 	}
 
 	m.filteredResults = filtered
 	m.cursor = 0
 	m.page = 0
-	m.status = fmt.Sprintf("Filter: %s (%d results)", filter, len(filtered))
+	m.status = i18n.T("filter.applied", filter, len(filtered))
 }
 
 func parseSizeFilter(s string) (int64, error) {
 	s = strings.TrimSpace(strings.ToLower(s))
 	if s == "" {
-		return 0, fmt.Errorf("empty size")
+		return 0, i18n.Errorf("size.empty")
 	}
 
 	// Find the numeric part
@@ -199,14 +447,14 @@ func parseSizeFilter(s string) (int64, error) {
 	}
 
 	if i == 0 {
-		return 0, fmt.Errorf("no number found")
+		return 0, i18n.Errorf("size.no_number")
 	}
 
 	// Parse the number
 	numberStr := s[:i]
 	size, err := strconv.ParseFloat(numberStr, 64)
 	if err != nil {
-		return 0, fmt.Errorf("invalid number: %v", err)
+		return 0, i18n.Errorf("size.invalid_number", err)
 	}
 
 	// If there's no unit, assume bytes
@@ -224,19 +472,163 @@ func parseSizeFilter(s string) (int64, error) {
 	case strings.HasPrefix(unit, "g"):
 		return int64(size * 1024 * 1024 * 1024), nil
 	default:
-		return 0, fmt.Errorf("unknown unit: %s", unit)
+		return 0, i18n.Errorf("size.unknown_unit", unit)
 	}
 }
 
 // Update implements tea.Model
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// the status line only shows the latest message: keep them all in
+	// the log.
+	if _, ok := msg.(toastTickMsg); ok {
+		if m.expireToasts(time.Now()) {
+			return m, toastTick()
+		}
+		m.toastTicking = false
+		return m, nil
+	}
+	if _, ok := msg.(spinTickMsg); ok {
+		m.spinFrame++
+		if m.spinning() {
+			return m, spinTick()
+		}
+		m.spinTicking = false
+		return m, nil
+	}
+	if t, ok := msg.(rateTickMsg); ok {
+		m.sampleRates(time.Time(t))
+		title := m.updateTitle()
+		if m.transferring() {
+			return m, tea.Batch(title, rateTick())
+		}
+		m.rateTicking = false
+		return m, title
+	}
+
+	status := m.status
+	next, cmd := m.route(msg)
+	nm, ok := next.(Model)
+	if !ok {
+		return next, cmd
+	}
+	if nm.status != status && nm.status != "" {
+		applog.Infof("%s", nm.status)
+		nm.recordMessage(nm.status, nm.lastError != m.lastError)
+	}
+	// expire the notifications once some are shown.
+	if len(nm.toasts) > 0 && !nm.toastTicking {
+		nm.toastTicking = true
+		cmd = tea.Batch(cmd, toastTick())
+	}
+	if !nm.spinTicking && nm.spinning() {
+		nm.spinTicking = true
+		cmd = tea.Batch(cmd, spinTick())
+	}
+	if nm.alert != "" {
+		cmd = tea.Batch(cmd, alertCmd(nm.alert))
+		nm.alert = ""
+	}
+	if !nm.rateTicking && nm.transferring() {
+		nm.rateTicking = true
+		nm.rates.at = time.Time{} // no sample over the idle time
+		cmd = tea.Batch(cmd, rateTick())
+	}
+	return nm, cmd
+}
+
+func (m Model) route(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg.(type) {
+	case tea.KeyMsg:
+		return m.update(msg)
+	case downloadEventMsg, queueMsg:
+		// wait for the next message of the manager.
+		next, cmd := m.updateFollowingCursor(msg)
+		if nm := next.(Model); nm.drained() {
+			cmd := nm.shutdown()
+			return nm, cmd
+		}
+		return next, tea.Batch(cmd, m.manager.listen())
+	}
+	return m.updateFollowingCursor(msg)
+}
+
+func (m Model) updateFollowingCursor(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// transfers starting and ending move rows of the downloads view
+	// around: keep the cursor on the same download.
+	file, ok := m.highlightedFile()
+	next, cmd := m.update(msg)
+	if ok {
+		nm := next.(Model)
+		nm.followFile(file)
+		next = nm
+	}
+	return next, cmd
+}
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		m.width = msg.Width
+		// the cursor stays put, on the page it now falls in.
+		m.page = m.cursor / m.pageSize()
+		return m, nil
 	case tea.KeyMsg:
+		if msg.String() == "ctrl+l" {
+			m.logPanel = !m.logPanel
+			m.logOffset = 0
+			return m, nil
+		}
+		if m.logPanel {
+			m.updateLogPanel(msg.String())
+			return m, nil
+		}
+		if msg.String() == "ctrl+e" {
+			m.toggleErrorPanel()
+			return m, nil
+		}
+		if msg.String() == "ctrl+g" {
+			m.toggleASCII()
+			return m, nil
+		}
+		switch msg.String() {
+		case "ctrl+up":
+			m.scrollMessages(1)
+			return m, nil
+		case "ctrl+down":
+			m.scrollMessages(-1)
+			return m, nil
+		}
+		if m.errorPanel && msg.String() == "esc" {
+			m.errorPanel = false
+			return m, nil
+		}
+		if m.preview != nil {
+			m.updatePreview(msg.String())
+			return m, nil
+		}
+
 		if m.busy {
-			// ignore key events while a search is running
+			// ignore key events while a search is running, but the ones
+			// going to another search tab.
+			if cmd, ok := m.updateTabs(msg.String()); ok {
+				return m, cmd
+			}
 			return m, nil
 		}
 
+		if m.confirm != nil {
+			return m, m.answerConfirm(msg.String())
+		}
+
+		if m.quitPrompt {
+			return m, m.answerQuit(msg.String())
+		}
+
+		if m.pathPrompt != nil {
+			return m, m.updatePathPrompt(msg)
+		}
+
 		if m.filterMode {
 			// Handle Enter key in filter mode
 			if msg.String() == "enter" {
@@ -249,7 +641,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "esc":
 				m.filterMode = false
 				m.filteredResults = nil
-				m.status = "Filter cleared"
+				m.status = i18n.T("filter.cleared")
 				m.cursor = 0
 				m.page = 0
 				return m, nil
@@ -257,7 +649,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.filterInput.Value() == "" {
 					m.filterMode = false
 					m.filteredResults = nil
-					m.status = "Filter cleared"
+					m.status = i18n.T("filter.cleared")
 					return m, nil
 				}
 			}
@@ -272,186 +664,412 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.applyFilter()
 			return m, cmd
 		}
+		if m.presetMenu {
+			return m, m.updatePresetMenu(msg.String())
+		}
+
+		if m.currentView == viewHistory {
+			if cmd, ok := m.updateHistoryView(msg); ok {
+				return m, cmd
+			}
+		}
+		if m.currentView == viewStats && !m.updateStatsView(msg.String()) {
+			return m, nil
+		}
+		if m.currentView == viewSettings {
+			if cmd, ok := m.updateSettingsView(msg); ok {
+				return m, cmd
+			}
+		}
+
+		if cmd, ok := m.updateTabs(msg.String()); ok {
+			return m, cmd
+		}
 
 		switch msg.String() {
 		case "tab":
-			if m.currentView == viewSearch {
+			switch m.currentView {
+			case viewSearch:
 				m.currentView = viewDownloads
-			} else {
+			case viewDownloads:
+				m.currentView = viewHistory
+			case viewHistory:
+				m.currentView = viewStats
+			case viewStats:
+				m.currentView = viewSettings
+			default:
 				m.currentView = viewSearch
 			}
 			return m, nil
 		case "ctrl+c", "q":
-			return m, tea.Quit
+			return m, m.requestQuit()
+		case "ctrl+o":
+			return m, m.toggleOffline()
+		case "p", "P", "J", "K", "e", "i", "a", "o", "n", "c", "x", "r", "R", "H", "u", "L", "Q", "v", "f":
+			if m.currentView == viewDownloads {
+				return m, m.updateDownloadsView(msg.String())
+			}
+			if msg.String() == "v" && m.currentView == viewSearch && m.searchDone {
+				return m, m.openPreview()
+			}
+			if msg.String() == "n" && m.currentView == viewSearch && m.searchDone {
+				m.renameResult()
+				return m, nil
+			}
+			if msg.String() == "e" && m.currentView == viewSearch && m.searchDone {
+				m.editQuery()
+				return m, nil
+			}
+			if msg.String() == "o" && m.currentView == viewSearch && m.searchDone {
+				m.sortBy = m.sortBy.nextOrder()
+				m.resort()
+				m.status = i18n.T("results.sorted_by", m.sortBy.label())
+				return m, nil
+			}
 		case "enter":
 			if !m.searchDone {
 				// start search
 				query := strings.TrimSpace(m.searchInput.Value())
 				if query == "" {
-					m.status = "please type something to search"
+					m.status = i18n.T("search.empty_query")
 					return m, nil
 				}
 				m.searchDone = true
+				m.lastQuery = query
 				m.results = nil
 				m.filteredResults = nil
 				m.cursor = 0
 				m.page = 0
 				m.busy = true
-				m.status = "searching…"
-				return m, tea.Batch(runSearchCmd(m.aggregator, strings.Split(query, " ")), textinput.Blink)
+				m.status = i18n.T("search.searching")
+				aggr := m.aggregator
+				if m.offline {
+					m.status = i18n.T("search.offline")
+					aggr = m.offlineAggr
+				}
+				return m, tea.Batch(runSearchCmd(aggr, m.tabs[m.activeTab].id, strings.Split(query, " ")), textinput.Blink)
 			}
 			// search already done -> treat Enter as download key
-			indices := m.indicesToDownload()
-			if len(indices) == 0 {
+			files := m.filesToDownload()
+			if len(files) == 0 {
 				return m, nil
 			}
-			return m, m.startDownloads(indices)
+			return m, m.requestFiles(files)
 		case "left", "h":
-			if m.currentView == viewSearch && m.cursor > 0 {
-				if m.cursor >= pageSize {
-					m.cursor -= pageSize
-				} else {
-					m.cursor = 0
-				}
-				m.page = m.cursor / pageSize
+			if m.currentView == viewSearch {
+				m.jumpTo(m.cursor - m.pageSize())
 			}
 		case "right", "l":
-			if m.currentView == viewSearch && m.cursor < len(m.results)-1 {
-				if m.cursor+pageSize < len(m.results) {
-					m.cursor += pageSize
-				} else {
-					m.cursor = len(m.results) - 1
-				}
-				m.page = m.cursor / pageSize
+			if m.currentView == viewSearch {
+				m.jumpTo(m.cursor + m.pageSize())
+			}
+		case "pgup", "pgdown", "home", "end":
+			if m.currentView == viewDownloads {
+				return m, m.updateDownloadsView(msg.String())
+			}
+			// home and end move the cursor of the search input until
+			// results show.
+			if m.currentView != viewSearch || !m.searchDone {
+				break
+			}
+			switch msg.String() {
+			case "pgup":
+				m.jumpTo(m.cursor - m.pageSize())
+			case "pgdown":
+				m.jumpTo(m.cursor + m.pageSize())
+			case "home":
+				m.jumpTo(0)
+			default:
+				m.jumpTo(len(m.getCurrentResults()) - 1)
 			}
+			return m, nil
 		case "/":
 			if m.currentView == viewSearch && m.searchDone && !m.filterMode {
 				m.filterMode = true
 				// Clear any existing filter text when starting a new filter
 				m.filterInput.Reset()
 				m.filterInput.Focus()
-				m.status = "Filter: " + m.filterInput.Value()
+				m.status = i18n.T("filter.typing", m.filterInput.Value())
 				// Return here to prevent the '/' from being added to the input
 				return m, nil
 			}
 		case "esc":
 			if m.filterMode {
 				m.filterMode = false
-				m.status = "Filter cleared | " + m.status
+				m.status = i18n.T("filter.cleared_status", m.status)
 				m.applyFilter()
+			} else if m.packList != nil {
+				m.closePackList()
 			} else if m.searchDone {
 				// Return to search input
 				m.searchDone = false
 				m.searchInput.Reset()
 				m.searchInput.Focus()
-				m.status = "Enter search query"
+				m.status = i18n.T("search.prompt")
 				m.results = nil
 				m.filteredResults = nil
 				m.cursor = 0
 				m.page = 0
+			} else {
+				return m, m.requestQuit()
 			}
 		case "up", "k":
+			if m.currentView == viewDownloads {
+				return m, m.updateDownloadsView(msg.String())
+			}
 			if m.currentView != viewSearch || m.filterMode {
 				break
 			}
-			if m.searchDone {
-				results := m.getCurrentResults()
-				if len(results) == 0 {
-					break
-				}
-				if m.cursor > 0 {
-					m.cursor--
-				}
-				if m.cursor < m.page*pageSize {
-					m.page--
+			if !m.searchDone {
+				// up recalls the last query into an empty input.
+				if msg.String() == "up" && m.searchInput.Value() == "" && m.lastQuery != "" {
+					m.searchInput.SetValue(m.lastQuery)
+					m.searchInput.CursorEnd()
+					return m, nil
 				}
+				break
 			}
+			if msg.String() == "up" && m.cursor == 0 && m.packList == nil {
+				m.editQuery()
+				return m, nil
+			}
+			m.jumpTo(m.cursor - 1)
 		case "down", "j":
+			if m.currentView == viewDownloads {
+				return m, m.updateDownloadsView(msg.String())
+			}
 			if m.currentView != viewSearch || m.filterMode {
 				break
 			}
+			m.jumpTo(m.cursor + 1)
+		case " ": // spacebar
+			if m.currentView == viewDownloads {
+				return m, m.updateDownloadsView(msg.String())
+			}
+			if m.currentView != viewSearch {
+				break
+			}
 			results := m.getCurrentResults()
-			if len(results) == 0 {
+			if m.cursor >= len(results) {
 				break
 			}
-			if m.cursor < len(results)-1 {
-				m.cursor++
+			url := results[m.cursor].URL
+			if _, ok := m.selected[url]; ok {
+				delete(m.selected, url)
+			} else {
+				m.selected[url] = struct{}{}
 			}
-			if m.cursor >= (m.page+1)*pageSize {
-				m.page++
+		case "d":
+			if m.currentView == viewDownloads {
+				return m, m.updateDownloadsView(msg.String())
 			}
-		case " ": // spacebar
 			if m.currentView != viewSearch {
 				break
 			}
-			if len(m.results) == 0 {
+			files := m.filesToDownload()
+			if len(files) == 0 {
 				break
 			}
-			if _, ok := m.selected[m.cursor]; ok {
-				delete(m.selected, m.cursor)
-			} else {
-				m.selected[m.cursor] = struct{}{}
+			return m, m.requestFiles(files)
+		case "S":
+			if m.currentView != viewSearch || !m.searchDone {
+				break
 			}
-		case "d":
-			if m.currentView != viewSearch {
+			return m, m.queueSeason()
+		case "F":
+			if m.currentView != viewSearch || !m.searchDone {
+				break
+			}
+			m.openPresetMenu()
+			return m, nil
+		case "s":
+			if m.currentView != viewSearch || !m.searchDone {
 				break
 			}
-			indices := m.indicesToDownload()
-			if len(indices) == 0 {
+			m.sortBy = m.sortBy.next()
+			m.resort()
+			m.status = i18n.T("results.sorted_by", m.sortBy.label())
+			return m, nil
+		case "y", "Y":
+			// y copies the url, Y the request command.
+			if m.currentView == viewDownloads {
+				if file, ok := m.highlightedFile(); ok {
+					m.copyFile(file, msg.String() == "Y")
+				}
+				return m, nil
+			}
+			if m.currentView != viewSearch || !m.searchDone {
 				break
 			}
-			return m, m.startDownloads(indices)
-		}
-	case searchResultsMsg:
-		m.busy = false
-		m.searchDone = true
-		m.searchInput.Blur()
-		if msg.err != nil {
-			m.status = fmt.Sprintf("search failed: %v", msg.err)
+			if results := m.getCurrentResults(); m.cursor < len(results) {
+				m.copyFile(results[m.cursor].URL, msg.String() == "Y")
+			}
+			return m, nil
+		case "b":
+			if m.currentView != viewSearch || !m.searchDone {
+				break
+			}
+			return m, m.openPackList()
+		case "A":
+			if m.currentView != viewSearch || !m.searchDone {
+				break
+			}
+			m.selectMatching()
+			return m, nil
+		case "m":
+			if m.currentView != viewSearch || !m.searchDone || m.packList != nil {
+				break
+			}
+			m.moreFromBot()
+			return m, nil
+		case "g", "G":
+			if msg.String() == "g" && m.currentView == viewDownloads {
+				return m, m.updateDownloadsView(msg.String())
+			}
+			if m.currentView != viewSearch || !m.searchDone {
+				break
+			}
+			if msg.String() == "g" {
+				m.jumpTo(0)
+			} else {
+				m.jumpTo(len(m.getCurrentResults()) - 1)
+			}
+			return m, nil
+		case ":":
+			// ":" is typed in the search input until results show.
+			if m.currentView == viewSearch && !m.searchDone {
+				break
+			}
+			m.openPathPrompt(promptCommand, "")
+			m.pathPrompt.input.Prompt = ":"
 			return m, nil
 		}
-		// sort results by size descending for convenience
-		sort.Slice(msg.results, func(i, j int) bool {
-			return msg.results[i].Size > msg.results[j].Size
-		})
-		m.results = msg.results
-		m.filteredResults = nil
-		m.cursor = 0
-		m.page = 0
-		m.selected = make(map[int]struct{})
-		m.status = fmt.Sprintf("found %d results | / to filter", len(msg.results))
+	case previewMsg:
+		m.showPreview(msg)
+		return m, nil
+	case packListMsg:
+		m.inTab(msg.tab, func() { m.showPackList(msg) })
+	case searchResultsMsg:
+		m.inTab(msg.tab, func() { m.showResults(msg) })
+		return m, nil
 	case downloadEventMsg:
-		if msg.err != nil {
-			m.status = fmt.Sprintf("download error: %v", msg.err)
+		ds, ok := m.downloads[msg.id]
+		if !ok {
 			return m, nil
 		}
-		ds, ok := m.downloads[msg.index]
-		if !ok {
+		if msg.err != nil {
+			m.downloadFailed(msg.id, ds, describeTransferError(msg.err), true)
 			return m, nil
 		}
 		if msg.done {
-			ds.completed = true
-			m.status = fmt.Sprintf("✔ %s completed", m.results[msg.index].Name)
+			// failures were handled with their event.
+			if ds.state == stateDone {
+				m.notify(i18n.T("notify.download_complete"), ds.file.Name)
+				m.downloadEnded(ds)
+			}
 			return m, nil
 		}
 		switch e := msg.evt.(type) {
+		case *xdcc.TransferResolvingEvent:
+			ds.setState(stateConnecting, "")
+			ds.phase = phaseResolving
+			ds.logf(i18n.T("log.resolving"), e.Host)
+		case *xdcc.TransferConnectingEvent:
+			ds.setState(stateConnecting, "")
+			ds.phase = phaseConnecting
+			ds.logf(i18n.T("log.connecting"), e.Server)
+		case *xdcc.TransferReconnectingEvent:
+			ds.setState(stateConnecting, i18n.T("download.retry_n", e.Attempt))
+			ds.phase = phaseConnecting
+			ds.logf(i18n.T("log.reconnecting"), e.Delay, e.Attempt)
+		case *xdcc.TransferRegisteringEvent:
+			ds.phase = phaseRegistering
+		case *xdcc.TransferRegisteredEvent:
+			ds.setState(stateConnecting, "")
+			ds.phase = phaseRegistering
+			ds.logf(i18n.T("log.registered"), e.Nick)
+		case *xdcc.TransferRequestedEvent:
+			ds.setState(stateConnecting, "")
+			ds.phase = phaseRequested
+			ds.logf(i18n.T("log.requested"), e.Slot, e.Bot)
+		case *xdcc.TransferQueuedEvent:
+			ds.setState(stateWaiting, "")
+			ds.phase = phaseBotQueue
+			ds.botQueue.update(e, time.Now())
+			ds.logf(i18n.T("log.queued_by_bot"), e.Message)
 		case *xdcc.TransferStartedEvent:
 			ds.bytesTotal = uint64(e.FileSize)
+			ds.started = time.Now()
+			ds.bytesCompleted = e.Offset
+			ds.rates = rateHistory{}
+			ds.setState(stateDownloading, "")
+			ds.logf(i18n.T("log.receiving"), e.FileName, FormatSize(int64(e.FileSize)))
 		case *xdcc.TransferProgessEvent:
-			ds.bytesCompleted += e.TransferBytes
-			ds.speed = float64(e.TransferRate)
+			m.sessionBytes += e.TransferBytes
+			m.daily.add(e.TransferBytes)
+			ds.bytesCompleted = e.BytesCompleted
+			ds.speed = e.SmoothedRate
+			ds.rateLimit = e.RateLimit
+			ds.eta = e.ETA
+		case *xdcc.TransferSizeMismatchEvent:
+			ds.suspect = true
+			ds.logf(i18n.T("log.size_mismatch"), e.Written, e.Announced, e.Expected)
+			m.status = i18n.T("download.size_mismatch", ds.file.Name,
+				FormatSize(int64(e.Written)), FormatSize(int64(e.Announced)))
 		case *xdcc.TransferCompletedEvent:
-			ds.completed = true
-			msg.done = true
-			m.status = fmt.Sprintf("✔ %s completed", m.results[msg.index].Name)
+			ds.setState(stateDone, "")
+			ds.path = e.Path
+			ds.logf(i18n.T("log.completed"), e.Path)
+			delete(m.botFails, ds.file.URL.BotKey())
+			m.recordHistory(ds)
+			if ds.suspect {
+				m.status = i18n.T("download.completed_mismatch", ds.file.Name)
+			} else {
+				m.status = i18n.T("download.completed", ds.file.Name)
+			}
+			m.alert = m.config.AlertOnComplete
+		case *xdcc.TransferRejectedEvent:
+			ds.logf(i18n.T("log.rejected"), e.Err)
+			retry := !errors.Is(e.Err, xdcc.ErrBanned) && !errors.Is(e.Err, xdcc.ErrInvalidPack)
+			m.downloadFailed(msg.id, ds, describeTransferError(e.Err), retry)
+			return m, nil
+		case *xdcc.TransferAbortedEvent:
+			m.downloadFailed(msg.id, ds, abortReason(e), true)
+			return m, nil
+		}
+		// the manager sends the next event, the last one with done set.
+		return m, nil
+	case queueMsg:
+		m.updateQueue(msg)
+		return m, nil
+	case watchTickMsg:
+		return m, scanWatchDirCmd(m.config.WatchDirectory())
+	case watchResultMsg:
+		if msg.jobs > 0 {
+			added := m.enqueue(msg.items)
+			m.status = i18n.T("watch.queued", added, msg.jobs)
 		}
-		// schedule next poll if not done
-		if !msg.done {
-			return m, pollDownloadCmd(msg.index, ds.ch)
+		if len(msg.errors) > 0 {
+			m.status = i18n.T("watch.failed", msg.errors[0])
+		}
+		m.schedule()
+		return m, watchTickCmd()
+	case resumeQueueMsg:
+		if m.offline || len(m.queue) == 0 {
+			return m, nil
 		}
+		n := len(m.queue)
+		m.schedule()
+		m.status = i18n.T("queue.resumed", n)
+		return m, nil
+	case shutdownMsg:
+		m.shutdownErrs = msg.errs
+		return m, tea.Quit
 	case errMsg:
 		m.busy = false
-		m.status = fmt.Sprintf("error: %v", msg)
+		applog.Errorf("%v", msg.error)
+		m.status = i18n.T("status.error", msg)
+		m.recordError(i18n.T("errors.subject"), msg.Error(), nil)
 	}
 
 	// let textinput update regardless of state so user can type again after search
@@ -464,197 +1082,1738 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
-// indicesToDownload returns selected indices or current cursor if none selected
-func (m Model) indicesToDownload() []int {
-	results := m.getCurrentResults()
-	if len(results) == 0 {
-		return nil
-	}
-	indices := make([]int, 0)
+// filesToDownload returns the selected results, or the highlighted one
+// if none is selected. Selected results hidden by the filter are kept.
+func (m Model) filesToDownload() []search.XdccFileInfo {
 	if len(m.selected) == 0 {
-		// If we're in filtered view, we need to map the filtered index back to the original results
-		if len(m.filteredResults) > 0 && m.cursor < len(m.filteredResults) {
-			// Find the index of the current filtered result in the original results
-			for i, r := range m.results {
-				if r.Name == m.filteredResults[m.cursor].Name && r.Size == m.filteredResults[m.cursor].Size {
-					indices = append(indices, i)
-					break
-				}
-			}
-		} else if m.cursor < len(m.results) {
-			indices = append(indices, m.cursor)
+		results := m.getCurrentResults()
+		if m.cursor >= len(results) {
+			return nil
 		}
-	} else {
-		for idx := range m.selected {
-			indices = append(indices, idx)
+		return []search.XdccFileInfo{results[m.cursor]}
+	}
+	files := make([]search.XdccFileInfo, 0, len(m.selected))
+	for _, res := range m.results {
+		if _, ok := m.selected[res.URL]; ok {
+			files = append(files, res)
 		}
 	}
-	return indices
+	return files
 }
 
-// helper to poll one event from channel
-func pollDownloadCmd(index int, ch <-chan xdcc.TransferEvent) tea.Cmd {
-	return func() tea.Msg {
-		evt, ok := <-ch
-		if !ok {
-			return downloadEventMsg{index: index, done: true}
+// toggleOffline switches offline mode and starts queued downloads when
+// going back online. Going offline suspends the running transfers, as
+// pausing all does, and then quits the IRC connections left idle.
+func (m *Model) toggleOffline() tea.Cmd {
+	m.offline = !m.offline
+	if m.offline {
+		m.status = i18n.T("offline.on")
+		m.schedule() // holds the queue before the transfers go back in
+		stops := m.suspendActive()
+		connections := m.connections
+		return func() tea.Msg {
+			wg := sync.WaitGroup{}
+			wg.Add(len(stops))
+			for _, stop := range stops {
+				go func(stop tea.Cmd) {
+					stop()
+					wg.Done()
+				}(stop)
+			}
+			wg.Wait()
+			connections.CloseIdle()
+			return nil
 		}
-		return downloadEventMsg{index: index, evt: evt}
 	}
+	m.status = i18n.T("offline.off")
+	m.schedule()
+	return nil
 }
 
-// startDownloads prepares downloadState and returns a Batch cmd
-func (m *Model) startDownloads(indices []int) tea.Cmd {
-	cmds := make([]tea.Cmd, 0, len(indices))
-	for _, idx := range indices {
-		file := m.results[idx]
-		transfer := xdcc.NewTransfer(xdcc.Config{File: file.URL})
-		// start connection (blocking until IRC connect attempt returns)
-		if err := transfer.Start(); err != nil {
-			cmds = append(cmds, func() tea.Msg { return downloadEventMsg{index: idx, err: err} })
-			continue
+// updateDownloadsView handles the keys of the downloads view: moving the
+// highlighted row, changing the priority of queued items and reordering
+// the queue. Space pauses or resumes the highlighted download, e and i
+// export and import the queue, a adds the urls listed in a file and o sets
+// the destination folder of the highlighted queued item. d removes the
+// highlighted row; c, x and r clear completed downloads, clear failed ones
+// and requeue failed ones; R downloads the highlighted finished row again and
+// H a file of the history. u undoes the last removal and L expands the
+// event log of the highlighted row. Q toggles exit-when-done mode and g
+// groups the rows by bot.
+func (m *Model) updateDownloadsView(key string) tea.Cmd {
+	rows := len(m.downloads) + len(m.queue)
+	switch key {
+	case "up", "k":
+		m.moveDownloadCursor(-1)
+	case "down", "j":
+		m.moveDownloadCursor(1)
+	case "pgup":
+		m.moveDownloadCursor(-m.pageSize())
+	case "pgdown":
+		m.moveDownloadCursor(m.pageSize())
+	case "home":
+		m.moveDownloadCursor(-rows)
+	case "end":
+		m.moveDownloadCursor(rows)
+	case "g":
+		m.toggleGroups()
+	case "p":
+		i := m.downloadCursor - len(m.downloads)
+		if i < 0 || i >= len(m.queue) {
+			m.status = i18n.T("queue.priority_not_queued")
+			return nil
 		}
-		ch := transfer.PollEvents()
-		m.downloads[idx] = &downloadState{bytesTotal: uint64(file.Size), ch: ch}
-		cmds = append(cmds, pollDownloadCmd(idx, ch))
+		m.editQueue(updateItem(m.queue[i].URL, func(item *queueItem) { item.Priority = item.Priority.next() }))
+		m.status = i18n.T("queue.priority_set", m.queue[i].Name, m.queue[i].Priority)
+	case " ":
+		return m.togglePause()
+	case "P":
+		return m.togglePauseAll()
+	case "e":
+		m.openPathPrompt(promptExport, defaultQueueExport)
+	case "i":
+		m.openPathPrompt(promptImport, defaultQueueExport)
+	case "a":
+		m.openPathPrompt(promptAddURLs, "")
+	case "d":
+		return m.removeRow()
+	case "c":
+		n := m.clearDownloads(func(ds *downloadState) bool { return ds.state == stateDone })
+		m.status = i18n.T("downloads.cleared_completed", n)
+	case "x":
+		n := m.clearDownloads(func(ds *downloadState) bool { return ds.state == stateFailed })
+		m.status = i18n.T("downloads.cleared_failed", n)
+	case "r":
+		return m.requeueFailed()
+	case "R":
+		return m.requeueRow()
+	case "H":
+		m.openPathPrompt(promptHistory, "")
+	case "u":
+		return m.undoRemoval()
+	case "v", "f":
+		// v opens the completed file, f shows it in its folder.
+		ds := m.highlightedDownload()
+		if ds == nil || ds.state != stateDone {
+			m.status = i18n.T("open.not_completed")
+			return nil
+		}
+		m.openPath(ds.file.Name, ds.path, key == "f")
+	case "L":
+		m.showLog = !m.showLog
+	case "Q":
+		m.exitWhenDone = !m.exitWhenDone
+		if !m.exitWhenDone {
+			m.status = i18n.T("exit_when_done.off")
+			return nil
+		}
+		m.status = i18n.T("exit_when_done.on")
+		if m.drained() {
+			return m.shutdown()
+		}
+	case "o":
+		i := m.downloadCursor - len(m.downloads)
+		if i < 0 || i >= len(m.queue) {
+			m.status = i18n.T("queue.destination_not_queued")
+			return nil
+		}
+		m.openPathPrompt(promptOutPath, m.queue[i].OutPath)
+		m.pathPrompt.target = m.queue[i].URL
+	case "n":
+		m.renameQueued()
+	case "K", "J":
+		i := m.downloadCursor - len(m.downloads)
+		if i < 0 || i >= len(m.queue) {
+			m.status = i18n.T("queue.move_not_queued")
+			return nil
+		}
+		delta := 1
+		if key == "K" {
+			delta = -1
+		}
+		j := m.neighbourInQueue(i, delta)
+		if j < 0 {
+			return nil
+		}
+		m.editQueue(swapItems(m.queue[i].URL, m.queue[j].URL))
+		m.downloadCursor += j - i
 	}
-	m.status = fmt.Sprintf("started %d download(s)", len(indices))
-
-	return tea.Batch(cmds...)
+	return nil
 }
 
-// View implements tea.Model
-func (m Model) View() string {
-	// Show filter input when in filter mode
-	if m.filterMode {
-		return fmt.Sprintf(
-			"Filter: %s\n\n%s",
-			m.filterInput.View(),
-			"(esc to cancel, enter to apply | e.g., .mp4, >1GB, <500MB)",
-		)
+// editQuery goes back to the search input with the query of the results,
+// the cursor at its end, to change it and search again.
+func (m *Model) editQuery() {
+	if m.packList != nil {
+		m.closePackList()
 	}
+	m.searchDone = false
+	m.searchInput.Focus()
+	m.searchInput.CursorEnd()
+	m.status = i18n.T("search.edit")
+	m.results = nil
+	m.filteredResults = nil
+	m.cursor = 0
+	m.page = 0
+}
 
-	var b strings.Builder
-
-	// Show search input when no search has been performed yet
-	if !m.searchDone {
-		return fmt.Sprintf(
-			"%s\n\n%s\n\n%s",
-			titleStyle.Render("XDCC-TUI"),
-			m.searchInput.View(),
-			"(press Enter to search, Esc to exit)",
-		)
+// requestFiles queues files chosen by the user, asking first if the batch
+// is large or if some of them were already downloaded.
+func (m *Model) requestFiles(files []search.XdccFileInfo) tea.Cmd {
+	if m.largeBatch(files) {
+		m.confirm = &confirmation{files: files, batch: m.batchSummary(files)}
+		return nil
 	}
+	return m.requestNewFiles(files)
+}
 
-	b.WriteString(titleStyle.Render("XDCC-TUI") + "\n\n")
-	if m.currentView == viewSearch {
-		b.WriteString(m.searchInput.View() + "\n\n")
-
-		// Get the current results (filtered or unfiltered)
-		results := m.getCurrentResults()
+// requestNewFiles queues files, asking first if some of them were already
+// downloaded.
+func (m *Model) requestNewFiles(files []search.XdccFileInfo) tea.Cmd {
+	if dups := m.findDuplicates(files); len(dups) > 0 {
+		m.confirm = &confirmation{files: files, duplicates: dups}
+		return nil
+	}
+	return m.startFiles(files)
+}
 
-		// header
-		b.WriteString(headerStyle.Render(fmt.Sprintf("Page %d/%d | %-2s %-3s %-40s %8s %s",
-			m.page+1,
-			(len(results)+pageSize-1)/pageSize, // total pages
-			"", "", "Name", "Size", "Pack")) + "\n")
+// queueSeason queues every episode of the season of the highlighted
+// result found in the current results, one file per episode: the same bot
+// and resolution as the highlighted one are preferred.
+func (m *Model) queueSeason() tea.Cmd {
+	results := m.getCurrentResults()
+	if m.cursor >= len(results) {
+		return nil
+	}
+	cur := results[m.cursor]
+	ep, ok := util.ParseEpisode(cur.Name)
+	if !ok {
+		m.status = i18n.T("season.not_episode")
+		return nil
+	}
 
-		// results list
-		start := m.page * pageSize
-		end := start + pageSize
-		if end > len(results) {
-			end = len(results)
+	score := func(f search.XdccFileInfo, e util.Episode) int {
+		n := 0
+		if f.URL.BotKey() == cur.URL.BotKey() {
+			n += 4
 		}
-
-		// Show message if no results
-		if len(results) == 0 {
-			b.WriteString("\n  No results found")
+		if e.Resolution == ep.Resolution {
+			n += 2
 		}
+		if strings.EqualFold(f.URL.Network, cur.URL.Network) {
+			n++
+		}
+		return n
+	}
 
-		for i := start; i < end; i++ {
-			res := results[i]
+	best := make(map[int]search.XdccFileInfo)
+	bestScore := make(map[int]int)
+	for _, r := range results {
+		e, ok := util.ParseEpisode(r.Name)
+		if !ok || !e.SameSeason(ep) {
+			continue
+		}
+		if _, seen := best[e.Number]; !seen || score(r, e) > bestScore[e.Number] {
+			best[e.Number] = r
+			bestScore[e.Number] = score(r, e)
+		}
+	}
 
-			cursor := "  "
-			if i == m.cursor {
-				cursor = cursorStyle.Render("> ")
-			}
-			sel := ""
-			if _, ok := m.selected[i]; ok {
-				sel = selectedStyle.Render("[x] ")
-			} else {
-				sel = "[ ] "
-			}
-			sizeStr := FormatSize(res.Size)
-			ext := filepath.Ext(res.Name)
-			nameWithoutExt := strings.TrimSuffix(res.Name, ext)
-			var nameDisplay string
-			if m.filterInput.Value() != "" && strings.HasPrefix(m.filterInput.Value(), ".") {
-				nameDisplay = fmt.Sprintf("%s%s",
-					nameWithoutExt,
-					lipgloss.NewStyle().Foreground(lipgloss.Color("#FFD700")).Render(ext))
-			} else {
-				nameDisplay = res.Name
-			}
+	numbers := make([]int, 0, len(best))
+	for n := range best {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	files := make([]search.XdccFileInfo, 0, len(numbers))
+	for _, n := range numbers {
+		files = append(files, best[n])
+	}
+	m.status = i18n.T("season.queued", ep.Show, ep.Season, len(files))
+	return m.requestFiles(files)
+}
+
+// alternatesFor returns the other bots offering file in the current
+// results, bots on the same network first.
+func (m *Model) alternatesFor(file search.XdccFileInfo) []xdcc.IRCFile {
+	seen := map[string]bool{file.URL.BotKey(): true}
+	same := make([]xdcc.IRCFile, 0)
+	other := make([]xdcc.IRCFile, 0)
+	for _, r := range m.results {
+		bot := r.URL.BotKey()
+		if seen[bot] || !strings.EqualFold(r.Name, file.Name) || !history.SimilarSize(r.Size, file.Size) {
+			continue
+		}
+		seen[bot] = true
+		if strings.EqualFold(r.URL.Network, file.URL.Network) {
+			same = append(same, r.URL)
+		} else {
+			other = append(other, r.URL)
+		}
+	}
+	return append(same, other...)
+}
+
+// confirmation asks whether to queue a large batch of files, or files
+// that were already downloaded.
+type confirmation struct {
+	files      []search.XdccFileInfo
+	batch      string            // summary of a large batch, see batchSummary
+	duplicates map[string]string // file name -> where it was found
+}
+
+func (c *confirmation) prompt() string {
+	if c.batch != "" {
+		return c.batch
+	}
+	for _, file := range c.files {
+		name := file.Name
+		found, ok := c.duplicates[name]
+		if !ok {
+			continue
+		}
+		if len(c.duplicates) == 1 {
+			return i18n.T("confirm.duplicate", name, found)
+		}
+		return i18n.T("confirm.duplicates",
+			len(c.duplicates), name, found)
+	}
+	return ""
+}
 
-			// Show a simple server identifier
-			serverInfo := ""
-			if len(results) > 0 {
-				serverInfo = fmt.Sprintf("Server %d", res.Slot%10) // Simple hash-like identifier
+// answerConfirm queues everything on "y", only the new files otherwise.
+// A large batch is queued on "y" only, then checked for duplicates.
+func (m *Model) answerConfirm(key string) tea.Cmd {
+	c := m.confirm
+	if c.batch != "" {
+		switch key {
+		case "y", "Y":
+			m.confirm = nil
+			return m.requestNewFiles(c.files)
+		case "n", "N", "esc":
+			m.confirm = nil
+			m.status = i18n.T("confirm.nothing_queued")
+		}
+		return nil
+	}
+	switch key {
+	case "y", "Y":
+		m.confirm = nil
+		return m.startFiles(c.files)
+	case "n", "N", "esc":
+		m.confirm = nil
+		files := make([]search.XdccFileInfo, 0, len(c.files))
+		for _, file := range c.files {
+			if _, dup := c.duplicates[file.Name]; !dup {
+				files = append(files, file)
 			}
+		}
+		if len(files) == 0 {
+			m.status = i18n.T("confirm.nothing_queued")
+			return nil
+		}
+		return m.startFiles(files)
+	}
+	return nil
+}
 
-			fileInfo := fmt.Sprintf("%s (%s) - %s",
-				nameDisplay,
-				FormatSize(res.Size),
-				serverInfo,
-			)
-			line := fmt.Sprintf("%s%s%-40.40s %8s %s", cursor, sel, fileInfo, sizeStr, res.URL.String())
-			// alternating row style for readability
-			if i%2 == 0 {
-				line = rowEvenStyle.Render(line)
-			} else {
-				line = rowOddStyle.Render(line)
+// findDuplicates looks for files already present in the download
+// directory or completed according to the history.
+func (m *Model) findDuplicates(files []search.XdccFileInfo) map[string]string {
+	dups := make(map[string]string)
+	for _, file := range files {
+		if e, ok := m.history.FindCompleted(file.Name, file.Size); ok {
+			dups[file.Name] = i18n.T("confirm.downloaded_on", e.Date.Format("2006-01-02"))
+			continue
+		}
+		path := m.config.FilePath(file.URL, xdcc.SanitizeFileName(file.Name), time.Now())
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() && history.SimilarSize(info.Size(), file.Size) {
+			dups[file.Name] = i18n.T("confirm.already_in", filepath.Dir(path))
+		}
+	}
+	return dups
+}
+
+// defaultQueueExport is the file proposed when exporting or importing.
+const defaultQueueExport = "xdcc-queue.json"
+
+type promptAction int
+
+const (
+	promptExport promptAction = iota
+	promptImport
+	promptAddURLs
+	promptOutPath
+	promptHistory
+	promptCommand
+	promptRename
+)
+
+func (a promptAction) String() string {
+	switch a {
+	case promptExport:
+		return i18n.T("prompt.export")
+	case promptImport:
+		return i18n.T("prompt.import")
+	case promptOutPath:
+		return i18n.T("prompt.destination")
+	case promptHistory:
+		return i18n.T("prompt.history")
+	case promptCommand:
+		return i18n.T("prompt.command")
+	case promptRename:
+		return i18n.T("prompt.rename")
+	default:
+		return i18n.T("prompt.add_urls")
+	}
+}
+
+// pathPrompt asks for the file used by a queue action, or the folder or
+// the name of the queued download target. file is the result renamed
+// before it is queued.
+type pathPrompt struct {
+	action promptAction
+	input  textinput.Model
+	target xdcc.IRCFile
+	file   search.XdccFileInfo
+}
+
+func (m *Model) openPathPrompt(action promptAction, value string) {
+	input := textinput.New()
+	input.SetValue(value)
+	input.CursorEnd()
+	input.Width = 40
+	input.Focus()
+	m.pathPrompt = &pathPrompt{action: action, input: input}
+}
+
+// updatePathPrompt edits the path and runs the export/import on enter.
+func (m *Model) updatePathPrompt(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.pathPrompt = nil
+		return nil
+	case "enter":
+		prompt := m.pathPrompt
+		path := strings.TrimSpace(prompt.input.Value())
+		if prompt.action == promptRename {
+			if validateFileName(path) != nil {
+				return nil // the error shows under the input
 			}
-			if _, ok := m.selected[i]; ok {
-				line = selectedStyle.Render(line)
+			m.pathPrompt = nil
+			m.setFileName(prompt.target, prompt.file, path)
+			return nil
+		}
+		m.pathPrompt = nil
+		if prompt.action == promptOutPath {
+			m.setOutPath(prompt.target, path)
+			return nil
+		}
+		if path == "" {
+			return nil
+		}
+		switch prompt.action {
+		case promptExport:
+			m.exportQueue(path)
+			return nil
+		case promptImport:
+			return m.importQueue(path)
+		case promptHistory:
+			return m.requeueFromHistory(path)
+		case promptCommand:
+			return m.runCommand(path)
+		default:
+			return m.addURLs(path)
+		}
+	}
+	var cmd tea.Cmd
+	m.pathPrompt.input, cmd = m.pathPrompt.input.Update(msg)
+	return cmd
+}
+
+// setOutPath overrides the destination folder of a queued download.
+func (m *Model) setOutPath(target xdcc.IRCFile, path string) {
+	i := queueIndex(m.queue, target)
+	if i < 0 {
+		return
+	}
+	m.editQueue(updateItem(target, func(item *queueItem) { item.OutPath = path }))
+	if path == "" {
+		m.status = i18n.T("queue.destination_default", m.queue[i].Name)
+	} else {
+		m.status = i18n.T("queue.destination_set", m.queue[i].Name, path)
+	}
+}
+
+// exportQueue writes the running and queued downloads to path.
+func (m *Model) exportQueue(path string) {
+	items := m.pendingItems()
+	if err := writeQueue(path, items); err != nil {
+		m.status = i18n.T("queue.export_failed", err)
+		return
+	}
+	m.status = i18n.T("queue.exported", len(items), path)
+}
+
+// importQueue adds the downloads of the queue file at path.
+func (m *Model) importQueue(path string) tea.Cmd {
+	if _, err := os.Stat(path); err != nil {
+		m.status = i18n.T("queue.import_failed", err)
+		return nil
+	}
+	items, err := loadQueue(path)
+	if err != nil {
+		m.status = i18n.T("queue.import_failed", err)
+		return nil
+	}
+	added := m.enqueue(items)
+	m.status = i18n.T("queue.imported", added, path)
+	m.schedule()
+	return nil
+}
+
+// requeueFromHistory queues the file last downloaded as name again, to
+// the folder it was saved to.
+func (m *Model) requeueFromHistory(name string) tea.Cmd {
+	e, ok := m.history.Latest(name)
+	if !ok {
+		m.status = i18n.T("history.not_found", name)
+		return nil
+	}
+	m.requeueEntry(e)
+	return nil
+}
+
+// requeueEntry queues the download recorded by e again.
+func (m *Model) requeueEntry(e history.Entry) {
+	item, err := itemFromHistory(e)
+	if err != nil {
+		m.status = i18n.T("queue.requeue_failed", e.Name, err)
+		return
+	}
+	if m.enqueue([]queueItem{item}) == 0 {
+		m.status = i18n.T("queue.already_queued", e.Name)
+		return
+	}
+	m.status = i18n.T("queue.queued_again", e.Name)
+	m.schedule()
+}
+
+// addURLs queues the urls listed in the file at path.
+func (m *Model) addURLs(path string) tea.Cmd {
+	items, invalid, err := readURLList(path)
+	if err != nil {
+		m.status = i18n.T("queue.url_list_failed", err)
+		return nil
+	}
+	added := m.enqueue(items)
+	m.status = i18n.T("queue.urls_added", added, len(items)-added)
+	if len(invalid) > 0 {
+		m.status += i18n.T("queue.urls_invalid", len(invalid), invalid[0])
+	}
+	m.schedule()
+	return nil
+}
+
+// enqueue appends the items neither running nor queued yet and returns
+// how many were added.
+func (m *Model) enqueue(items []queueItem) int {
+	running := make([]queueItem, 0, len(m.downloads))
+	for _, ds := range m.downloads {
+		if ds.state.active() {
+			running = append(running, queueItem{XdccFileInfo: ds.file})
+		}
+	}
+	// skip what is already running, then what is already queued.
+	items, _ = mergeQueue(running, items)
+	n := len(m.queue)
+	m.editQueue(mergeItems(items[len(running):]))
+	return len(m.queue) - n
+}
+
+// maxUndo bounds the removals remembered for undo.
+const maxUndo = 20
+
+// removedEntry is a removed row: a finished download is restored as is,
+// a queued or running one goes back in the queue.
+type removedEntry struct {
+	id         int
+	ds         *downloadState
+	item       queueItem
+	queueIndex int
+}
+
+func (m *Model) pushUndo(entries []removedEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	m.undo = append(m.undo, entries)
+	if len(m.undo) > maxUndo {
+		m.undo = m.undo[1:]
+	}
+}
+
+// undoRemoval restores the entries of the last removal.
+func (m *Model) undoRemoval() tea.Cmd {
+	if len(m.undo) == 0 {
+		m.status = i18n.T("undo.nothing")
+		return nil
+	}
+	entries := m.undo[len(m.undo)-1]
+	m.undo = m.undo[:len(m.undo)-1]
+
+	// reinsert in reverse so that queue indices stay valid.
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.ds != nil {
+			m.downloads[e.id] = e.ds
+			continue
+		}
+		m.editQueue(insertItem(e.item, e.queueIndex))
+	}
+	m.status = i18n.T("undo.restored", len(entries))
+	m.schedule()
+	return nil
+}
+
+// highlightedFile returns the pack of the highlighted downloads view row.
+func (m *Model) highlightedFile() (xdcc.IRCFile, bool) {
+	ids := m.downloadIDs()
+	if m.downloadCursor < len(ids) {
+		return m.downloads[ids[m.downloadCursor]].file.URL, true
+	}
+	i := m.downloadCursor - len(ids)
+	if i < len(m.queue) {
+		return m.queue[i].URL, true
+	}
+	return xdcc.IRCFile{}, false
+}
+
+// highlightedDownload returns the highlighted download if the cursor is
+// on a started one rather than a queued item.
+func (m *Model) highlightedDownload() *downloadState {
+	ids := m.downloadIDs()
+	if m.downloadCursor < len(ids) {
+		return m.downloads[ids[m.downloadCursor]]
+	}
+	return nil
+}
+
+// followFile moves the downloads view cursor to the row of file, which may
+// have moved from the queue to the running downloads or the other way.
+// The cursor is left alone when the file is gone.
+func (m *Model) followFile(file xdcc.IRCFile) {
+	ids := m.downloadIDs()
+	for row, id := range ids {
+		if m.downloads[id].file.URL == file && m.downloads[id].state.active() {
+			m.downloadCursor = row
+			return
+		}
+	}
+	for i := range m.queue {
+		if m.queue[i].URL == file {
+			m.downloadCursor = len(ids) + i
+			return
+		}
+	}
+	for row, id := range ids {
+		if m.downloads[id].file.URL == file {
+			m.downloadCursor = row
+			return
+		}
+	}
+	m.clampCursor()
+}
+
+// clampCursor keeps the downloads view cursor on an existing row.
+func (m *Model) clampCursor() {
+	rows := len(m.downloads) + len(m.queue)
+	if m.downloadCursor >= rows {
+		m.downloadCursor = rows - 1
+	}
+	if m.downloadCursor < 0 {
+		m.downloadCursor = 0
+	}
+}
+
+// removeRow removes the highlighted download: queued items leave the
+// queue, running transfers are stopped (the partial file is kept).
+func (m *Model) removeRow() tea.Cmd {
+	ids := m.downloadIDs()
+	if m.downloadCursor < len(ids) {
+		id := ids[m.downloadCursor]
+		ds := m.downloads[id]
+		delete(m.downloads, id)
+		m.clampCursor()
+		m.status = i18n.T("downloads.removed", ds.file.Name)
+		if !ds.state.active() {
+			m.pushUndo([]removedEntry{{id: id, ds: ds}})
+			return nil
+		}
+		m.pushUndo([]removedEntry{{item: ds.queueItem()}})
+		stop := m.manager.stop(id, ds.transfer)
+		m.downloadEnded(ds)
+		return stop
+	}
+
+	i := m.downloadCursor - len(ids)
+	if i >= len(m.queue) {
+		return nil
+	}
+	m.status = i18n.T("downloads.removed", m.queue[i].Name)
+	m.pushUndo([]removedEntry{{item: m.queue[i], queueIndex: i}})
+	m.editQueue(removeItem(m.queue[i].URL))
+	m.clampCursor()
+	return nil
+}
+
+// clearDownloads removes the finished downloads matching match and
+// returns how many were removed.
+func (m *Model) clearDownloads(match func(*downloadState) bool) int {
+	removed := make([]removedEntry, 0)
+	for _, id := range m.downloadIDs() {
+		ds := m.downloads[id]
+		if match(ds) {
+			delete(m.downloads, id)
+			removed = append(removed, removedEntry{id: id, ds: ds})
+		}
+	}
+	m.pushUndo(removed)
+	m.clampCursor()
+	return len(removed)
+}
+
+// requeueRow queues the highlighted finished download again with the same
+// url and destination, e.g. after the local file was deleted.
+func (m *Model) requeueRow() tea.Cmd {
+	ids := m.downloadIDs()
+	if m.downloadCursor >= len(ids) || m.downloads[ids[m.downloadCursor]].state.active() {
+		m.status = i18n.T("downloads.requeue_unfinished")
+		return nil
+	}
+	id := ids[m.downloadCursor]
+	ds := m.downloads[id]
+	delete(m.downloads, id)
+	item := ds.queueItem()
+	item.Attempts = 0
+	m.editQueue(appendItems(item))
+	m.clampCursor()
+	m.status = i18n.T("queue.queued_again", ds.file.Name)
+	m.schedule()
+	return nil
+}
+
+// requeueFailed puts every failed download back in the queue with fresh
+// retries.
+func (m *Model) requeueFailed() tea.Cmd {
+	items := make([]queueItem, 0)
+	for _, id := range m.downloadIDs() {
+		ds := m.downloads[id]
+		if ds.state != stateFailed {
+			continue
+		}
+		delete(m.downloads, id)
+		item := ds.queueItem()
+		item.Attempts = 0
+		items = append(items, item)
+	}
+	m.editQueue(appendItems(items...))
+	m.clampCursor()
+	m.status = i18n.T("downloads.requeued_failed", len(items))
+	m.schedule()
+	return nil
+}
+
+// togglePauseAll stops or restarts the scheduling of queued downloads.
+// With PauseActiveDownloads running transfers are suspended as well and
+// go back to the head of the queue.
+func (m *Model) togglePauseAll() tea.Cmd {
+	m.paused = !m.paused
+	if !m.paused {
+		m.status = i18n.T("downloads.resumed")
+		m.schedule()
+		return nil
+	}
+
+	m.status = i18n.T("downloads.paused")
+	m.schedule() // holds the queue before the transfers go back in
+	if !m.config.PauseActiveDownloads {
+		return nil
+	}
+	return tea.Batch(m.suspendActive()...)
+}
+
+// suspendActive stops the running transfers and puts them back at the
+// head of the queue, their partial files kept. The returned commands do
+// the stopping.
+func (m *Model) suspendActive() []tea.Cmd {
+	suspended := make([]queueItem, 0)
+	cmds := make([]tea.Cmd, 0)
+	for _, id := range m.downloadIDs() {
+		ds := m.downloads[id]
+		if !ds.state.active() {
+			continue
+		}
+		delete(m.downloads, id)
+		m.botFreed[ds.file.URL.BotKey()] = time.Now()
+		suspended = append(suspended, ds.queueItem())
+		cmds = append(cmds, m.manager.stop(id, ds.transfer))
+	}
+	m.editQueue(prependItems(suspended...))
+	m.downloadCursor = 0
+	return cmds
+}
+
+// togglePause pauses or resumes the highlighted row. Pausing a running
+// download stops its transfer and puts it back at the head of the queue;
+// the partial file is kept and the bot asked to resume it on restart.
+func (m *Model) togglePause() tea.Cmd {
+	ids := m.downloadIDs()
+	if m.downloadCursor < len(ids) {
+		id := ids[m.downloadCursor]
+		ds := m.downloads[id]
+		if !ds.state.active() {
+			return nil
+		}
+		delete(m.downloads, id)
+		m.botFreed[ds.file.URL.BotKey()] = time.Now()
+		item := ds.queueItem()
+		item.Paused = true
+		m.editQueue(prependItems(item))
+		m.downloadCursor = len(m.downloads)
+		m.status = i18n.T("downloads.item_paused", ds.file.Name)
+
+		stop := m.manager.stop(id, ds.transfer)
+		m.schedule()
+		return stop
+	}
+
+	i := m.downloadCursor - len(ids)
+	if i >= len(m.queue) {
+		return nil
+	}
+	m.editQueue(updateItem(m.queue[i].URL, func(item *queueItem) { item.Paused = !item.Paused }))
+	if m.queue[i].Paused {
+		m.status = i18n.T("downloads.item_paused", m.queue[i].Name)
+		return nil
+	}
+	m.status = i18n.T("downloads.item_resumed", m.queue[i].Name)
+	m.schedule()
+	return nil
+}
+
+// startFiles queues files and starts as many as there are free slots.
+func (m *Model) startFiles(files []search.XdccFileInfo) tea.Cmd {
+	items := make([]queueItem, 0, len(files))
+	for _, file := range files {
+		items = append(items, queueItem{XdccFileInfo: file, Alternates: m.alternatesFor(file)})
+	}
+	n := len(m.queue)
+	m.editQueue(mergeItems(items))
+	added := len(m.queue) - n
+	if m.offline {
+		m.status = i18n.T("offline.held", len(m.queue))
+		return nil
+	}
+	m.status = i18n.T("queue.queued", added)
+	if warning := m.spaceWarning(); warning != "" {
+		m.status = warning
+	}
+	m.schedule()
+	return nil
+}
+
+// spaceWarning returns a warning when the remaining downloads do not fit
+// in the download directory, an empty string otherwise.
+func (m *Model) spaceWarning() string {
+	free, err := xdcc.FreeSpace(m.config.DownloadDirectory())
+	if err != nil {
+		return ""
+	}
+	var needed uint64
+	for _, ds := range m.downloads {
+		if ds.state.active() && ds.bytesTotal > ds.bytesCompleted {
+			needed += ds.bytesTotal - ds.bytesCompleted
+		}
+	}
+	for _, item := range m.queue {
+		needed += uint64(util.MaxInt64(item.Size, 0))
+	}
+	if needed <= free {
+		return ""
+	}
+	return i18n.T("disk.insufficient",
+		FormatSize(int64(needed)), FormatSize(int64(free)))
+}
+
+// activeDownloads counts the transfers that are neither completed nor failed.
+func (m *Model) activeDownloads() int {
+	n := 0
+	for _, ds := range m.downloads {
+		if ds.state.active() {
+			n++
+		}
+	}
+	return n
+}
+
+// downloadFailed puts a failed download back in the queue to be retried
+// after a delay. Once the retries are exhausted or the failure is
+// permanent (banned, invalid pack) the next alternate bot is tried, and
+// the download is marked as failed when there is none left.
+func (m *Model) downloadFailed(id int, ds *downloadState, reason string, retry bool) {
+	ds.logf(i18n.T("log.failed"), reason)
+	backedOff := m.botFailed(ds.file.URL.BotKey())
+	if backedOff {
+		reason += i18n.T("download.backed_off", ds.file.URL.UserName, m.config.FailureBackoff())
+		ds.logf(i18n.T("log.backed_off"), ds.file.URL.UserName, m.config.FailureBackoff())
+		m.rerouteBot(ds.file.URL.BotKey())
+	}
+	m.recordError(i18n.T("errors.download_subject", ds.file.Name, ds.file.URL.BotKey()), reason, logLines(ds.log))
+
+	// a backed off bot is only retried when there is no other source.
+	if retry && ds.attempts < m.config.Retries() && (!backedOff || len(ds.alternates) == 0) {
+		delete(m.downloads, id)
+		item := ds.queueItem()
+		item.Attempts++
+		item.retryAt = time.Now().Add(m.config.RetryWait())
+		item.logf(i18n.T("log.retry"), item.Attempts, m.config.Retries(), m.config.RetryWait())
+		m.editQueue(appendItems(item))
+		m.status = i18n.T("download.failed_retry", ds.file.Name, reason,
+			item.Attempts, m.config.Retries(), m.config.RetryWait())
+		m.downloadEnded(ds)
+		return
+	}
+
+	if len(ds.alternates) > 0 {
+		// the next source starts over with its own retries.
+		delete(m.downloads, id)
+		item := queueItem{XdccFileInfo: ds.file, Alternates: ds.alternates[1:], OutPath: ds.outPath, FileName: ds.fileName, Date: ds.date, Log: ds.log}
+		item.URL = ds.alternates[0]
+		item.Slot = item.URL.Slot
+		item.logf(i18n.T("log.trying_alternate"), item.URL.BotKey())
+		m.editQueue(appendItems(item))
+		m.status = i18n.T("download.failed_alternate", ds.file.Name, reason, item.URL.UserName)
+		m.downloadEnded(ds)
+		return
+	}
+
+	ds.setState(stateFailed, "")
+	ds.reason = reason
+	m.recordHistory(ds)
+	m.notify(i18n.T("notify.download_failed"), ds.file.Name, reason)
+	m.alert = m.config.AlertOnFailure
+	m.downloadEnded(ds)
+}
+
+// botFailed counts a failure of bot and reports whether it made the bot
+// reach the failure limit, in which case it is backed off.
+func (m *Model) botFailed(bot string) bool {
+	limit := m.config.FailureLimit()
+	if limit == 0 {
+		return false
+	}
+	m.botFails[bot]++
+	if m.botFails[bot] < limit {
+		return false
+	}
+	delete(m.botFails, bot)
+	m.botBackoff[bot] = time.Now().Add(m.config.FailureBackoff())
+	return true
+}
+
+// rerouteBot moves the queued packs of a backed off bot that have
+// alternates to their next source; the others wait for the backoff.
+func (m *Model) rerouteBot(bot string) {
+	m.editQueue(func(queue []queueItem) []queueItem {
+		for i := range queue {
+			item := &queue[i]
+			if item.URL.BotKey() != bot || len(item.Alternates) == 0 {
+				continue
 			}
-			if i == m.cursor {
-				line = cursorStyle.Render(line)
+			item.logf(i18n.T("log.backed_off_alternate"), bot, item.Alternates[0].BotKey())
+			item.URL = item.Alternates[0]
+			item.Slot = item.URL.Slot
+			item.Alternates = item.Alternates[1:]
+			item.Attempts = 0
+			item.retryAt = time.Time{}
+		}
+		return queue
+	})
+}
+
+// downloadEnded frees the bot of a finished download and starts the next
+// queued ones.
+func (m *Model) downloadEnded(ds *downloadState) {
+	m.botFreed[ds.file.URL.BotKey()] = time.Now()
+	if err := m.daily.save(usagePath()); err != nil {
+		m.status = i18n.T("quota.save_failed", err)
+	}
+	m.schedule()
+}
+
+// quotaReason tells which quota holds the queue back.
+type quotaReason int
+
+const (
+	quotaNone quotaReason = iota
+	quotaSession
+	quotaDaily
+)
+
+func (r quotaReason) String() string {
+	switch r {
+	case quotaSession:
+		return i18n.T("quota.session_reached")
+	case quotaDaily:
+		return i18n.T("quota.daily_reached")
+	}
+	return ""
+}
+
+// quotaExceeded returns which quota is used up, quotaNone if none.
+func (m *Model) quotaExceeded() quotaReason {
+	if q := m.config.SessionQuota(); q > 0 && m.sessionBytes >= q {
+		return quotaSession
+	}
+	m.daily.rollover()
+	if q := m.config.DailyQuota(); q > 0 && m.daily.Bytes >= q {
+		return quotaDaily
+	}
+	return quotaNone
+}
+
+// quotaView describes the quota usage, empty when no quota is set.
+func (m Model) quotaView() string {
+	parts := make([]string, 0, 2)
+	if q := m.config.SessionQuota(); q > 0 {
+		parts = append(parts, i18n.T("quota.session_usage", FormatSize(int64(m.sessionBytes)), FormatSize(int64(q))))
+	}
+	if q := m.config.DailyQuota(); q > 0 {
+		parts = append(parts, i18n.T("quota.daily_usage", FormatSize(int64(m.daily.Bytes)), FormatSize(int64(q))))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return i18n.T("quota.summary", strings.Join(parts, " · "))
+}
+
+// transferStats sums up the running and queued downloads.
+type transferStats struct {
+	active, queued int
+	queuedBytes    uint64
+	total, done    uint64 // bytes of the active and queued downloads
+	speed          float64
+}
+
+func (m *Model) transferStats() transferStats {
+	var st transferStats
+	for _, ds := range m.downloads {
+		if !ds.state.active() {
+			continue
+		}
+		st.active++
+		st.total += ds.bytesTotal
+		st.done += ds.bytesCompleted
+		st.speed += ds.speed
+	}
+	for _, item := range m.queue {
+		st.queued++
+		st.queuedBytes += uint64(util.MaxInt64(item.Size, 0))
+	}
+	st.total += st.queuedBytes
+	return st
+}
+
+// statsView summarizes the downloads: counts, queued bytes, combined
+// speed, overall progress and the time to download everything at the
+// current speed. Empty when there is nothing to download.
+func (m Model) statsView() string {
+	st := m.transferStats()
+	if st.active == 0 && st.queued == 0 {
+		return ""
+	}
+	parts := []string{
+		i18n.T("stats.active", st.active),
+		i18n.T("stats.queued", st.queued, FormatSize(int64(st.queuedBytes))),
+		strings.TrimSpace(m.sparkline(m.rates) + " " + FormatSpeed(st.speed)),
+	}
+	if st.total > 0 {
+		parts = append(parts, fmt.Sprintf("%.0f%%", float64(st.done)/float64(st.total)*100))
+		if st.speed > 0 && st.total > st.done {
+			eta := time.Duration(float64(st.total-st.done) / st.speed * float64(time.Second))
+			parts = append(parts, i18n.T("stats.eta", formatETA(eta)))
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// connectionBar is the bottom line of every view: the IRC connections
+// with our nick on each, the transfers and the quota usage.
+func (m Model) connectionBar() string {
+	var parts []string
+	conns := m.connections.Connections()
+	switch {
+	case m.offline:
+		parts = append(parts, i18n.T("bar.offline"))
+	case len(conns) == 0:
+		parts = append(parts, i18n.T("bar.not_connected"))
+	default:
+		names := make([]string, 0, len(conns))
+		for _, c := range conns {
+			names = append(names, c.Nick+"@"+c.Server)
+		}
+		parts = append(parts, strings.Join(names, ", "))
+	}
+
+	st := m.transferStats()
+	speed := i18n.T("bar.active", st.active, FormatSpeed(st.speed))
+	if rate := m.limiter.Rate(); rate > 0 {
+		speed += i18n.T("bar.limit", FormatSpeed(float64(rate)))
+	}
+	parts = append(parts, speed)
+	if quota := m.quotaView(); quota != "" {
+		parts = append(parts, quota)
+	}
+	return statusBarStyle.Render(strings.Join(parts, " | "))
+}
+
+// schedule tells the manager the room left for transfers: it starts the
+// queued downloads that fit, MaxConcurrent transfers at most and one per
+// bot, separating the requests to a bot by the configured cooldown.
+func (m *Model) schedule() {
+	c := capacity{
+		held:      m.offline || m.paused,
+		free:      m.config.MaxConcurrent() - m.activeDownloads(),
+		busy:      make(map[string]bool),
+		notBefore: make(map[string]time.Time),
+		ack:       m.queueAck,
+	}
+	for _, ds := range m.downloads {
+		if ds.state.active() {
+			c.busy[ds.file.URL.BotKey()] = true
+		}
+	}
+	for bot, until := range m.botBackoff {
+		c.notBefore[bot] = until
+	}
+	for bot, freed := range m.botFreed {
+		if t := freed.Add(m.config.Cooldown()); t.After(c.notBefore[bot]) {
+			c.notBefore[bot] = t
+		}
+	}
+	if !c.held {
+		reason := m.quotaExceeded()
+		switch reason {
+		case quotaSession:
+			c.held = true
+		case quotaDaily:
+			c.until = time.Now().Add(untilMidnight())
+		}
+		if reason != quotaNone && len(m.queue) > 0 {
+			m.status = i18n.T("quota.waiting", reason, len(m.queue))
+		}
+	}
+	m.manager.setCapacity(c)
+}
+
+// editQueue applies op to the queue shown and sends it to the manager,
+// which owns the queue.
+func (m *Model) editQueue(op queueOp) {
+	m.queue = op(m.queue)
+	m.unapplied = append(m.unapplied, op)
+	m.manager.edit(op)
+}
+
+// updateQueue takes the snapshot of the manager, with the ops it didn't
+// apply yet on top, and starts the items it picked.
+func (m *Model) updateQueue(msg queueMsg) {
+	m.unapplied = m.unapplied[msg.applied-m.applied:]
+	m.applied = msg.applied
+	m.queue = msg.queue
+	for _, op := range m.unapplied {
+		m.queue = op(m.queue)
+	}
+	m.queueAck = msg.seq
+	if len(msg.start) == 0 {
+		return
+	}
+	if m.offline || m.paused {
+		// picked before the manager knew the queue is held.
+		m.editQueue(prependItems(msg.start...))
+	} else {
+		for _, item := range msg.start {
+			m.startTransfer(item)
+		}
+	}
+	m.schedule()
+}
+
+func (m *Model) startTransfer(item queueItem) {
+	file := item.XdccFileInfo
+	if item.Date.IsZero() {
+		item.Date = time.Now()
+	}
+	conf := m.config.TransferConfig(file.URL, item.OutPath, file.Size, item.Date)
+	if item.FileName != "" {
+		conf = renamed(conf, item.FileName)
+	}
+	conf.Connections = m.connections
+	conf.RateLimiter = m.limiter
+	conf.RateWeight = item.Priority.weight()
+	transfer := xdcc.NewTransfer(conf)
+
+	id := m.nextDownloadID
+	m.nextDownloadID++
+	ds := &downloadState{
+		file:       file,
+		transfer:   transfer,
+		bytesTotal: uint64(file.Size),
+		attempts:   item.Attempts,
+		alternates: item.Alternates,
+		outPath:    item.OutPath,
+		fileName:   item.FileName,
+		date:       item.Date,
+		log:        item.Log,
+	}
+	m.downloads[id] = ds
+	m.manager.start(id, transfer)
+}
+
+func (m *Model) isQueued(file search.XdccFileInfo) bool {
+	for _, item := range m.queue {
+		if item.URL == file.URL {
+			return true
+		}
+	}
+	return false
+}
+
+// recordHistory stores the outcome of a finished download.
+func (m *Model) recordHistory(ds *downloadState) {
+	entry := history.Entry{
+		Name:    ds.file.Name,
+		URL:     ds.file.URL.String(),
+		Size:    ds.file.Size,
+		Path:    ds.path,
+		Status:  history.StatusCompleted,
+		Error:   ds.reason,
+		Suspect: ds.suspect,
+		Log:     ds.log,
+	}
+	if ds.state == stateFailed {
+		entry.Status = history.StatusFailed
+	} else if !ds.started.IsZero() {
+		entry.Duration = time.Since(ds.started)
+	}
+	entry.QueueWait = ds.queueWait()
+	m.finished = append(m.finished, entry)
+	err := m.history.Add(entry)
+	m.indexHistory()
+	if err != nil {
+		m.status = i18n.T("history.save_failed", err)
+	}
+}
+
+// SetExitWhenDone makes the TUI quit once no download is running or
+// waiting in the queue, for unattended batches.
+func (m *Model) SetExitWhenDone(enabled bool) {
+	m.exitWhenDone = enabled
+}
+
+// drained reports whether exit-when-done mode may quit: something was
+// downloaded and nothing is left to start. Paused items are left for the
+// next session; a global pause or offline mode holds the exit.
+func (m *Model) drained() bool {
+	if !m.exitWhenDone || m.paused || m.offline || len(m.finished) == 0 || m.activeDownloads() > 0 {
+		return false
+	}
+	for _, item := range m.queue {
+		if !item.Paused {
+			return false
+		}
+	}
+	return true
+}
+
+// Summary describes the downloads completed and failed in the session.
+func (m Model) Summary() string {
+	var b strings.Builder
+	failed := 0
+	for _, e := range m.finished {
+		if e.Status == history.StatusFailed {
+			failed++
+			fmt.Fprintf(&b, i18n.T("summary.failed"), e.Name, e.Error)
+		} else {
+			fmt.Fprintf(&b, i18n.T("summary.completed"), e.Name)
+		}
+	}
+	fmt.Fprintf(&b, i18n.T("summary.totals"), len(m.finished)-failed, failed)
+	if n := len(m.queue); n > 0 {
+		fmt.Fprintf(&b, i18n.T("summary.left"), n)
+	}
+	return m.render(b.String())
+}
+
+// downloadIDs returns the ids of all downloads in the order they were started.
+func (m *Model) downloadIDs() []int {
+	ids := make([]int, 0, len(m.downloads))
+	for id := range m.downloads {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// pendingItems returns the running and queued downloads as queue items;
+// running downloads go first, they were started earlier.
+func (m *Model) pendingItems() []queueItem {
+	return append(m.runningItems(), m.queue...)
+}
+
+// runningItems returns the running downloads as queue items, to resume
+// them first.
+func (m *Model) runningItems() []queueItem {
+	running := make([]queueItem, 0)
+	for _, id := range m.downloadIDs() {
+		ds := m.downloads[id]
+		if ds.state.active() {
+			item := ds.queueItem()
+			item.Priority = priorityHigh
+			running = append(running, item)
+		}
+	}
+	return running
+}
+
+// requestQuit quits at once when nothing is downloading or queued, and
+// asks first otherwise.
+func (m *Model) requestQuit() tea.Cmd {
+	active, queued := m.pendingCounts()
+	if active == 0 && queued == 0 {
+		return m.shutdown()
+	}
+	m.quitPrompt = true
+	return nil
+}
+
+// pendingCounts returns the number of running and queued downloads.
+func (m Model) pendingCounts() (active, queued int) {
+	for _, ds := range m.downloads {
+		if ds.state.active() {
+			active++
+		}
+	}
+	return active, len(m.queue)
+}
+
+func (m Model) quitPromptText() string {
+	active, queued := m.pendingCounts()
+	var parts []string
+	if active > 0 {
+		parts = append(parts, i18n.T("quit.in_progress", active))
+	}
+	if queued > 0 {
+		parts = append(parts, i18n.T("quit.queued", queued))
+	}
+	if len(parts) == 0 {
+		// they ended while the prompt was shown.
+		return i18n.T("quit.finished")
+	}
+	return i18n.T("quit.confirm", strings.Join(parts, ", "))
+}
+
+// answerQuit quits on "y" (or another ctrl+c), anything else goes back.
+func (m *Model) answerQuit(key string) tea.Cmd {
+	m.quitPrompt = false
+	switch key {
+	case "y", "Y", "ctrl+c":
+		return m.shutdown()
+	}
+	m.status = i18n.T("quit.cancelled")
+	return nil
+}
+
+// shutdown persists the unfinished downloads (and the search tabs when
+// sessions are restored), stops every transfer (QUIT, close sockets,
+// flush files) and then quits the program.
+func (m *Model) shutdown() tea.Cmd {
+	if m.shuttingDown {
+		return nil
+	}
+	m.shuttingDown = true
+	running := m.runningItems()
+	transfers := make([]xdcc.Transfer, 0, len(m.downloads))
+	for _, ds := range m.downloads {
+		if ds.state.active() {
+			transfers = append(transfers, ds.transfer)
+		}
+	}
+	m.status = i18n.T("quit.shutting_down")
+	queuePath := m.queuePath
+	var saved *session
+	if m.config.RestoreSession {
+		s := m.snapshotSession()
+		saved = &s
+	}
+	connections := m.connections
+	// the manager has the last word on the queue, with the items it is
+	// starting.
+	queue := m.manager.finish()
+	m.manager.close()
+
+	daily := m.daily
+	return func() tea.Msg {
+		var errs []error
+		pending, _ := mergeQueue(running, <-queue)
+		if err := saveQueue(queuePath, pending); err != nil {
+			errs = append(errs, i18n.Errorf("shutdown.queue_failed", queuePath, err))
+		}
+		if err := daily.save(usagePath()); err != nil {
+			errs = append(errs, i18n.Errorf("quota.save_failed", err))
+		}
+		if saved != nil {
+			if err := saveSession(sessionPath(), *saved); err != nil {
+				errs = append(errs, i18n.Errorf("shutdown.session_failed", err))
 			}
-			b.WriteString(line + "\n")
+		}
+
+		wg := sync.WaitGroup{}
+		wg.Add(len(transfers))
+		for _, t := range transfers {
+			go func(t xdcc.Transfer) {
+				t.Stop()
+				wg.Done()
+			}(t)
+		}
+		wg.Wait()
+		connections.Close()
+		return shutdownMsg{errs: errs}
+	}
+}
+
+// ShutdownErrors returns what the shutdown sequence failed to save, to be
+// printed once the program exited.
+func (m Model) ShutdownErrors() []error {
+	return m.shutdownErrs
+}
+
+// View implements tea.Model
+func (m Model) View() string {
+	return m.render(m.view() + "\n" + m.connectionBar())
+}
+
+func (m Model) view() string {
+	if m.logPanel {
+		return m.logPanelView()
+	}
+	if m.preview != nil {
+		return m.previewView()
+	}
 
+	// Show filter input when in filter mode
+	if m.filterMode {
+		return i18n.T("filter.typing", m.filterInput.View()) + m.gap() + i18n.T("filter.help") + m.footerView()
+	}
+
+	var b strings.Builder
+
+	// Show search input when no search has been performed yet
+	if !m.searchDone && m.currentView != viewHistory && m.currentView != viewStats && m.currentView != viewSettings {
+		return m.titleView() + m.tabsView() + m.searchInput.View() + "\n" + m.footerView()
+	}
+
+	if m.currentView == viewSearch {
+		// in compact mode the search input goes on the title line.
+		if m.compact {
+			b.WriteString(titleStyle.Render("XDCC-TUI") + " " + m.searchInput.View() + "\n")
+			b.WriteString(m.tabsView())
+		} else {
+			b.WriteString(m.titleView() + m.tabsView())
+			b.WriteString(m.searchInput.View() + "\n\n")
+		}
+
+		// Get the current results (filtered or unfiltered)
+		results := m.getCurrentResults()
+
+		// header
+		size := m.pageSize()
+		header := i18n.T("results.header",
+			m.page+1,
+			(len(results)+size-1)/size, // total pages
+			m.sortBy.label())
+		if m.packList != nil {
+			header = i18n.T("packs.header", m.packList.bot.UserName, m.packList.bot.Network, header)
+		}
+		b.WriteString(headerStyle.Render(header) + "\n")
+		if summary := m.providersSummary(); summary != "" && !m.compact {
+			b.WriteString(statusBarStyle.Render(summary) + "\n")
 		}
+
+		// results list
+		start := m.page * size
+		end := start + size
+		if end > len(results) {
+			end = len(results)
+		}
+
+		// Show message if no results
+		if m.presetMenu {
+			b.WriteString(m.presetMenuView())
+		} else if len(results) == 0 {
+			b.WriteString("\n  " + i18n.T("results.none"))
+		} else {
+			b.WriteString(m.resultsTable(results, start, end) + "\n")
+		}
+	} else if m.currentView == viewHistory {
+		b.WriteString(m.titleView())
+		b.WriteString(m.historyView())
+	} else if m.currentView == viewStats {
+		b.WriteString(m.titleView())
+		b.WriteString(m.sessionStatsView())
+	} else if m.currentView == viewSettings {
+		b.WriteString(m.titleView())
+		b.WriteString(m.settingsView())
 	} else {
 		// downloads view
-		b.WriteString(headerStyle.Render(fmt.Sprintf("%-40s %12s", "Name", "Progress")) + "\n")
-		for idx, ds := range m.downloads {
-			file := m.results[idx]
-			prog := "pending"
-			if ds.completed {
-				prog = "✔ completed"
-			} else if ds.bytesTotal > 0 {
-				pct := float64(ds.bytesCompleted) / float64(ds.bytesTotal) * 100
-				if pct < 0.1 {
-					pct = 0.1
-				}
-				prog = fmt.Sprintf("%5.1f%% %5.1f MB/s", pct, ds.speed/float64(search.MegaByte))
+		b.WriteString(m.titleView())
+		if m.paused {
+			b.WriteString(pausedStyle.Render(i18n.T("downloads.paused_banner")) + "\n")
+		}
+		if stats := m.statsView(); stats != "" {
+			b.WriteString(headerStyle.Render(stats) + "\n")
+		}
+		if quota := m.quotaView(); quota != "" {
+			if reason := m.quotaExceeded(); reason != quotaNone {
+				quota = pausedStyle.Render(quota + " – " + reason.String())
+			}
+			b.WriteString(quota + "\n")
+		}
+		b.WriteString(headerStyle.Render(fmt.Sprintf("  %-*s %-26s %-8s %s", m.downloadNameWidth(), i18n.T("column.name"), i18n.T("column.status"), i18n.T("column.eta"), i18n.T("column.progress"))) + "\n")
+		b.WriteString(m.downloadRows())
+	}
+
+	// the full name of a cut one takes the blank line under the rows.
+	if name := m.fullName(); name != "" {
+		b.WriteString(statusBarStyle.Render("  » "+name) + "\n")
+	} else if !m.compact {
+		b.WriteString("\n")
+	}
+	b.WriteString(m.errorPanelView())
+	b.WriteString(m.toastsView())
+	b.WriteString(m.messageStripView())
+	status := m.status
+	if hint := m.errorHint(); hint != "" {
+		status = strings.TrimPrefix(status+" | "+hint, " | ")
+	}
+	if m.currentView == viewDownloads {
+		if ds := m.highlightedDownload(); ds != nil && ds.state == stateDownloading {
+			status += i18n.T("status.eta", ds.file.Name, formatETA(ds.eta))
+		}
+	}
+	if m.confirm != nil {
+		status = m.confirm.prompt()
+	}
+	if m.quitPrompt {
+		status = m.quitPromptText()
+	}
+	if m.pathPrompt != nil {
+		status = i18n.T("prompt.line", m.pathPrompt.action, m.pathPrompt.input.View())
+		if m.pathPrompt.action == promptCommand {
+			status = fmt.Sprintf("%s (%s)", m.pathPrompt.input.View(), i18n.T("command.help"))
+		}
+		if m.pathPrompt.action == promptRename {
+			if err := validateFileName(strings.TrimSpace(m.pathPrompt.input.Value())); err != nil {
+				status += " " + pausedStyle.Render("⚠ "+err.Error())
 			}
-			line := fmt.Sprintf("%-40.40s %12s", file.Name, prog)
-			b.WriteString(line + "\n")
 		}
 	}
+	if m.paused {
+		status = i18n.T("status.paused", status)
+	}
+	if m.offline {
+		status = i18n.T("status.offline", status)
+	}
+	if m.exitWhenDone {
+		status = i18n.T("status.exit_when_done", status)
+	}
+	b.WriteString(statusBarStyle.Render(status))
+	b.WriteString(m.footerView())
+
+	return b.String()
+}
+
+// titleView renders the title line of the views.
+func (m Model) titleView() string {
+	return titleStyle.Render("XDCC-TUI") + m.gap()
+}
+
+// downloadLine renders the row of a started download, with its event log
+// when expanded.
+func (m Model) downloadLine(row int, ds *downloadState) string {
+	status := ds.state.String()
+	if ds.awaitingBytes() {
+		status = m.phaseStatus(ds)
+	}
+	if ds.detail != "" {
+		status += " " + ds.detail
+	}
+	prog := ""
+	switch {
+	case ds.state == stateDone && ds.suspect:
+		prog = i18n.T("downloads.size_mismatch")
+	case ds.state == stateDone:
+		prog = "✔"
+	case ds.state == stateFailed:
+		prog = "✘ " + ds.reason
+	case ds.state == stateWaiting:
+		prog = ds.botQueue.String()
+	case ds.state == stateDownloading && ds.bytesTotal > 0:
+		pct := float64(ds.bytesCompleted) / float64(ds.bytesTotal) * 100
+		if pct < 0.1 {
+			pct = 0.1
+		}
+		prog = fmt.Sprintf("%5.1f%% %10s", pct, FormatSpeed(ds.speed))
+		if spark := m.sparkline(ds.rates); spark != "" {
+			prog = spark + " " + prog
+		}
+		if ds.rateLimit > 0 {
+			prog += i18n.T("bar.limit", FormatSpeed(ds.rateLimit))
+		}
+	}
+	eta := ""
+	if ds.state == stateDownloading {
+		eta = formatETA(ds.eta)
+	}
+	return m.downloadRow(row, savedName(ds.file.Name, ds.fileName), status, eta, prog) + "\n" + m.logView(row, ds.log)
+}
 
-	b.WriteString("\n")
-	b.WriteString(statusBarStyle.Render(m.status))
+// queueLine renders the row of a queued download, with its event log when
+// expanded.
+func (m Model) queueLine(row int, item queueItem) string {
+	status := item.state().String()
+	if item.state() == stateQueued && m.offline {
+		status = i18n.T("downloads.held")
+	} else if d := time.Until(m.botBackoff[item.URL.BotKey()]); item.state() == stateQueued && d > 0 {
+		status = i18n.T("downloads.bot_backoff", formatETA(d))
+	}
+	prog := ""
+	if item.Attempts > 0 {
+		prog = i18n.T("downloads.retry", item.Attempts, m.config.Retries())
+	}
+	if item.Priority != priorityNormal {
+		status += " (" + item.Priority.String() + ")"
+	}
+	return m.downloadRow(row, savedName(item.Name, item.FileName), status, "", prog) + "\n" + m.logView(row, item.Log)
+}
 
+// downloadRow renders one line of the downloads view, highlighted when
+// under the cursor.
+func (m Model) downloadRow(row int, name, status, eta, prog string) string {
+	w := m.downloadNameWidth()
+	line := fmt.Sprintf("%-*s %-26.26s %-8s %s", w, ellipsize(name, w), status, eta, prog)
+	if row == m.downloadCursor {
+		return cursorStyle.Render("> " + line)
+	}
+	return "  " + line
+}
+
+// logPanelLevel returns the lowest level shown in the log panel.
+func (m *Model) logPanelLevel() applog.Level {
+	if m.logDebug {
+		return applog.LevelDebug
+	}
+	return applog.LevelInfo
+}
+
+// updateLogPanel scrolls the log panel; v shows or hides debug entries
+// and esc closes it.
+func (m *Model) updateLogPanel(key string) {
+	entries := len(applog.Default.Entries(m.logPanelLevel()))
+	switch key {
+	case "up", "k":
+		m.logOffset++
+	case "down", "j":
+		m.logOffset--
+	case "pgup":
+		m.logOffset += m.pageSize()
+	case "pgdown":
+		m.logOffset -= m.pageSize()
+	case "v":
+		m.logDebug = !m.logDebug
+		m.logOffset = 0
+		return
+	case "esc", "q":
+		m.logPanel = false
+		return
+	}
+	if max := entries - m.pageSize(); m.logOffset > max {
+		m.logOffset = max
+	}
+	if m.logOffset < 0 {
+		m.logOffset = 0
+	}
+}
+
+// logPanelView renders the last page of the application log.
+func (m Model) logPanelView() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(i18n.T("log.title")) + "\n\n")
+
+	entries := applog.Default.Entries(m.logPanelLevel())
+	end := len(entries) - m.logOffset
+	start := end - m.pageSize()
+	if start < 0 {
+		start = 0
+	}
+	if len(entries) == 0 {
+		b.WriteString("  " + i18n.T("log.empty") + "\n")
+	}
+	for _, e := range entries[start:end] {
+		line := e.String()
+		if e.Level >= applog.LevelWarn {
+			line = pausedStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n" + statusBarStyle.Render(m.keyHints(m.width)))
+	return b.String()
+}
+
+// logView renders the event log under the highlighted row when expanded.
+func (m Model) logView(row int, log []history.LogEntry) string {
+	if !m.showLog || row != m.downloadCursor {
+		return ""
+	}
+	if len(log) == 0 {
+		return statusBarStyle.Render("      "+i18n.T("events.none")) + "\n"
+	}
+	var b strings.Builder
+	for _, e := range log {
+		b.WriteString(statusBarStyle.Render(fmt.Sprintf("      %s  %s", e.Time.Format("01-02 15:04:05"), e.Text)) + "\n")
+	}
 	return b.String()
 }
 
+// providersSummary renders how each provider fared in the last search,
+// e.g. "xdcc.eu: 142 (0.4s) · sunxdcc: timeout". Pack lists have none.
+func (m Model) providersSummary() string {
+	if m.packList != nil || len(m.providers) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(m.providers))
+	for _, p := range m.providers {
+		parts = append(parts, p.String())
+	}
+	return strings.Join(parts, " · ")
+}
+
 // Helper commands ----------------------------------------------------------------
 
-func runSearchCmd(aggr *search.ProviderAggregator, keywords []string) tea.Cmd {
+func runSearchCmd(aggr *search.ProviderAggregator, tab int, keywords []string) tea.Cmd {
 	return func() tea.Msg {
-		res, err := aggr.Search(keywords)
-		return searchResultsMsg{results: res, err: err}
+		res, providers, err := aggr.SearchWithStatus(keywords)
+		return searchResultsMsg{tab: tab, results: res, providers: providers, err: err}
 	}
 }
 
@@ -674,3 +2833,67 @@ func FormatSize(size int64) string {
 	}
 	return fmt.Sprintf("%dB", size)
 }
+
+// FormatSpeed renders a rate in bytes/s with the units of FormatSize.
+func FormatSpeed(rate float64) string {
+	if rate < 0 {
+		rate = 0
+	}
+	return FormatSize(int64(rate)) + "/s"
+}
+
+// describeTransferError turns the typed transfer errors, those of the bot
+// replies included, into short user-facing explanations.
+func describeTransferError(err error) string {
+	var space *xdcc.InsufficientSpaceError
+	var incomplete *xdcc.IncompleteError
+	var op *xdcc.OpError
+	switch {
+	case errors.As(err, &space):
+		return i18n.T("reason.no_space", FormatSize(int64(space.Needed)), FormatSize(int64(space.Available)))
+	case errors.Is(err, xdcc.ErrDiskFull):
+		return i18n.T("reason.disk_full")
+	case errors.As(err, &incomplete):
+		return i18n.T("reason.incomplete", FormatSize(int64(incomplete.Written)), FormatSize(int64(incomplete.Size)))
+	case errors.Is(err, xdcc.ErrTooManyAttempts):
+		return i18n.T("reason.too_many_attempts")
+	case errors.As(err, &op):
+		return i18n.T("reason."+op.Op, op.Err)
+	case errors.Is(err, xdcc.ErrQueueFull):
+		return i18n.T("reason.queue_full")
+	case errors.Is(err, xdcc.ErrNoSlots):
+		return i18n.T("reason.no_slots")
+	case errors.Is(err, xdcc.ErrLimitReached):
+		return i18n.T("reason.limit_reached")
+	case errors.Is(err, xdcc.ErrBanned):
+		return i18n.T("reason.banned")
+	case errors.Is(err, xdcc.ErrInvalidPack):
+		return i18n.T("reason.invalid_pack")
+	case errors.Is(err, xdcc.ErrAlreadyRequested):
+		return i18n.T("reason.already_requested")
+	}
+	return err.Error()
+}
+
+// abortReason describes why a transfer was aborted.
+func abortReason(e *xdcc.TransferAbortedEvent) string {
+	if e.Err != nil {
+		return describeTransferError(e.Err)
+	}
+	return e.Error
+}
+
+// formatETA renders a remaining time as h:mm:ss, or "--:--" when unknown.
+func formatETA(d time.Duration) string {
+	if d <= 0 {
+		return "--:--"
+	}
+	d = d.Round(time.Second)
+	h := int(d / time.Hour)
+	m := int(d % time.Hour / time.Minute)
+	sec := int(d % time.Minute / time.Second)
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%02d:%02d", m, sec)
+}
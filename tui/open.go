@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"xdcc-tui/i18n"
+)
+
+// openFile opens path with the default application of the system,
+// without waiting for it.
+func openFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	return startDetached(cmd)
+}
+
+// revealFile shows the folder of path in the file manager, with the file
+// selected where the system supports it.
+func revealFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", "-R", path)
+	case "windows":
+		cmd = exec.Command("explorer", "/select,"+path)
+	default:
+		// xdg-open has no way to select the file.
+		cmd = exec.Command("xdg-open", filepath.Dir(path))
+	}
+	return startDetached(cmd)
+}
+
+func startDetached(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// openPath opens the downloaded file name saved at path, or shows it in
+// its folder with folder set.
+func (m *Model) openPath(name, path string, folder bool) {
+	if path == "" {
+		m.status = i18n.T("open.no_file", name)
+		return
+	}
+	open, target := openFile, path
+	if folder {
+		open = revealFile
+	}
+	if _, err := os.Stat(path); err != nil {
+		dir := filepath.Dir(path)
+		if _, dirErr := os.Stat(dir); !folder || dirErr != nil {
+			m.status = fmt.Sprintf("%s: %v", name, err)
+			return
+		}
+		// the file is gone: show the folder anyway.
+		open, target = openFile, dir
+	}
+	if err := open(target); err != nil {
+		m.status = i18n.T("open.failed", target, err)
+		return
+	}
+	m.status = i18n.T("open.opened", target)
+}
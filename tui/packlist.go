@@ -0,0 +1,102 @@
+package tui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+	"xdcc-tui/xdcc"
+)
+
+// packListMsg carries the pack list of a bot.
+type packListMsg struct {
+	tab   int // id of the search tab
+	bot   xdcc.IRCFile
+	packs []xdcc.Pack
+	err   error
+}
+
+// packList is the pack list of a bot, shown in place of the search
+// results with the same selection and queueing keys. It keeps the
+// results it replaced, which esc brings back.
+type packList struct {
+	bot      xdcc.IRCFile
+	results  []search.XdccFileInfo
+	filtered []search.XdccFileInfo
+	selected map[xdcc.IRCFile]struct{}
+	cursor   int
+	page     int
+}
+
+// openPackList asks the bot of the highlighted result for its packs.
+func (m *Model) openPackList() tea.Cmd {
+	results := m.getCurrentResults()
+	if m.cursor < 0 || m.cursor >= len(results) {
+		return nil
+	}
+	if m.offline {
+		m.status = i18n.T("packs.offline")
+		return nil
+	}
+	bot := results[m.cursor].URL
+	conf := m.config.TransferConfig(bot, "", 0, time.Now())
+	conf.Connections = m.connections
+	tab := m.tabs[m.activeTab].id
+
+	m.busy = true
+	m.status = i18n.T("packs.asking", bot.UserName)
+	return func() tea.Msg {
+		packs, err := xdcc.ListPacks(conf)
+		return packListMsg{tab: tab, bot: bot, packs: packs, err: err}
+	}
+}
+
+// showPackList replaces the results by the packs of the bot.
+func (m *Model) showPackList(msg packListMsg) {
+	m.busy = false
+	if msg.err != nil {
+		m.status = i18n.T("packs.failed", msg.bot.UserName, msg.err)
+		return
+	}
+
+	if m.packList == nil {
+		m.packList = &packList{
+			bot:      msg.bot,
+			results:  m.results,
+			filtered: m.filteredResults,
+			selected: m.selected,
+			cursor:   m.cursor,
+			page:     m.page,
+		}
+	}
+	m.packList.bot = msg.bot
+
+	results := make([]search.XdccFileInfo, 0, len(msg.packs))
+	for _, p := range msg.packs {
+		url := msg.bot
+		url.Slot = p.Slot
+		results = append(results, search.XdccFileInfo{URL: url, Name: p.Name, Size: p.Size, Slot: p.Slot, Gets: p.Gets})
+	}
+	sortResults(results, m.sortBy, "")
+	m.results = results
+	m.filteredResults = nil
+	m.filterInput.Reset()
+	m.selected = make(map[xdcc.IRCFile]struct{})
+	m.cursor = 0
+	m.page = 0
+	m.status = i18n.T("packs.found", len(results), msg.bot.UserName)
+}
+
+// closePackList brings back the search results the pack list replaced.
+func (m *Model) closePackList() {
+	pl := m.packList
+	m.packList = nil
+	m.results = pl.results
+	m.filteredResults = pl.filtered
+	m.selected = pl.selected
+	m.cursor = pl.cursor
+	m.page = pl.page
+	m.status = i18n.T("packs.back")
+}
@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+
+	"xdcc-tui/i18n"
+)
+
+// plainSymbols replaces the unicode marks of the views with ASCII, for
+// screen readers and terminals or fonts without the glyphs.
+var plainSymbols = strings.NewReplacer(
+	"✔", "OK",
+	"✘", "FAILED",
+	"⚠", "WARNING:",
+	"⏸", "||",
+	"…", "...",
+	"–", "-",
+	"—", "-",
+	"·", "|",
+	"▏", "|",
+	"↑/↓", "up/down",
+	"▼", "v",
+	"»", ">",
+)
+
+// noColorRequested reports whether the NO_COLOR convention asks for
+// output without colors (https://no-color.org).
+func noColorRequested() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// usePlainStyles drops the colors and text attributes of all styles.
+func usePlainStyles() {
+	plain := lipgloss.NewStyle()
+	titleStyle = plain
+	cursorStyle = plain
+	selectedStyle = plain
+	statusBarStyle = plain
+	headerStyle = plain
+	rowEvenStyle = plain
+	rowOddStyle = plain
+	pausedStyle = plain
+	matchStyle = plain
+	toastStyle = plain
+	toastFadingStyle = plain
+	errorPanelStyle = plain.Width(errorPanelWidth)
+}
+
+// SetPlain switches the plain ASCII mode: no colors, no emoji nor
+// unicode marks.
+func (m *Model) SetPlain(plain bool) {
+	m.plain = plain
+	if plain {
+		usePlainStyles()
+		for _, input := range []*textinput.Model{&m.searchInput, &m.filterInput, &m.historyFilter} {
+			input.PlaceholderStyle = lipgloss.NewStyle()
+		}
+	}
+}
+
+// SetASCII switches the ASCII markers: the emoji and unicode marks are
+// replaced like in the plain mode, the colors are kept.
+func (m *Model) SetASCII(ascii bool) {
+	m.ascii = ascii
+}
+
+// asciiOnly reports whether the views are limited to ASCII.
+func (m Model) asciiOnly() bool {
+	return m.plain || m.ascii
+}
+
+// toggleASCII switches the ASCII markers for the rest of the session.
+func (m *Model) toggleASCII() {
+	m.SetASCII(!m.ascii)
+	if m.ascii {
+		m.status = i18n.T("ascii.on")
+		return
+	}
+	m.status = i18n.T("ascii.off")
+}
+
+// render applies the plain mode and the ASCII markers to a rendered view
+// or message.
+func (m Model) render(s string) string {
+	if !m.asciiOnly() {
+		return s
+	}
+	return plainSymbols.Replace(s)
+}
@@ -0,0 +1,238 @@
+package tui
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+	"xdcc-tui/xdcc"
+)
+
+// maxPreviewSize bounds the packs that can be previewed.
+const maxPreviewSize = 512 * 1024
+
+// previewExtensions are the small text files worth a look before
+// downloading a release: release notes and checksums.
+var previewExtensions = []string{".nfo", ".txt", ".sfv", ".md5", ".sha1", ".diz"}
+
+// previewMsg carries the text of a previewed pack.
+type previewMsg struct {
+	url  xdcc.IRCFile
+	text string
+	err  error
+}
+
+// preview is a text pack downloaded to a temporary folder and shown in a
+// scrollable viewer in place of the views; lines is nil until it is
+// received. quit is closed when the viewer is closed.
+type preview struct {
+	file     search.XdccFileInfo
+	transfer xdcc.Transfer
+	quit     chan struct{}
+	lines    []string
+	err      error
+	offset   int
+}
+
+// previewable reports whether file is a small text file; an unknown size
+// is checked against maxPreviewSize once the bot announces it.
+func previewable(file search.XdccFileInfo) bool {
+	if file.Size > maxPreviewSize {
+		return false
+	}
+	name := strings.ToLower(file.Name)
+	for _, ext := range previewExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// openPreview downloads the highlighted result to a temporary folder and
+// shows it in the viewer.
+func (m *Model) openPreview() tea.Cmd {
+	results := m.getCurrentResults()
+	if m.cursor >= len(results) {
+		return nil
+	}
+	file := results[m.cursor]
+	if !previewable(file) {
+		m.status = i18n.T("preview.not_text", FormatSize(maxPreviewSize))
+		return nil
+	}
+	if m.offline {
+		m.status = i18n.T("preview.offline")
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "xdcc-preview-")
+	if err != nil {
+		m.status = i18n.T("preview.failed", file.Name, err)
+		return nil
+	}
+	conf := m.config.TransferConfig(file.URL, dir, file.Size, time.Now())
+	conf.IncompleteDir = ""
+	conf.Preallocate = false
+	conf.Connections = m.connections
+	transfer := xdcc.NewTransfer(conf)
+	quit := make(chan struct{})
+	m.preview = &preview{file: file, transfer: transfer, quit: quit}
+	return func() tea.Msg {
+		defer os.RemoveAll(dir)
+		text, err := receivePreview(transfer, quit)
+		return previewMsg{url: file.URL, text: text, err: err}
+	}
+}
+
+// receivePreview runs transfer to the end and returns the text received.
+// Closing quit stops the transfer, the viewer being gone.
+func receivePreview(transfer xdcc.Transfer, quit chan struct{}) (string, error) {
+	events := transfer.PollEvents()
+	defer transfer.Unsubscribe(events)
+
+	if err := transfer.Start(); err != nil {
+		return "", err
+	}
+	for {
+		select {
+		case evt := <-events:
+			switch e := evt.(type) {
+			case *xdcc.TransferStartedEvent:
+				if e.FileSize > maxPreviewSize {
+					transfer.Stop()
+					return "", i18n.Errorf("preview.too_large", FormatSize(int64(e.FileSize)))
+				}
+			case *xdcc.TransferCompletedEvent:
+				return readPreview(e.Path)
+			case *xdcc.TransferRejectedEvent:
+				return "", errors.New(describeTransferError(e.Err))
+			case *xdcc.TransferAbortedEvent:
+				return "", errors.New(abortReason(e))
+			}
+		case <-quit:
+			transfer.Stop()
+			return "", i18n.Errorf("preview.interrupted")
+		}
+	}
+}
+
+// readPreview reads the text of a previewed file. Text that isn't UTF-8,
+// such as the ASCII art of NFO files, is decoded as code page 437.
+func readPreview(path string) (string, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxPreviewSize))
+	if err != nil {
+		return "", err
+	}
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	var b strings.Builder
+	for _, c := range data {
+		if c < 0x80 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteRune(cp437[c-0x80])
+	}
+	return b.String(), nil
+}
+
+// cp437 are the characters of the upper half of code page 437.
+var cp437 = []rune("ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ ")
+
+// showPreview puts the text received in the viewer, unless it was closed
+// or moved on to another file meanwhile.
+func (m *Model) showPreview(msg previewMsg) {
+	if m.preview == nil || m.preview.file.URL != msg.url {
+		return
+	}
+	if msg.err != nil {
+		m.preview.err = msg.err
+		return
+	}
+	text := strings.ReplaceAll(msg.text, "\t", "    ")
+	text = strings.Map(func(r rune) rune {
+		// the text comes from the bot: no escape sequence reaches the
+		// terminal.
+		if r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+	m.preview.lines = strings.Split(strings.TrimRight(text, "\n"), "\n")
+}
+
+// updatePreview scrolls the viewer; esc or q closes it, which stops the
+// transfer if the file is still coming.
+func (m *Model) updatePreview(key string) {
+	p := m.preview
+	last := len(p.lines) - m.pageSize()
+	if last < 0 {
+		last = 0
+	}
+	switch key {
+	case "up", "k":
+		p.offset--
+	case "down", "j":
+		p.offset++
+	case "pgup", "left", "h":
+		p.offset -= m.pageSize()
+	case "pgdown", "right", "l", " ":
+		p.offset += m.pageSize()
+	case "home", "g":
+		p.offset = 0
+	case "end", "G":
+		p.offset = last
+	case "esc", "q", "v":
+		close(p.quit)
+		m.preview = nil
+		return
+	}
+	if p.offset > last {
+		p.offset = last
+	}
+	if p.offset < 0 {
+		p.offset = 0
+	}
+}
+
+// previewView renders the viewer: the file name, then a page of its text.
+func (m Model) previewView() string {
+	p := m.preview
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(i18n.T("preview.title", p.file.Name)) + m.gap())
+	switch {
+	case p.err != nil:
+		b.WriteString("  " + pausedStyle.Render(i18n.T("preview.failed", p.file.Name, p.err)) + "\n")
+	case p.lines == nil:
+		b.WriteString("  " + i18n.T("preview.receiving", p.file.URL.UserName) + "\n")
+	default:
+		end := p.offset + m.pageSize()
+		if end > len(p.lines) {
+			end = len(p.lines)
+		}
+		for _, line := range p.lines[p.offset:end] {
+			if m.width > 0 && utf8.RuneCountInString(line) > m.width {
+				line = string([]rune(line)[:m.width])
+			}
+			b.WriteString(line + "\n")
+		}
+		b.WriteString(statusBarStyle.Render(i18n.T("preview.position", p.offset+1, end, len(p.lines))) + "\n")
+	}
+	b.WriteString(m.footerView())
+	return b.String()
+}
@@ -0,0 +1,378 @@
+package tui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"xdcc-tui/config"
+	"xdcc-tui/history"
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+	"xdcc-tui/xdcc"
+)
+
+const queueFileName = "queue.json"
+
+// priority orders the download queue: higher priorities are started first,
+// items of equal priority in queue order.
+type priority int
+
+const (
+	priorityLow    priority = -1
+	priorityNormal priority = 0
+	priorityHigh   priority = 1
+)
+
+func (p priority) String() string {
+	switch p {
+	case priorityHigh:
+		return i18n.T("priority.high")
+	case priorityLow:
+		return i18n.T("priority.low")
+	default:
+		return i18n.T("priority.normal")
+	}
+}
+
+// weight is the share of the speed limit given to the transfer.
+func (p priority) weight() int {
+	switch p {
+	case priorityHigh:
+		return 4
+	case priorityLow:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// next cycles normal -> high -> low -> normal.
+func (p priority) next() priority {
+	switch p {
+	case priorityNormal:
+		return priorityHigh
+	case priorityHigh:
+		return priorityLow
+	default:
+		return priorityNormal
+	}
+}
+
+// queueItem is a download waiting for a free slot. The file is embedded so
+// that queue files written before priorities existed still load. Paused
+// items are skipped by the scheduler, failed ones come back with Attempts
+// incremented and are not started before retryAt. Alternates are other
+// bots offering the same file, tried in order when this one fails.
+// OutPath overrides the download directory and rules for this item,
+// FileName the name announced by the bot.
+type queueItem struct {
+	search.XdccFileInfo
+	Priority   priority           `json:"priority,omitempty"`
+	Paused     bool               `json:"paused,omitempty"`
+	Attempts   int                `json:"attempts,omitempty"`
+	Alternates []xdcc.IRCFile     `json:"alternates,omitempty"`
+	OutPath    string             `json:"out_path,omitempty"`
+	FileName   string             `json:"file_name,omitempty"`
+	Date       time.Time          `json:"date"` // set on the first start, fills {date}
+	Log        []history.LogEntry `json:"log,omitempty"`
+
+	retryAt time.Time
+}
+
+// logf adds a line to the event log of the item.
+func (item *queueItem) logf(format string, args ...interface{}) {
+	item.Log = history.AppendLog(item.Log, fmt.Sprintf(format, args...))
+}
+
+// state is stateQueued, or statePaused for paused items.
+func (item *queueItem) state() itemState {
+	if item.Paused {
+		return statePaused
+	}
+	return stateQueued
+}
+
+// nextQueued returns the index of the item to start next, or -1 if no
+// item is ready. ready filters out items that cannot start yet.
+func nextQueued(queue []queueItem, ready func(queueItem) bool) int {
+	next := -1
+	for i, item := range queue {
+		if item.Paused || !ready(item) {
+			continue
+		}
+		if next < 0 || item.Priority > queue[next].Priority {
+			next = i
+		}
+	}
+	return next
+}
+
+// QueuePath returns the location of the queue saved between sessions.
+func QueuePath() string {
+	return filepath.Join(config.Dir(), queueFileName)
+}
+
+// saveQueue persists the unfinished downloads so they can be resumed on the
+// next start. An empty queue removes the file.
+func saveQueue(path string, items []queueItem) error {
+	if len(items) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return writeQueue(path, items)
+}
+
+// writeQueue writes items as JSON, also when there are none.
+func writeQueue(path string, items []queueItem) error {
+	if items == nil {
+		items = []queueItem{}
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// loadQueue reads the downloads persisted by saveQueue.
+func loadQueue(path string) ([]queueItem, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var items []queueItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// mergeQueue appends the items of add that are not queued yet and returns
+// how many were added.
+func mergeQueue(queue, add []queueItem) ([]queueItem, int) {
+	added := 0
+	for _, item := range add {
+		dup := false
+		for _, q := range queue {
+			if q.URL == item.URL {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			queue = append(queue, item)
+			added++
+		}
+	}
+	return queue, added
+}
+
+// queueIndex returns the index of the item of url in queue, -1 if it
+// isn't there.
+func queueIndex(queue []queueItem, url xdcc.IRCFile) int {
+	for i := range queue {
+		if queue[i].URL == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// Queue ops, see queueOp.
+
+// mergeItems queues the items of add that are not queued yet.
+func mergeItems(add []queueItem) queueOp {
+	return func(queue []queueItem) []queueItem {
+		queue, _ = mergeQueue(queue, add)
+		return queue
+	}
+}
+
+// appendItems queues items at the end.
+func appendItems(items ...queueItem) queueOp {
+	return func(queue []queueItem) []queueItem {
+		return append(queue, items...)
+	}
+}
+
+// prependItems queues items at the head.
+func prependItems(items ...queueItem) queueOp {
+	return func(queue []queueItem) []queueItem {
+		return append(append([]queueItem(nil), items...), queue...)
+	}
+}
+
+// insertItem queues item at index at, or at the end if the queue got
+// shorter.
+func insertItem(item queueItem, at int) queueOp {
+	return func(queue []queueItem) []queueItem {
+		i := at
+		if i > len(queue) {
+			i = len(queue)
+		}
+		return append(queue[:i], append([]queueItem{item}, queue[i:]...)...)
+	}
+}
+
+// removeItem takes the item of url out of the queue.
+func removeItem(url xdcc.IRCFile) queueOp {
+	return func(queue []queueItem) []queueItem {
+		if i := queueIndex(queue, url); i >= 0 {
+			return append(queue[:i], queue[i+1:]...)
+		}
+		return queue
+	}
+}
+
+// updateItem calls update on the queued item of url.
+func updateItem(url xdcc.IRCFile, update func(*queueItem)) queueOp {
+	return func(queue []queueItem) []queueItem {
+		if i := queueIndex(queue, url); i >= 0 {
+			update(&queue[i])
+		}
+		return queue
+	}
+}
+
+// swapItems swaps the queued items of a and b.
+func swapItems(a, b xdcc.IRCFile) queueOp {
+	return func(queue []queueItem) []queueItem {
+		i, j := queueIndex(queue, a), queueIndex(queue, b)
+		if i >= 0 && j >= 0 {
+			queue[i], queue[j] = queue[j], queue[i]
+		}
+		return queue
+	}
+}
+
+// ExportQueue writes the saved queue, with the per-item settings, to path
+// and returns the number of items.
+func ExportQueue(path string) (int, error) {
+	items, err := loadQueue(QueuePath())
+	if err != nil {
+		return 0, err
+	}
+	return len(items), writeQueue(path, items)
+}
+
+// ImportQueue adds the items of the queue file at path to the saved
+// queue, which the TUI resumes on its next start. It returns the number
+// of items added; items already queued are skipped.
+func ImportQueue(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	items, err := loadQueue(path)
+	if err != nil {
+		return 0, err
+	}
+	queue, err := loadQueue(QueuePath())
+	if err != nil {
+		return 0, err
+	}
+	queue, added := mergeQueue(queue, items)
+	return added, saveQueue(QueuePath(), queue)
+}
+
+// itemFromURL makes a queue item for a pack known only by its url.
+func itemFromURL(url *xdcc.IRCFile) queueItem {
+	return queueItem{XdccFileInfo: search.XdccFileInfo{
+		URL:  *url,
+		Name: fmt.Sprintf("%s #%d", url.UserName, url.Slot),
+		Slot: url.Slot,
+	}}
+}
+
+// readURLList parses an url list file into queue items.
+func readURLList(path string) ([]queueItem, []error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	urls, invalid, err := xdcc.ParseURLList(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	items := make([]queueItem, 0, len(urls))
+	for _, url := range urls {
+		items = append(items, itemFromURL(url))
+	}
+	return items, invalid, nil
+}
+
+// itemFromHistory makes a queue item downloading the file of a history
+// entry again, to the folder it was saved to.
+func itemFromHistory(e history.Entry) (queueItem, error) {
+	url, err := xdcc.ParseURL(e.URL)
+	if err != nil {
+		return queueItem{}, err
+	}
+	item := itemFromURL(url)
+	item.Name = e.Name
+	item.Size = e.Size
+	if e.Path != "" {
+		item.OutPath = filepath.Dir(e.Path)
+	}
+	return item, nil
+}
+
+// AddFromHistory queues the file last downloaded as name again, e.g.
+// after the local copy was deleted, in the queue resumed by the next TUI
+// session. It reports whether the file was added; it isn't when it is
+// already queued.
+func AddFromHistory(name string) (bool, error) {
+	store, err := history.Open(filepath.Join(config.Dir(), history.FileName))
+	if err != nil {
+		return false, err
+	}
+	e, ok := store.Latest(name)
+	if !ok {
+		return false, i18n.Errorf("history.not_in_history", name)
+	}
+	item, err := itemFromHistory(e)
+	if err != nil {
+		return false, err
+	}
+	queue, err := loadQueue(QueuePath())
+	if err != nil {
+		return false, err
+	}
+	queue, added := mergeQueue(queue, []queueItem{item})
+	return added > 0, saveQueue(QueuePath(), queue)
+}
+
+// AddFromFile queues the urls listed in the file at path, one per line,
+// in the queue resumed by the next TUI session. A non-empty outPath saves
+// them there instead of the configured directories. It returns the number
+// of urls added (duplicates are skipped) and the invalid lines.
+func AddFromFile(path, outPath string) (int, []error, error) {
+	items, invalid, err := readURLList(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	for i := range items {
+		items[i].OutPath = outPath
+	}
+	queue, err := loadQueue(QueuePath())
+	if err != nil {
+		return 0, nil, err
+	}
+	queue, added := mergeQueue(queue, items)
+	return added, invalid, saveQueue(QueuePath(), queue)
+}
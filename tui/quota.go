@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"xdcc-tui/config"
+)
+
+const usageFileName = "usage.json"
+
+// dailyUsage counts the bytes downloaded on one day, persisted so that the
+// daily quota holds across sessions.
+type dailyUsage struct {
+	Date  string `json:"date"`
+	Bytes uint64 `json:"bytes"`
+}
+
+func usagePath() string {
+	return filepath.Join(config.Dir(), usageFileName)
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// loadUsage reads the usage of today; usage of a previous day is dropped.
+func loadUsage(path string) (dailyUsage, error) {
+	usage := dailyUsage{Date: today()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return usage, err
+	}
+
+	var saved dailyUsage
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return usage, err
+	}
+	if saved.Date == usage.Date {
+		usage.Bytes = saved.Bytes
+	}
+	return usage, nil
+}
+
+func (u *dailyUsage) save(path string) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// add counts n bytes, starting over when the day changed.
+func (u *dailyUsage) add(n uint64) {
+	u.rollover()
+	u.Bytes += n
+}
+
+func (u *dailyUsage) rollover() {
+	if d := today(); u.Date != d {
+		u.Date = d
+		u.Bytes = 0
+	}
+}
+
+// untilMidnight returns the time left until the daily quota resets.
+func untilMidnight() time.Duration {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	return midnight.Sub(now)
+}
@@ -0,0 +1,123 @@
+package tui
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+	"xdcc-tui/xdcc"
+)
+
+// invalidNameChars are not allowed in file names on Windows; "/" nowhere.
+const invalidNameChars = `/\:*?"<>|`
+
+// validateFileName reports why name can't be the name of a saved file.
+// An empty name is valid: it keeps the name announced by the bot.
+func validateFileName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if name == "." || name == ".." {
+		return i18n.Errorf("rename.reserved", name)
+	}
+	for _, r := range name {
+		if strings.ContainsRune(invalidNameChars, r) || unicode.IsControl(r) {
+			return i18n.Errorf("rename.invalid_char", r)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return i18n.Errorf("rename.trailing")
+	}
+	return nil
+}
+
+// savedName returns the name a download is saved as, for the rows of the
+// downloads view.
+func savedName(name, fileName string) string {
+	if fileName == "" {
+		return name
+	}
+	return fileName
+}
+
+// renamed makes conf save the file as name, in the folder it would have
+// gone to otherwise: the rules and the filename template still apply to
+// the folders.
+func renamed(conf xdcc.Config, name string) xdcc.Config {
+	destination, outPath := conf.Destination, conf.OutPath
+	conf.Destination = func(announced string) string {
+		if destination != nil {
+			return filepath.Join(filepath.Dir(destination(announced)), name)
+		}
+		return filepath.Join(outPath, name)
+	}
+	return conf
+}
+
+// renameResult asks for the name to save the highlighted result as; the
+// file is queued once it is given.
+func (m *Model) renameResult() {
+	results := m.getCurrentResults()
+	if m.cursor >= len(results) {
+		return
+	}
+	file := results[m.cursor]
+	m.openPathPrompt(promptRename, file.Name)
+	m.pathPrompt.target = file.URL
+	m.pathPrompt.file = file
+}
+
+// renameQueued asks for the name to save the highlighted queued download
+// as.
+func (m *Model) renameQueued() {
+	i := m.highlightedQueued()
+	if i < 0 {
+		m.status = i18n.T("rename.not_queued")
+		return
+	}
+	name := m.queue[i].FileName
+	if name == "" {
+		name = m.queue[i].Name
+	}
+	m.openPathPrompt(promptRename, name)
+	m.pathPrompt.target = m.queue[i].URL
+}
+
+// setFileName saves the download of target as name, queueing file first
+// when it comes from the results. An empty name keeps the one announced
+// by the bot.
+func (m *Model) setFileName(target xdcc.IRCFile, file search.XdccFileInfo, name string) {
+	if err := validateFileName(name); err != nil {
+		m.status = i18n.T("rename.failed", err)
+		return
+	}
+	i := queueIndex(m.queue, target)
+	if i < 0 && file.URL == target {
+		if name == file.Name {
+			name = ""
+		}
+		// named before it is scheduled: it may start right away.
+		m.editQueue(appendItems(queueItem{XdccFileInfo: file, Alternates: m.alternatesFor(file), FileName: name}))
+		m.status = i18n.T("rename.queued", file.Name, name)
+		if name == "" {
+			m.status = i18n.T("queue.queued", 1)
+		}
+		m.schedule()
+		return
+	}
+	if i < 0 {
+		m.status = i18n.T("rename.not_queued")
+		return
+	}
+	if name == m.queue[i].Name {
+		name = ""
+	}
+	m.editQueue(updateItem(target, func(item *queueItem) { item.FileName = name }))
+	if name == "" {
+		m.status = i18n.T("rename.default", m.queue[i].Name)
+		return
+	}
+	m.status = i18n.T("rename.set", m.queue[i].Name, name)
+}
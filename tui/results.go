@@ -0,0 +1,349 @@
+package tui
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+
+	"xdcc-tui/history"
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+	"xdcc-tui/xdcc"
+)
+
+// sortColumn is the column the results are ordered by.
+type sortColumn int
+
+const (
+	sortSize sortColumn = iota
+	sortName
+	sortBot
+	sortNetwork
+	sortChannel
+	sortGets
+	sortRelevance // how well the name matches the query, see relevance
+)
+
+// orders are the orderings cycled by "o", a shortcut through the columns
+// cycled by "s".
+var orders = []sortColumn{sortRelevance, sortSize, sortName, sortBot}
+
+func (c sortColumn) String() string {
+	switch c {
+	case sortName:
+		return "name"
+	case sortBot:
+		return "bot"
+	case sortNetwork:
+		return "network"
+	case sortChannel:
+		return "channel"
+	case sortGets:
+		return "gets"
+	case sortRelevance:
+		return "relevance"
+	default:
+		return "size"
+	}
+}
+
+// label is the name of the order shown to the user; String is the one
+// typed in the :sort command.
+func (c sortColumn) label() string {
+	return i18n.T("sort." + c.String())
+}
+
+// next cycles size -> name -> bot -> network -> channel -> gets ->
+// relevance -> size.
+func (c sortColumn) next() sortColumn {
+	if c == sortRelevance {
+		return sortSize
+	}
+	return c + 1
+}
+
+// nextOrder cycles through orders; from a column out of them it starts
+// over with the first.
+func (c sortColumn) nextOrder() sortColumn {
+	for i, o := range orders {
+		if o == c {
+			return orders[(i+1)%len(orders)]
+		}
+	}
+	return orders[0]
+}
+
+// less orders sizes and gets from the largest, text columns
+// alphabetically.
+func (c sortColumn) less(a, b search.XdccFileInfo) bool {
+	switch c {
+	case sortName:
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	case sortBot:
+		return strings.ToLower(a.URL.UserName) < strings.ToLower(b.URL.UserName)
+	case sortNetwork:
+		return strings.ToLower(a.URL.Network) < strings.ToLower(b.URL.Network)
+	case sortChannel:
+		return strings.ToLower(a.URL.Channel) < strings.ToLower(b.URL.Channel)
+	case sortGets:
+		return a.Gets > b.Gets
+	default:
+		return a.Size > b.Size
+	}
+}
+
+// sortResults orders results by c; equal rows keep their order. query is
+// the search the results are ranked against for sortRelevance.
+func sortResults(results []search.XdccFileInfo, c sortColumn, query string) {
+	if c == sortRelevance {
+		terms := strings.Fields(strings.ToLower(query))
+		scores := make(map[xdcc.IRCFile]int, len(results))
+		for _, r := range results {
+			scores[r.URL] = relevance(r.Name, terms)
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			a, b := results[i], results[j]
+			if scores[a.URL] != scores[b.URL] {
+				return scores[a.URL] > scores[b.URL]
+			}
+			return a.Gets > b.Gets
+		})
+		return
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return c.less(results[i], results[j])
+	})
+}
+
+// relevance scores how well a file name matches the terms of a query:
+// terms found as whole words count the most, then terms found inside
+// words, and the words of the name beyond the query count against it,
+// so that "show s01e02 1080p" ranks above "show s01e02 extras 1080p".
+func relevance(name string, terms []string) int {
+	lower := strings.ToLower(name)
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	score := 0
+	for _, t := range terms {
+		switch {
+		case containsWord(words, t):
+			score += 10
+		case strings.Contains(lower, t):
+			score += 5
+		}
+	}
+	if extra := len(words) - len(terms); extra > 0 {
+		score -= extra
+	}
+	return score
+}
+
+func containsWord(words []string, w string) bool {
+	for _, word := range words {
+		if word == w {
+			return true
+		}
+	}
+	return false
+}
+
+// resort orders the results by m.sortBy; the selection, keyed by url,
+// follows the files.
+func (m *Model) resort() {
+	query := m.searchInput.Value()
+	sortResults(m.results, m.sortBy, query)
+	sortResults(m.filteredResults, m.sortBy, query)
+	m.cursor = 0
+	m.page = 0
+}
+
+// resultColumns are the columns of the results table; the sorted one is
+// marked and the name takes the width left by the others. The downloaded
+// column is only there when a row of the page was downloaded before.
+func (m Model) resultColumns(downloaded bool) []table.Column {
+	columns := []struct {
+		title string
+		width int
+		sort  sortColumn
+	}{
+		{i18n.T("column.type"), 7, -1},
+		{i18n.T("column.name"), m.resultNameWidth(downloaded), sortName},
+		{i18n.T("column.size"), 8, sortSize},
+		{i18n.T("column.bot"), 14, sortBot},
+		{i18n.T("column.network"), 14, sortNetwork},
+		{i18n.T("column.channel"), 14, sortChannel},
+		{i18n.T("column.gets"), 5, sortGets},
+	}
+	cols := []table.Column{{Title: "", Width: 3}}
+	for _, c := range columns {
+		title := c.title
+		if c.sort == m.sortBy {
+			title += " ▼"
+		}
+		cols = append(cols, table.Column{Title: title, Width: c.width})
+	}
+	if downloaded {
+		cols = append(cols, table.Column{Title: i18n.T("column.downloaded"), Width: 12})
+	}
+	return cols
+}
+
+// indexHistory caches the completed downloads of the history by name for
+// downloadedOn, which runs for every row rendered. It must be called again
+// whenever the history changes.
+func (m *Model) indexHistory() {
+	m.completed = make(map[string][]history.Entry)
+	for _, e := range m.history.Entries() {
+		if e.Status == history.StatusCompleted {
+			m.completed[e.Name] = append(m.completed[e.Name], e)
+		}
+	}
+}
+
+// downloadedOn returns the badge of a result already downloaded, with the
+// date of the latest download found in the history; empty if there is
+// none. See history.Store.FindCompleted.
+func (m Model) downloadedOn(res search.XdccFileInfo) string {
+	entries := m.completed[res.Name]
+	for i := len(entries) - 1; i >= 0; i-- {
+		if history.SimilarSize(entries[i].Size, res.Size) {
+			return "✔ " + entries[i].Date.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// resultsTable renders results[start:end], the current page.
+func (m Model) resultsTable(results []search.XdccFileInfo, start, end int) string {
+	rows := make([]table.Row, 0, end-start)
+	downloaded := false
+	for i := start; i < end; i++ {
+		res := results[i]
+		sel := "[ ]"
+		if _, ok := m.selected[res.URL]; ok {
+			sel = "[x]"
+		}
+		gets := "-"
+		if res.Gets >= 0 {
+			gets = strconv.Itoa(res.Gets)
+		}
+		got := m.downloadedOn(res)
+		downloaded = downloaded || got != ""
+		rows = append(rows, table.Row{sel, m.fileTypeTag(res.Name), res.Name, FormatSize(res.Size), res.URL.UserName, res.URL.Network, res.URL.Channel, gets, got})
+	}
+	if !downloaded {
+		for i := range rows {
+			rows[i] = rows[i][:len(rows[i])-1]
+		}
+	}
+
+	t := table.New(
+		table.WithColumns(m.resultColumns(downloaded)),
+		table.WithRows(rows),
+		table.WithHeight(len(rows)),
+		table.WithStyles(table.Styles{
+			Header:   headerStyle.Copy().Padding(0, 1),
+			Cell:     lipgloss.NewStyle().Padding(0, 1),
+			Selected: cursorStyle,
+		}),
+	)
+	t.SetCursor(m.cursor - start)
+	view := m.colorFileTypes(t.View(), results[start:end], m.cursor-start)
+	if m.filteredResults == nil {
+		return view
+	}
+	return m.highlightMatches(view, results[start:end], m.cursor-start)
+}
+
+// filterMatch returns where the first text term of the filter matches
+// name: the substring of a name term, the extension of a ".ext" one.
+// Sizes, file types, bots and negated terms match no text.
+func filterMatch(filter, name string) (start, end int, ok bool) {
+	lower := strings.ToLower(name)
+	if len(lower) != len(name) {
+		// lowering changed the byte offsets: nothing sensible to mark.
+		return 0, 0, false
+	}
+	for _, term := range strings.Fields(strings.ToLower(filter)) {
+		switch {
+		case strings.ContainsAny(term[:1], "!<>") || strings.HasPrefix(term, "type:") || strings.HasPrefix(term, "bot:"):
+			continue
+		case term[0] == '.':
+			if strings.HasSuffix(lower, term) {
+				return len(name) - len(term), len(name), true
+			}
+		default:
+			if start = strings.Index(lower, term); start >= 0 {
+				return start, start + len(term), true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// highlightMatches marks in the rendered rows of the results table the
+// part of each name the filter matched, when it wasn't truncated away.
+func (m Model) highlightMatches(table string, results []search.XdccFileInfo, selected int) string {
+	lines := strings.Split(table, "\n")
+	// the highlight ends with a reset: the selected row gets its color
+	// back after it.
+	restore := strings.SplitN(cursorStyle.Render("x"), "x", 2)[0]
+	for i, res := range results {
+		// the header takes the first line.
+		if i+1 >= len(lines) {
+			break
+		}
+		start, end, ok := filterMatch(m.filterInput.Value(), res.Name)
+		if !ok {
+			continue
+		}
+		line := lines[i+1]
+		pos := strings.Index(line, res.Name[:end])
+		if pos < 0 {
+			continue
+		}
+		after := line[pos+end:]
+		if i == selected {
+			after = restore + after
+		}
+		lines[i+1] = line[:pos+start] + matchStyle.Render(res.Name[start:end]) + after
+	}
+	return strings.Join(lines, "\n")
+}
+
+// jumpTo moves the cursor to the result i of the current results, and
+// shows its page. All the moves in the results go through it, so that
+// they behave the same on filtered results and pack lists.
+func (m *Model) jumpTo(i int) {
+	results := m.getCurrentResults()
+	if i >= len(results) {
+		i = len(results) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	m.cursor = i
+	m.page = i / m.pageSize()
+}
+
+// jumpToInput goes to the result numbered by input, counting from 1, or
+// to the first result of a page given as "p<n>".
+func (m *Model) jumpToInput(input string) {
+	input = strings.ToLower(input)
+	page := strings.HasPrefix(input, "p")
+	n, err := strconv.Atoi(strings.TrimPrefix(input, "p"))
+	if err != nil || n < 1 {
+		m.status = i18n.T("results.bad_jump", input)
+		return
+	}
+	if page {
+		m.jumpTo((n - 1) * m.pageSize())
+		return
+	}
+	m.jumpTo(n - 1)
+}
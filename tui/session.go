@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"xdcc-tui/config"
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+	"xdcc-tui/xdcc"
+)
+
+const sessionFileName = "session.json"
+
+// session is the state of the search tabs saved on quit and restored on
+// the next start when config.RestoreSession is set.
+type session struct {
+	Tabs      []sessionTab `json:"tabs"`
+	ActiveTab int          `json:"active_tab"`
+}
+
+// sessionTab is a search tab of a saved session. The filtered results are
+// not saved: they are computed again from the filter.
+type sessionTab struct {
+	Query    string                `json:"query,omitempty"`
+	Filter   string                `json:"filter,omitempty"`
+	Results  []search.XdccFileInfo `json:"results,omitempty"`
+	Selected []xdcc.IRCFile        `json:"selected,omitempty"`
+	Cursor   int                   `json:"cursor,omitempty"`
+	SortBy   sortColumn            `json:"sort_by,omitempty"`
+}
+
+// sessionPath returns the location of the session saved between runs.
+func sessionPath() string {
+	return filepath.Join(config.Dir(), sessionFileName)
+}
+
+// saveSession writes s as JSON.
+func saveSession(path string, s session) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// loadSession reads the session persisted by saveSession; a missing file
+// is an empty session.
+func loadSession(path string) (session, error) {
+	var s session
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+// snapshotSession returns the state of the search tabs to save. Tabs
+// still searching are saved with their query only.
+func (m *Model) snapshotSession() session {
+	m.saveTab()
+	s := session{ActiveTab: m.activeTab}
+	for _, t := range m.tabs {
+		st := sessionTab{
+			Query:  t.query,
+			Filter: t.filter,
+			Cursor: t.cursor,
+			SortBy: t.sortBy,
+		}
+		if t.searchDone {
+			st.Results = t.results
+			for _, r := range t.results {
+				if _, ok := t.selected[r.URL]; ok {
+					st.Selected = append(st.Selected, r.URL)
+				}
+			}
+		}
+		s.Tabs = append(s.Tabs, st)
+	}
+	return s
+}
+
+// restoreSession replaces the search tabs with the ones of s and reports
+// whether there was anything to restore.
+func (m *Model) restoreSession(s session) bool {
+	if len(s.Tabs) == 0 || len(s.Tabs) > maxTabs {
+		return false
+	}
+	tabs := make([]searchTab, 0, len(s.Tabs))
+	for _, st := range s.Tabs {
+		t := searchTab{
+			id:         m.nextTabID,
+			query:      st.Query,
+			filter:     st.Filter,
+			results:    st.Results,
+			selected:   make(map[xdcc.IRCFile]struct{}),
+			sortBy:     st.SortBy,
+			searchDone: len(st.Results) > 0,
+		}
+		m.nextTabID++
+		for _, url := range st.Selected {
+			t.selected[url] = struct{}{}
+		}
+		if terms, err := parseFilter(st.Filter, m.fileTypes); err == nil && len(terms) > 0 {
+			for _, r := range t.results {
+				if m.matchesFilter(terms, r) {
+					t.filteredResults = append(t.filteredResults, r)
+				}
+			}
+		}
+		shown := len(t.results)
+		if len(t.filteredResults) > 0 {
+			shown = len(t.filteredResults)
+		}
+		if st.Cursor >= 0 && st.Cursor < shown {
+			t.cursor = st.Cursor
+		}
+		t.page = t.cursor / m.pageSize()
+		tabs = append(tabs, t)
+	}
+	m.tabs = tabs
+	active := s.ActiveTab
+	if active < 0 || active >= len(tabs) {
+		active = 0
+	}
+	m.loadTab(active)
+	return true
+}
+
+// sessionStatus describes the restored session for the status line.
+func (m Model) sessionStatus() string {
+	results := 0
+	for _, t := range m.tabs {
+		results += len(t.results)
+	}
+	if len(m.tabs) == 1 {
+		return i18n.T("session.restored_search", m.tabs[0].query, results)
+	}
+	return i18n.T("session.restored_tabs", len(m.tabs), results)
+}
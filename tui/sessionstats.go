@@ -0,0 +1,170 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"xdcc-tui/history"
+	"xdcc-tui/i18n"
+	"xdcc-tui/xdcc"
+)
+
+// botStats sums up the downloads of a bot recorded in the history.
+type botStats struct {
+	bot               string // network/name, see xdcc.IRCFile.BotKey
+	completed, failed int
+	size              int64
+	duration          time.Duration // of the completed downloads
+	queueWait         time.Duration
+}
+
+func (s *botStats) add(e history.Entry) {
+	s.queueWait += e.QueueWait
+	if e.Status == history.StatusFailed {
+		s.failed++
+		return
+	}
+	s.completed++
+	if e.Speed() > 0 {
+		s.size += e.Size
+		s.duration += e.Duration
+	}
+}
+
+// successRate returns the share of completed downloads, in percent.
+func (s *botStats) successRate() float64 {
+	return float64(s.completed) / float64(s.completed+s.failed) * 100
+}
+
+// speed returns the average speed of the completed downloads, 0 when
+// unknown.
+func (s *botStats) speed() float64 {
+	if s.duration <= 0 {
+		return 0
+	}
+	return float64(s.size) / s.duration.Seconds()
+}
+
+// statsByBot groups entries by bot, the bots with the most downloads
+// first. Entries with an invalid url are left out.
+func statsByBot(entries []history.Entry) []*botStats {
+	byBot := make(map[string]*botStats)
+	var bots []*botStats
+	for _, e := range entries {
+		url, err := xdcc.ParseURL(e.URL)
+		if err != nil {
+			continue
+		}
+		key := url.BotKey()
+		s, ok := byBot[key]
+		if !ok {
+			s = &botStats{bot: key}
+			byBot[key] = s
+			bots = append(bots, s)
+		}
+		s.add(e)
+	}
+	sort.SliceStable(bots, func(i, j int) bool {
+		return bots[i].completed+bots[i].failed > bots[j].completed+bots[j].failed
+	})
+	return bots
+}
+
+// queueWait returns the time the download spent in the queue of its bot,
+// up to now while it still waits.
+func (ds *downloadState) queueWait() time.Duration {
+	end := ds.started
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return ds.botQueue.waited(end)
+}
+
+// updateStatsView handles the keys of the statistics view, which has none
+// of its own. It reports whether the key is left to the global ones.
+func (m *Model) updateStatsView(key string) bool {
+	switch key {
+	case "tab", "q", "ctrl+c", "ctrl+o":
+		return true
+	}
+	return false
+}
+
+// sessionStatsView renders the statistics view: the downloads of the
+// session, then the success of each bot over the whole history.
+func (m Model) sessionStatsView() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(i18n.T("stats.header", m.sessionStart.Format("15:04"),
+		formatEstimate(time.Since(m.sessionStart)))) + "\n")
+
+	all := m.history.Entries()
+	var session botStats
+	for _, e := range all {
+		if !e.Date.Before(m.sessionStart) {
+			session.add(e)
+		}
+	}
+	wait := session.queueWait
+	for _, ds := range m.downloads {
+		if ds.state == stateWaiting {
+			wait += ds.queueWait()
+		}
+	}
+	rows := [][2]string{
+		{i18n.T("stats.downloaded"), i18n.T("stats.downloaded_value",
+			FormatSize(int64(m.sessionBytes)), session.completed, session.failed)},
+		{i18n.T("stats.average_speed"), speedOrNone(session.speed())},
+		{i18n.T("stats.peak_speed"), speedOrNone(m.rates.peak)},
+		{i18n.T("stats.queue_wait"), waitOrNone(wait)},
+	}
+	for _, r := range rows {
+		b.WriteString(fmt.Sprintf("  %-20s %s\n", r[0], r[1]))
+	}
+
+	if !m.compact {
+		b.WriteString("\n")
+	}
+	bots := statsByBot(all)
+	b.WriteString(headerStyle.Render(fmt.Sprintf("  %-32s %9s %8s %10s  %s", i18n.T("column.bot"),
+		i18n.T("stats.column.downloads"), i18n.T("stats.column.success"),
+		i18n.T("stats.column.speed"), i18n.T("stats.column.queue_wait"))) + "\n")
+	if len(bots) == 0 {
+		b.WriteString("\n  " + i18n.T("history.none") + "\n")
+		return b.String()
+	}
+	shown := bots
+	if size := m.pageSize(); len(shown) > size {
+		shown = shown[:size]
+	}
+	for i, s := range shown {
+		style := rowEvenStyle
+		if i%2 == 1 {
+			style = rowOddStyle
+		}
+		line := fmt.Sprintf("  %-32.32s %9d %7.0f%% %10s  %s", s.bot, s.completed+s.failed,
+			s.successRate(), speedOrNone(s.speed()), waitOrNone(s.queueWait))
+		b.WriteString(style.Render(line) + "\n")
+	}
+	if more := len(bots) - len(shown); more > 0 {
+		b.WriteString("  " + i18n.T("stats.more_bots", more) + "\n")
+	}
+	return b.String()
+}
+
+// speedOrNone renders rate, "--" when unknown.
+func speedOrNone(rate float64) string {
+	if rate <= 0 {
+		return "--"
+	}
+	return FormatSpeed(rate)
+}
+
+// waitOrNone renders a queue wait, "--" when there was none.
+func waitOrNone(d time.Duration) string {
+	if d <= 0 {
+		return "--"
+	}
+	return formatEstimate(d)
+}
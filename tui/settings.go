@@ -0,0 +1,268 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/config"
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+)
+
+// setting is a config option editable in the settings view. name and
+// help are keys of the message catalog, helpArgs the arguments of help.
+// set validates the text entered and applies it to the running session.
+type setting struct {
+	name     string
+	help     string
+	helpArgs []interface{}
+	get      func(c *config.Config) string
+	set      func(m *Model, value string) error
+}
+
+// nickRegexp accepts the nicknames allowed by RFC 2812.
+var nickRegexp = regexp.MustCompile(`^[A-Za-z\[\]\\` + "`" + `_^{|}][A-Za-z0-9\[\]\\` + "`" + `_^{|}-]{0,29}$`)
+
+var settings = []setting{
+	{
+		name: "settings.download_dir",
+		help: "settings.download_dir.help",
+		get:  func(c *config.Config) string { return c.DownloadDir },
+		set: func(m *Model, value string) error {
+			old := m.config.DownloadDir
+			m.config.DownloadDir = value
+			if err := os.MkdirAll(m.config.DownloadDirectory(), 0755); err != nil {
+				m.config.DownloadDir = old
+				return err
+			}
+			return nil
+		},
+	},
+	{
+		name: "settings.rate_limit",
+		help: "settings.rate_limit.help",
+		get:  func(c *config.Config) string { return strconv.FormatInt(c.RateLimitKB, 10) },
+		set: func(m *Model, value string) error {
+			n, err := parseNonNegative(value)
+			if err != nil {
+				return err
+			}
+			m.config.RateLimitKB = n
+			if !m.sessionLimit {
+				m.limiter.SetRate(m.config.RateLimit())
+			}
+			return nil
+		},
+	},
+	{
+		name: "settings.session_quota",
+		help: "settings.session_quota.help",
+		get:  func(c *config.Config) string { return strconv.FormatInt(c.SessionQuotaMB, 10) },
+		set: func(m *Model, value string) error {
+			n, err := parseNonNegative(value)
+			if err != nil {
+				return err
+			}
+			m.config.SessionQuotaMB = n
+			m.schedule()
+			return nil
+		},
+	},
+	{
+		name: "settings.daily_quota",
+		help: "settings.daily_quota.help",
+		get:  func(c *config.Config) string { return strconv.FormatInt(c.DailyQuotaMB, 10) },
+		set: func(m *Model, value string) error {
+			n, err := parseNonNegative(value)
+			if err != nil {
+				return err
+			}
+			m.config.DailyQuotaMB = n
+			m.schedule()
+			return nil
+		},
+	},
+	{
+		name:     "settings.max_concurrent",
+		help:     "settings.max_concurrent.help",
+		helpArgs: []interface{}{config.DefaultMaxConcurrentDownloads},
+		get:      func(c *config.Config) string { return strconv.Itoa(c.MaxConcurrentDownloads) },
+		set: func(m *Model, value string) error {
+			n, err := parseNonNegative(value)
+			if err != nil {
+				return err
+			}
+			m.config.MaxConcurrentDownloads = int(n)
+			m.schedule()
+			return nil
+		},
+	},
+	{
+		name: "settings.page_size",
+		help: "settings.page_size.help",
+		get:  func(c *config.Config) string { return strconv.Itoa(c.PageSize) },
+		set: func(m *Model, value string) error {
+			n, err := parseNonNegative(value)
+			if err != nil {
+				return err
+			}
+			m.config.PageSize = int(n)
+			m.page = m.cursor / m.pageSize()
+			return nil
+		},
+	},
+	{
+		name: "settings.nick",
+		help: "settings.nick.help",
+		get:  func(c *config.Config) string { return c.Nick },
+		set: func(m *Model, value string) error {
+			if value != "" && !nickRegexp.MatchString(value) {
+				return i18n.Errorf("settings.invalid_nick", value)
+			}
+			m.config.Nick = value
+			return nil
+		},
+	},
+	{
+		name:     "settings.alert_on_complete",
+		help:     "settings.alert.help",
+		helpArgs: []interface{}{config.AlertBell, config.AlertFlash},
+		get:      func(c *config.Config) string { return c.AlertOnComplete },
+		set: func(m *Model, value string) error {
+			alert, err := parseAlert(value)
+			if err != nil {
+				return err
+			}
+			m.config.AlertOnComplete = alert
+			return nil
+		},
+	},
+	{
+		name:     "settings.alert_on_failure",
+		help:     "settings.alert.help",
+		helpArgs: []interface{}{config.AlertBell, config.AlertFlash},
+		get:      func(c *config.Config) string { return c.AlertOnFailure },
+		set: func(m *Model, value string) error {
+			alert, err := parseAlert(value)
+			if err != nil {
+				return err
+			}
+			m.config.AlertOnFailure = alert
+			return nil
+		},
+	},
+	{
+		name:     "settings.providers",
+		help:     "settings.providers.help",
+		helpArgs: []interface{}{strings.Join(search.ProviderNames, ", ")},
+		get:      func(c *config.Config) string { return strings.Join(c.Providers, ", ") },
+		set: func(m *Model, value string) error {
+			var names []string
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, strings.ToLower(name))
+				}
+			}
+			aggr, err := search.NewAggregatorOf(names)
+			if err != nil {
+				return err
+			}
+			m.config.Providers = names
+			m.aggregator = aggr
+			return nil
+		},
+	},
+}
+
+func parseNonNegative(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New(i18n.T("settings.expected_number"))
+	}
+	return n, nil
+}
+
+// updateSettingsView handles the keys of the settings view. It reports
+// whether the key was used; the global ones (tab, q...) are not.
+func (m *Model) updateSettingsView(msg tea.KeyMsg) (tea.Cmd, bool) {
+	if m.settingEdit != nil {
+		switch msg.String() {
+		case "esc":
+			m.settingEdit = nil
+		case "enter":
+			m.applySetting(strings.TrimSpace(m.settingEdit.Value()))
+		default:
+			input, cmd := m.settingEdit.Update(msg)
+			m.settingEdit = &input
+			return cmd, true
+		}
+		return nil, true
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		if m.settingsCursor > 0 {
+			m.settingsCursor--
+		}
+	case "down", "j":
+		if m.settingsCursor < len(settings)-1 {
+			m.settingsCursor++
+		}
+	case "enter":
+		input := textinput.New()
+		input.SetValue(settings[m.settingsCursor].get(m.config))
+		input.CursorEnd()
+		input.Width = 40
+		m.settingEdit = &input
+		return input.Focus(), true
+	case "tab", "q", "ctrl+c", "ctrl+o":
+		return nil, false
+	}
+	return nil, true
+}
+
+// applySetting validates and applies the value edited, then writes the
+// config file. An invalid value keeps the editor open.
+func (m *Model) applySetting(value string) {
+	s := settings[m.settingsCursor]
+	if err := s.set(m, value); err != nil {
+		m.status = fmt.Sprintf("%s: %v", i18n.T(s.name), err)
+		return
+	}
+	m.settingEdit = nil
+	if err := m.config.Save(m.configPath); err != nil {
+		m.status = i18n.T("settings.save_failed", err)
+		return
+	}
+	m.status = i18n.T("settings.saved", i18n.T(s.name))
+}
+
+// settingsView lists the settings with their current value.
+func (m Model) settingsView() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(i18n.T("settings.header")) + "\n")
+	for i, s := range settings {
+		value := s.get(m.config)
+		if i == m.settingsCursor && m.settingEdit != nil {
+			value = m.settingEdit.View()
+		} else if value == "" {
+			value = i18n.T("settings.default")
+		}
+		line := fmt.Sprintf("%-22s %s", i18n.T(s.name), value)
+		if i == m.settingsCursor {
+			b.WriteString(cursorStyle.Render("> "+line) + "\n")
+			b.WriteString(statusBarStyle.Render("    "+i18n.T(s.help, s.helpArgs...)) + "\n")
+			continue
+		}
+		b.WriteString("  " + line + "\n")
+	}
+	b.WriteString("\n" + statusBarStyle.Render(i18n.T("settings.saved_to", m.configPath)) + "\n")
+	return b.String()
+}
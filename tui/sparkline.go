@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// rateSamples is how many throughput samples the sparklines show, one per
+// rateInterval.
+const (
+	rateSamples  = 20
+	rateInterval = time.Second
+)
+
+var (
+	sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+	sparkASCII  = []rune("_.-:=+*#")
+)
+
+// rateTickMsg samples the throughput of the transfers.
+type rateTickMsg time.Time
+
+func rateTick() tea.Cmd {
+	return tea.Tick(rateInterval, func(t time.Time) tea.Msg {
+		return rateTickMsg(t)
+	})
+}
+
+// rateHistory is the recent throughput of a transfer or of all of them,
+// in bytes/s. It is computed from the bytes received between two samples
+// rather than from the smoothed rate, so that a stall drops to zero at
+// once.
+type rateHistory struct {
+	samples []float64
+	peak    float64   // highest sample ever, kept when older ones go
+	bytes   uint64    // received at the previous sample
+	at      time.Time // of the previous sample, zero before the first
+}
+
+// sample adds the rate since the previous sample given the bytes received
+// so far; the first one only sets the baseline.
+func (h *rateHistory) sample(bytes uint64, now time.Time) {
+	if !h.at.IsZero() {
+		var rate float64
+		if elapsed := now.Sub(h.at).Seconds(); elapsed > 0 && bytes > h.bytes {
+			rate = float64(bytes-h.bytes) / elapsed
+		}
+		if rate > h.peak {
+			h.peak = rate
+		}
+		samples := append([]float64{}, h.samples...)
+		samples = append(samples, rate)
+		if len(samples) > rateSamples {
+			samples = samples[len(samples)-rateSamples:]
+		}
+		h.samples = samples
+	}
+	h.bytes, h.at = bytes, now
+}
+
+// transferring reports whether bytes are flowing, or should be.
+func (m Model) transferring() bool {
+	for _, ds := range m.downloads {
+		if ds.state == stateDownloading {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleRates records the throughput of each downloading transfer and
+// the combined one.
+func (m *Model) sampleRates(now time.Time) {
+	for _, ds := range m.downloads {
+		if ds.state == stateDownloading {
+			ds.rates.sample(ds.bytesCompleted, now)
+		}
+	}
+	m.rates.sample(m.sessionBytes, now)
+}
+
+// sparkline renders the samples of h as bars scaled to the highest one,
+// right-aligned in rateSamples columns. Empty without samples.
+func (m Model) sparkline(h rateHistory) string {
+	if len(h.samples) == 0 {
+		return ""
+	}
+	levels := sparkBlocks
+	if m.asciiOnly() {
+		levels = sparkASCII
+	}
+	var peak float64
+	for _, s := range h.samples {
+		if s > peak {
+			peak = s
+		}
+	}
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", rateSamples-len(h.samples)))
+	for _, s := range h.samples {
+		level := 0
+		if peak > 0 {
+			level = int(s / peak * float64(len(levels)-1))
+		}
+		if s > 0 && level == 0 {
+			level = 1 // tell a slow transfer from a stalled one
+		}
+		b.WriteRune(levels[level])
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package tui
+
+import (
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// spinTickMsg advances the spinner of the transfers awaiting their first
+// bytes.
+type spinTickMsg struct{}
+
+func spinTick() tea.Cmd {
+	return tea.Tick(spinner.MiniDot.FPS, func(time.Time) tea.Msg {
+		return spinTickMsg{}
+	})
+}
+
+// awaitingBytes reports whether the transfer runs but nothing was
+// received yet: its phase is shown instead of the state.
+func (ds *downloadState) awaitingBytes() bool {
+	return (ds.state == stateConnecting || ds.state == stateWaiting) && ds.bytesCompleted == 0
+}
+
+// spinning reports whether a transfer shows the spinner.
+func (m Model) spinning() bool {
+	for _, ds := range m.downloads {
+		if ds.awaitingBytes() {
+			return true
+		}
+	}
+	return false
+}
+
+// phaseStatus renders the phase of a transfer after a spinner frame.
+func (m Model) phaseStatus(ds *downloadState) string {
+	frames := spinner.MiniDot.Frames
+	if m.asciiOnly() {
+		frames = spinner.Line.Frames
+	}
+	return frames[m.spinFrame%len(frames)] + " " + ds.phase.String()
+}
@@ -0,0 +1,98 @@
+package tui
+
+import "xdcc-tui/i18n"
+
+// itemState is where a download is in its lifecycle:
+//
+//	queued -> connecting -> waiting (in the bot's queue) -> downloading -> done
+//
+// Active states can also move to paused or failed; paused, failed and done
+// items can be queued again.
+type itemState int
+
+const (
+	stateQueued itemState = iota
+	stateConnecting
+	stateWaiting
+	stateDownloading
+	statePaused
+	stateFailed
+	stateDone
+)
+
+func (s itemState) String() string {
+	switch s {
+	case stateQueued:
+		return i18n.T("state.queued")
+	case stateConnecting:
+		return i18n.T("state.connecting")
+	case stateWaiting:
+		return i18n.T("state.waiting")
+	case stateDownloading:
+		return i18n.T("state.downloading")
+	case statePaused:
+		return i18n.T("state.paused")
+	case stateFailed:
+		return i18n.T("state.failed")
+	case stateDone:
+		return i18n.T("state.done")
+	}
+	return i18n.T("state.unknown")
+}
+
+// transitions lists the states reachable from each state. Staying in the
+// same state is always allowed to update the detail.
+var transitions = map[itemState][]itemState{
+	stateQueued:      {stateConnecting, statePaused, stateFailed},
+	stateConnecting:  {stateWaiting, stateDownloading, statePaused, stateFailed},
+	stateWaiting:     {stateConnecting, stateDownloading, statePaused, stateFailed},
+	stateDownloading: {stateDone, statePaused, stateFailed},
+	statePaused:      {stateQueued},
+	stateFailed:      {stateQueued},
+	stateDone:        {stateQueued},
+}
+
+func (s itemState) canMoveTo(to itemState) bool {
+	if s == to {
+		return true
+	}
+	for _, t := range transitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// active reports whether a transfer is running in this state.
+func (s itemState) active() bool {
+	return s == stateConnecting || s == stateWaiting || s == stateDownloading
+}
+
+// transferPhase tells where a transfer is before its first bytes, in the
+// connecting and waiting states.
+type transferPhase int
+
+const (
+	phaseResolving transferPhase = iota
+	phaseConnecting
+	phaseRegistering
+	phaseRequested
+	phaseBotQueue
+)
+
+func (p transferPhase) String() string {
+	switch p {
+	case phaseResolving:
+		return i18n.T("phase.resolving")
+	case phaseConnecting:
+		return i18n.T("phase.connecting")
+	case phaseRegistering:
+		return i18n.T("phase.registering")
+	case phaseRequested:
+		return i18n.T("phase.requested")
+	case phaseBotQueue:
+		return i18n.T("phase.bot_queue")
+	}
+	return i18n.T("state.unknown")
+}
@@ -0,0 +1,191 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+	"xdcc-tui/util"
+	"xdcc-tui/xdcc"
+)
+
+// maxTabs is the number of search tabs, reachable with the keys 1-9.
+const maxTabs = 9
+
+// searchTab is the state of a search tab. The state of the active tab
+// lives in the Model fields: its entry of Model.tabs is only up to date
+// once another tab was activated, see saveTab.
+type searchTab struct {
+	id              int
+	query           string
+	filter          string
+	results         []search.XdccFileInfo
+	filteredResults []search.XdccFileInfo
+	selected        map[xdcc.IRCFile]struct{}
+	cursor          int
+	page            int
+	sortBy          sortColumn
+	packList        *packList
+	providers       []search.ProviderStatus
+	searchDone      bool
+	busy            bool
+}
+
+// saveTab stores the search state of the model in the active tab.
+func (m *Model) saveTab() {
+	m.tabs[m.activeTab] = searchTab{
+		id:              m.tabs[m.activeTab].id,
+		query:           m.searchInput.Value(),
+		filter:          m.filterInput.Value(),
+		results:         m.results,
+		filteredResults: m.filteredResults,
+		selected:        m.selected,
+		cursor:          m.cursor,
+		page:            m.page,
+		sortBy:          m.sortBy,
+		packList:        m.packList,
+		providers:       m.providers,
+		searchDone:      m.searchDone,
+		busy:            m.busy,
+	}
+}
+
+// loadTab makes tab i the active one; the current state must have been
+// saved first.
+func (m *Model) loadTab(i int) {
+	t := m.tabs[i]
+	m.activeTab = i
+	m.searchInput.SetValue(t.query)
+	m.filterInput.SetValue(t.filter)
+	m.filterMode = false
+	m.results = t.results
+	m.filteredResults = t.filteredResults
+	m.selected = t.selected
+	if m.selected == nil {
+		m.selected = make(map[xdcc.IRCFile]struct{})
+	}
+	m.cursor = t.cursor
+	m.page = t.page
+	m.sortBy = t.sortBy
+	m.packList = t.packList
+	m.providers = t.providers
+	m.searchDone = t.searchDone
+	m.busy = t.busy
+	if m.searchDone {
+		m.searchInput.Blur()
+	} else {
+		m.searchInput.Focus()
+	}
+}
+
+func (m *Model) switchTab(i int) {
+	if i == m.activeTab || i < 0 || i >= len(m.tabs) {
+		return
+	}
+	m.saveTab()
+	m.loadTab(i)
+	m.currentView = viewSearch
+}
+
+// inTab runs fn with the tab of the given id active, e.g. to store the
+// results of a search finishing in the background. Nothing happens when
+// the tab was closed meanwhile. The inputs and the filter mode of the
+// active tab are given back as they were, the user may be typing.
+func (m *Model) inTab(id int, fn func()) {
+	current := m.activeTab
+	for i, t := range m.tabs {
+		if t.id != id {
+			continue
+		}
+		if i == current {
+			fn()
+			return
+		}
+		searchInput, filterInput, filterMode := m.searchInput, m.filterInput, m.filterMode
+		m.saveTab()
+		m.loadTab(i)
+		fn()
+		m.saveTab()
+		m.loadTab(current)
+		m.searchInput, m.filterInput, m.filterMode = searchInput, filterInput, filterMode
+		return
+	}
+}
+
+// updateTabs handles the keys opening, closing and switching search
+// tabs, and reports whether the key was one of them.
+func (m *Model) updateTabs(key string) (tea.Cmd, bool) {
+	switch key {
+	case "ctrl+t":
+		if len(m.tabs) >= maxTabs {
+			m.status = i18n.T("tabs.max", maxTabs)
+			return nil, true
+		}
+		m.saveTab()
+		m.tabs = append(m.tabs, searchTab{id: m.nextTabID})
+		m.nextTabID++
+		m.loadTab(len(m.tabs) - 1)
+		m.searchInput.Reset()
+		m.currentView = viewSearch
+		m.status = i18n.T("tabs.opened")
+		return nil, true
+	case "ctrl+w":
+		if m.currentView != viewSearch {
+			return nil, false
+		}
+		if len(m.tabs) == 1 {
+			m.status = i18n.T("tabs.last")
+			return nil, true
+		}
+		closed := m.activeTab
+		m.tabs = append(m.tabs[:closed:closed], m.tabs[closed+1:]...)
+		if closed == len(m.tabs) {
+			closed--
+		}
+		m.loadTab(closed)
+		return nil, true
+	}
+
+	digit := strings.TrimPrefix(key, "alt+")
+	n, err := strconv.Atoi(digit)
+	if err != nil || len(digit) != 1 || n < 1 {
+		return nil, false
+	}
+	// plain digits are typed in the search input until results show.
+	if digit == key && (m.currentView != viewSearch || !m.searchDone) {
+		return nil, false
+	}
+	m.switchTab(n - 1)
+	return nil, true
+}
+
+// tabsView renders the tab bar, empty with a single tab.
+func (m Model) tabsView() string {
+	if len(m.tabs) < 2 {
+		return ""
+	}
+	labels := make([]string, 0, len(m.tabs))
+	for i, t := range m.tabs {
+		query, busy := t.query, t.busy
+		if i == m.activeTab {
+			query, busy = m.searchInput.Value(), m.busy
+		}
+		if query == "" {
+			query = i18n.T("tabs.untitled")
+		}
+		label := fmt.Sprintf(" %d: %s ", i+1, util.CutStr(query, 20))
+		if busy {
+			label += "… "
+		}
+		if i == m.activeTab {
+			labels = append(labels, selectedStyle.Render("["+label+"]"))
+		} else {
+			labels = append(labels, statusBarStyle.Render(" "+label+" "))
+		}
+	}
+	return strings.Join(labels, "") + m.gap()
+}
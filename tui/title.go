@@ -0,0 +1,47 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/termenv"
+
+	"xdcc-tui/i18n"
+)
+
+const appTitle = "xdcc-tui"
+
+// windowTitle returns the terminal title: the number of transfers, the
+// overall progress and the combined speed while downloading, e.g.
+// "xdcc-tui ▏ 3 active ▏ 62% ▏ 4.2 MB/s".
+func (m Model) windowTitle() string {
+	st := m.transferStats()
+	if st.active == 0 {
+		return appTitle
+	}
+	parts := []string{appTitle, i18n.T("stats.active", st.active)}
+	if st.total > 0 {
+		parts = append(parts, fmt.Sprintf("%.0f%%", float64(st.done)/float64(st.total)*100))
+	}
+	parts = append(parts, FormatSpeed(st.speed))
+	return m.render(strings.Join(parts, " ▏ "))
+}
+
+// updateTitle sets the terminal title to windowTitle when it changed, so
+// that the progress shows in a background tab. It is called once per
+// rateInterval rather than on every progress event.
+func (m *Model) updateTitle() tea.Cmd {
+	if m.config.NoTerminalTitle {
+		return nil
+	}
+	title := m.windowTitle()
+	if title == m.title {
+		return nil
+	}
+	m.title = title
+	return func() tea.Msg {
+		termenv.SetWindowTitle(title)
+		return nil
+	}
+}
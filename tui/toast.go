@@ -0,0 +1,112 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"xdcc-tui/applog"
+	"xdcc-tui/i18n"
+	"xdcc-tui/search"
+)
+
+// toastDuration is how long a notification stays on screen; it fades
+// during the last toastFade of it.
+const (
+	toastDuration = 5 * time.Second
+	toastFade     = 1500 * time.Millisecond
+	maxToasts     = 4
+)
+
+var (
+	toastStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("229"))
+	toastFadingStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("243"))
+)
+
+// toast is a transient notification, shown above the status line until
+// it expires. Unlike the status, events don't overwrite each other.
+type toast struct {
+	text    string
+	expires time.Time
+}
+
+// toastTickMsg expires the notifications shown.
+type toastTickMsg struct{}
+
+func toastTick() tea.Cmd {
+	return tea.Tick(250*time.Millisecond, func(time.Time) tea.Msg {
+		return toastTickMsg{}
+	})
+}
+
+// notify shows a notification for a few seconds; it is kept in the
+// application log as well.
+func (m *Model) notify(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	applog.Infof("%s", text)
+
+	toasts := append([]toast{}, m.toasts...)
+	toasts = append(toasts, toast{text: text, expires: time.Now().Add(toastDuration)})
+	if len(toasts) > maxToasts {
+		toasts = toasts[len(toasts)-maxToasts:]
+	}
+	m.toasts = toasts
+}
+
+// expireToasts drops the notifications past their time and reports
+// whether some are left.
+func (m *Model) expireToasts(now time.Time) bool {
+	toasts := make([]toast, 0, len(m.toasts))
+	for _, t := range m.toasts {
+		if now.Before(t.expires) {
+			toasts = append(toasts, t)
+		}
+	}
+	m.toasts = toasts
+	return len(toasts) > 0
+}
+
+// toastsView renders the notifications, oldest first.
+func (m Model) toastsView() string {
+	if len(m.toasts) == 0 {
+		return ""
+	}
+	now := time.Now()
+	var b strings.Builder
+	for _, t := range m.toasts {
+		style := toastStyle
+		if t.expires.Sub(now) < toastFade {
+			style = toastFadingStyle
+		}
+		b.WriteString(style.Render("» "+t.text) + "\n")
+	}
+	return b.String()
+}
+
+// notifyProviderErrors tells which search providers failed, and keeps
+// the error in full for the error panel.
+func (m *Model) notifyProviderErrors(err error) {
+	var failed search.ProviderErrors
+	if !errors.As(err, &failed) {
+		if err != nil {
+			m.recordError(i18n.T("errors.search_subject"), err.Error(), nil)
+		}
+		return
+	}
+	details := make([]string, 0, len(failed))
+	for _, pe := range failed {
+		details = append(details, pe.Error())
+		var netErr net.Error
+		if errors.As(pe.Err, &netErr) && netErr.Timeout() {
+			m.notify(i18n.T("notify.provider_timeout"), pe.Provider)
+			continue
+		}
+		m.notify(i18n.T("notify.provider_failed"), pe.Provider, pe.Err)
+	}
+	m.recordError(i18n.T("errors.search_subject"), i18n.T("errors.providers_failed", len(failed)), details)
+}
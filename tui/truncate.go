@@ -0,0 +1,103 @@
+package tui
+
+import "unicode/utf8"
+
+// Bounds of the name columns, which take what the terminal width leaves
+// them; defaultNameWidth is used until the terminal told its width.
+const (
+	defaultNameWidth = 40
+	minNameWidth     = 24
+	maxNameWidth     = 100
+)
+
+// ellipsize cuts s to width characters, ending it with "…" when cut.
+func ellipsize(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+// nameWidth returns the width of a name column sharing the terminal with
+// others columns of the given total width.
+func (m Model) nameWidth(others int) int {
+	if m.width == 0 {
+		return defaultNameWidth
+	}
+	w := m.width - others
+	if w < minNameWidth {
+		return minNameWidth
+	}
+	if w > maxNameWidth {
+		return maxNameWidth
+	}
+	return w
+}
+
+// resultNameWidth returns the width of the name column of the results
+// table; each column is padded by a space on both sides.
+func (m Model) resultNameWidth(downloaded bool) int {
+	others := 3 + 7 + 8 + 14 + 14 + 14 + 5 + 8*2 + 2
+	if downloaded {
+		others += 12 + 2
+	}
+	return m.nameWidth(others)
+}
+
+// downloadNameWidth returns the width of the name column of the downloads
+// view, leaving room for the status, the ETA and the progress.
+func (m Model) downloadNameWidth() int {
+	return m.nameWidth(2 + 1 + 26 + 1 + 8 + 1 + 32)
+}
+
+// fullName returns the whole name of the highlighted row when its column
+// cuts it, empty otherwise; it is shown under the rows.
+func (m Model) fullName() string {
+	switch m.currentView {
+	case viewSearch:
+		results := m.getCurrentResults()
+		if !m.searchDone || m.presetMenu || m.cursor >= len(results) {
+			return ""
+		}
+		name := results[m.cursor].Name
+		if utf8.RuneCountInString(name) > m.resultNameWidth(m.pageDownloaded()) {
+			return name
+		}
+	case viewDownloads:
+		name, ok := m.highlightedName()
+		if ok && utf8.RuneCountInString(name) > m.downloadNameWidth() {
+			return name
+		}
+	case viewHistory:
+		e, ok := m.highlightedEntry()
+		if ok && m.width > 0 && utf8.RuneCountInString(historyLine(e))+2 > m.width {
+			return historyName(e)
+		}
+	}
+	return ""
+}
+
+// highlightedName returns the name the highlighted row of the downloads
+// view is saved as.
+func (m Model) highlightedName() (string, bool) {
+	if ds := m.highlightedDownload(); ds != nil {
+		return savedName(ds.file.Name, ds.fileName), true
+	}
+	if i := m.highlightedQueued(); i >= 0 {
+		return savedName(m.queue[i].Name, m.queue[i].FileName), true
+	}
+	return "", false
+}
+
+// pageDownloaded reports whether a result of the current page was
+// downloaded before, see resultColumns.
+func (m Model) pageDownloaded() bool {
+	results := m.getCurrentResults()
+	size := m.pageSize()
+	for i := m.page * size; i < len(results) && i < (m.page+1)*size; i++ {
+		if m.downloadedOn(results[i]) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"xdcc-tui/xdcc"
+)
+
+const (
+	// watchInterval is how often the watch directory is scanned.
+	watchInterval = 5 * time.Second
+
+	// watchSettle skips files modified more recently, which may still be
+	// being written by the tool dropping them.
+	watchSettle = 2 * time.Second
+
+	processedDirName = "processed"
+	failedDirName    = "failed"
+)
+
+// watchTickMsg triggers a scan of the watch directory.
+type watchTickMsg struct{}
+
+// watchResultMsg carries the downloads found in job files.
+type watchResultMsg struct {
+	items  []queueItem
+	jobs   int
+	errors []error
+}
+
+func watchTickCmd() tea.Cmd {
+	return tea.Tick(watchInterval, func(time.Time) tea.Msg { return watchTickMsg{} })
+}
+
+// scanWatchDirCmd reads the job files dropped in dir: queue exports
+// (.json) or url lists (anything else). Processed files are moved to
+// dir/processed, unreadable ones to dir/failed.
+func scanWatchDirCmd(dir string) tea.Cmd {
+	return func() tea.Msg {
+		res := watchResultMsg{}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			res.errors = append(res.errors, err)
+			return res
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < watchSettle {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			items, invalid, err := readJobFile(path)
+			res.errors = append(res.errors, invalid...)
+			archive := processedDirName
+			if err != nil {
+				res.errors = append(res.errors, fmt.Errorf("%s: %w", entry.Name(), err))
+				archive = failedDirName
+			} else {
+				res.items = append(res.items, items...)
+				res.jobs++
+			}
+			if err := archiveJobFile(path, filepath.Join(dir, archive)); err != nil {
+				res.errors = append(res.errors, err)
+			}
+		}
+		return res
+	}
+}
+
+// readJobFile reads a queue export, a JSON array of urls or an url list.
+func readJobFile(path string) ([]queueItem, []error, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		return readURLList(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var items []queueItem
+	if err := json.Unmarshal(data, &items); err == nil {
+		return items, nil, nil
+	}
+
+	var urls []string
+	if err := json.Unmarshal(data, &urls); err != nil {
+		return nil, nil, err
+	}
+	invalid := make([]error, 0)
+	for i, u := range urls {
+		url, err := xdcc.ParseURL(u)
+		if err != nil {
+			invalid = append(invalid, &xdcc.URLListError{Line: i + 1, Text: u, Err: err})
+			continue
+		}
+		items = append(items, itemFromURL(url))
+	}
+	return items, invalid, nil
+}
+
+// archiveJobFile moves a handled job file into dir, prefixing its name
+// with the time so that files dropped twice don't clash.
+func archiveJobFile(path, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := time.Now().Format("20060102-150405") + "-" + filepath.Base(path)
+	return os.Rename(path, filepath.Join(dir, name))
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// episodeRegexp recognizes "Show.Name.S01E02..." style release names.
+	episodeRegexp    = regexp.MustCompile(`(?i)^(.*?)[ ._-]+s(\d{1,2})e(\d{1,3})`)
+	resolutionRegexp = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(2160p|1080p|720p|576p|480p|4k)(?:[^a-z0-9]|$)`)
+)
+
+// Episode describes a release name of a TV episode.
+type Episode struct {
+	Show       string // e.g. "The Show", separators replaced by spaces
+	Season     int
+	Number     int
+	Resolution string // lowercase, e.g. "1080p"; empty if not found
+}
+
+// ParseEpisode extracts the episode information of a release name.
+func ParseEpisode(name string) (Episode, bool) {
+	m := episodeRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return Episode{}, false
+	}
+	season, _ := strconv.Atoi(m[2])
+	number, _ := strconv.Atoi(m[3])
+	ep := Episode{
+		Show:   strings.Join(strings.Fields(strings.NewReplacer(".", " ", "_", " ").Replace(m[1])), " "),
+		Season: season,
+		Number: number,
+	}
+	if r := resolutionRegexp.FindStringSubmatch(name); r != nil {
+		ep.Resolution = strings.ToLower(r[1])
+	}
+	return ep, true
+}
+
+// SameSeason reports whether e and o belong to the same season of the
+// same show.
+func (e Episode) SameSeason(o Episode) bool {
+	return e.Season == o.Season && strings.EqualFold(e.Show, o.Show)
+}
@@ -0,0 +1,43 @@
+package xdcc
+
+import (
+	"fmt"
+	"net"
+)
+
+// resolveBindAddress turns a local IP address or a network interface name
+// (e.g. "tun0") into the IP outgoing connections should be bound to.
+func resolveBindAddress(addr string) (net.IP, error) {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip, nil
+	}
+
+	iface, err := net.InterfaceByName(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bind address %q: %w", addr, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var fallback net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+
+	if fallback == nil {
+		return nil, fmt.Errorf("interface %s has no address", addr)
+	}
+	return fallback, nil
+}
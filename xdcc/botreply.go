@@ -0,0 +1,136 @@
+package xdcc
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BotReplyKind classifies the NOTICE/PRIVMSG replies sent by XDCC bots.
+type BotReplyKind int
+
+const (
+	BotReplyUnknown BotReplyKind = iota
+	BotReplyQueued
+	BotReplyQueueFull
+	BotReplyNoSlots
+	BotReplyLimitReached
+	BotReplyBanned
+	BotReplyInvalidPack
+	BotReplyAlreadyRequested
+)
+
+var (
+	ErrQueueFull        = errors.New("bot queue is full")
+	ErrNoSlots          = errors.New("no slots available")
+	ErrLimitReached     = errors.New("transfer limit reached")
+	ErrBanned           = errors.New("access denied by bot")
+	ErrInvalidPack      = errors.New("invalid pack")
+	ErrAlreadyRequested = errors.New("pack already requested")
+)
+
+var botReplyErrors = map[BotReplyKind]error{
+	BotReplyQueueFull:        ErrQueueFull,
+	BotReplyNoSlots:          ErrNoSlots,
+	BotReplyLimitReached:     ErrLimitReached,
+	BotReplyBanned:           ErrBanned,
+	BotReplyInvalidPack:      ErrInvalidPack,
+	BotReplyAlreadyRequested: ErrAlreadyRequested,
+}
+
+// BotError is the error carried by a rejecting bot reply. It matches the
+// corresponding Err* value with errors.Is.
+type BotError struct {
+	Kind    BotReplyKind
+	Message string // the original bot message
+}
+
+func (e *BotError) Error() string {
+	return botReplyErrors[e.Kind].Error() + ": " + e.Message
+}
+
+func (e *BotError) Is(target error) bool {
+	return botReplyErrors[e.Kind] == target
+}
+
+// BotReply is a parsed bot message.
+type BotReply struct {
+	Kind      BotReplyKind
+	Position  int           // queue position, 0 if unknown
+	Total     int           // queue length, 0 if unknown
+	Remaining time.Duration // wait announced for the queue, 0 if unknown
+	Text      string
+}
+
+// Err returns the error corresponding to the reply, or nil if the reply
+// doesn't reject the request.
+func (r BotReply) Err() error {
+	if _, ok := botReplyErrors[r.Kind]; !ok {
+		return nil
+	}
+	return &BotError{Kind: r.Kind, Message: r.Text}
+}
+
+// Fatal reports whether the request can't succeed anymore after the reply.
+func (r BotReply) Fatal() bool {
+	return r.Err() != nil && r.Kind != BotReplyAlreadyRequested
+}
+
+var (
+	// e.g. "in position 4 of 20" or "position #4 (of 20)".
+	queuePositionRe = regexp.MustCompile(`(?i)position\s+#?(\d+)(?:\s*\(?of\s+(\d+)\)?)?`)
+	// e.g. "0h16m or more remaining" (iroffer) or "12 minutes remaining".
+	queueRemainingRe = regexp.MustCompile(`(?i)(?:(\d+)\s*h\s*)?(\d+)\s*m(?:in(?:ute)?s?)?(?:\s+or\s+more)?\s+remaining`)
+)
+
+type botReplyRule struct {
+	kind     BotReplyKind
+	patterns []string
+}
+
+// botReplyRules are checked in order, so more specific rules come first
+// (e.g. "all slots full, added you to the queue" is a queued reply). The
+// temporary refusals go before the bans: "XDCC SEND denied, max transfers
+// reached" is only a limit.
+var botReplyRules = []botReplyRule{
+	{BotReplyInvalidPack, []string{"invalid pack", "no such pack", "pack not found", "does not exist"}},
+	{BotReplyAlreadyRequested, []string{"already requested", "already queued", "already in", "you already have"}},
+	{BotReplyQueueFull, []string{"queue is full", "queue full", "queues are full", "no room in queue"}},
+	{BotReplyQueued, []string{"added you to", "queued", "in position", "queue position"}},
+	{BotReplyLimitReached, []string{"limit reached", "transfer limit", "max transfers", "maximum number of transfers"}},
+	{BotReplyNoSlots, []string{"no free slots", "no slots", "all slots"}},
+	{BotReplyBanned, []string{"banned", "denied", "not allowed", "you are being ignored"}},
+}
+
+// ParseBotReply classifies a message sent by an XDCC bot.
+func ParseBotReply(text string) BotReply {
+	reply := BotReply{Kind: BotReplyUnknown, Text: text}
+	lower := strings.ToLower(text)
+
+	for _, rule := range botReplyRules {
+		for _, p := range rule.patterns {
+			if strings.Contains(lower, p) {
+				reply.Kind = rule.kind
+				break
+			}
+		}
+		if reply.Kind != BotReplyUnknown {
+			break
+		}
+	}
+
+	if reply.Kind == BotReplyQueued {
+		if m := queuePositionRe.FindStringSubmatch(text); m != nil {
+			reply.Position, _ = strconv.Atoi(m[1])
+			reply.Total, _ = strconv.Atoi(m[2])
+		}
+		if m := queueRemainingRe.FindStringSubmatch(text); m != nil {
+			hours, _ := strconv.Atoi(m[1])
+			minutes, _ := strconv.Atoi(m[2])
+			reply.Remaining = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+		}
+	}
+	return reply
+}
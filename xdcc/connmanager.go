@@ -0,0 +1,331 @@
+package xdcc
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/fluffle/goirc/client"
+)
+
+// DefaultIdleTimeout is how long an unused connection is kept open by a
+// ConnManager before quitting, so that consecutive transfers from the same
+// network do not pay for a new registration each time.
+const DefaultIdleTimeout = 2 * time.Minute
+
+// registerTimeout bounds the wait for the server to accept a new client.
+const registerTimeout = time.Minute
+
+var ErrConnManagerClosed = errors.New("connection manager closed")
+
+// ConnManager keeps registered IRC connections open and shares them
+// between transfers, so that several packs from the same network use a
+// single client. Connections are torn down once no transfer has used them
+// for the idle timeout.
+type ConnManager struct {
+	idleTimeout time.Duration
+
+	mtx    sync.Mutex
+	conns  map[string]*ManagedConn
+	closed bool
+}
+
+func NewConnManager(idleTimeout time.Duration) *ConnManager {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	return &ConnManager{
+		idleTimeout: idleTimeout,
+		conns:       make(map[string]*ManagedConn),
+	}
+}
+
+// ManagedConn is a connection handed out by a ConnManager. It must be
+// given back with Release once the caller is done with it.
+type ManagedConn struct {
+	manager *ConnManager
+	key     string
+	conn    *irc.Conn
+
+	ready     chan struct{} // closed once registration succeeded or failed
+	connected chan struct{} // closed once connected, before registration
+	err       error
+
+	// guarded by manager.mtx
+	refs int
+	idle *time.Timer
+
+	mtx        sync.Mutex
+	connectMtx sync.Mutex
+	channels   map[string]bool
+}
+
+func connKey(config *irc.Config) string {
+	skipVerify := config.SSLConfig != nil && config.SSLConfig.InsecureSkipVerify
+	return strings.Join([]string{
+		strings.ToLower(config.Server),
+		strconv.FormatBool(config.SSL),
+		strconv.FormatBool(skipVerify),
+		config.Pass,
+		config.LocalAddr,
+	}, "|")
+}
+
+// Acquire returns a registered connection to the server described by
+// config, reusing an existing one when possible. The nick of config is
+// only used when a new connection has to be opened.
+func (m *ConnManager) Acquire(config *irc.Config) (*ManagedConn, error) {
+	return m.AcquireNotify(config, nil)
+}
+
+// AcquireNotify is Acquire calling connected, if not nil, once connected
+// to the server, while the registration is still going on.
+func (m *ConnManager) AcquireNotify(config *irc.Config, connected func()) (*ManagedConn, error) {
+	key := connKey(config)
+
+	m.mtx.Lock()
+	if m.closed {
+		m.mtx.Unlock()
+		return nil, ErrConnManagerClosed
+	}
+	mc, ok := m.conns[key]
+	if ok && mc.isReady() && !mc.conn.Connected() && mc.refs == 0 {
+		// nobody is around to reconnect it.
+		m.removeLocked(mc)
+		ok = false
+	}
+	if !ok {
+		mc = m.newConn(key, config)
+		m.conns[key] = mc
+		go mc.register()
+	}
+	mc.refs++
+	if mc.idle != nil {
+		mc.idle.Stop()
+		mc.idle = nil
+	}
+	m.mtx.Unlock()
+
+	if connected != nil {
+		select {
+		case <-mc.connected:
+			connected()
+		case <-mc.ready:
+		}
+	}
+	<-mc.ready
+	if mc.err != nil {
+		m.mtx.Lock()
+		mc.refs--
+		m.removeLocked(mc)
+		m.mtx.Unlock()
+		return nil, mc.err
+	}
+	return mc, nil
+}
+
+// Release gives back a connection obtained with Acquire.
+func (m *ConnManager) Release(mc *ManagedConn) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	mc.refs--
+	if mc.refs > 0 || m.conns[mc.key] != mc {
+		return
+	}
+	mc.idle = time.AfterFunc(m.idleTimeout, func() {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+		if mc.refs == 0 && m.conns[mc.key] == mc {
+			m.removeLocked(mc)
+		}
+	})
+}
+
+// Close quits all connections. Transfers still using them are
+// disconnected.
+func (m *ConnManager) Close() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.closed = true
+	for _, mc := range m.conns {
+		m.removeLocked(mc)
+	}
+}
+
+// CloseIdle quits the connections no transfer is using, without waiting
+// for their idle timeout.
+func (m *ConnManager) CloseIdle() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for _, mc := range m.conns {
+		if mc.refs == 0 {
+			m.removeLocked(mc)
+		}
+	}
+}
+
+// ConnInfo describes an open connection of a ConnManager.
+type ConnInfo struct {
+	Server string
+	Nick   string
+}
+
+// Connections lists the registered connections currently connected,
+// sorted by server.
+func (m *ConnManager) Connections() []ConnInfo {
+	m.mtx.Lock()
+	conns := make([]*ManagedConn, 0, len(m.conns))
+	for _, mc := range m.conns {
+		if mc.isReady() && mc.err == nil {
+			conns = append(conns, mc)
+		}
+	}
+	m.mtx.Unlock()
+
+	infos := make([]ConnInfo, 0, len(conns))
+	for _, mc := range conns {
+		if !mc.conn.Connected() {
+			continue
+		}
+		infos = append(infos, ConnInfo{Server: mc.conn.Config().Server, Nick: mc.conn.Me().Nick})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Server < infos[j].Server
+	})
+	return infos
+}
+
+func (m *ConnManager) removeLocked(mc *ManagedConn) {
+	if m.conns[mc.key] == mc {
+		delete(m.conns, mc.key)
+	}
+	if mc.idle != nil {
+		mc.idle.Stop()
+		mc.idle = nil
+	}
+	if mc.conn.Connected() {
+		mc.conn.Quit()
+	}
+}
+
+func (m *ConnManager) newConn(key string, config *irc.Config) *ManagedConn {
+	mc := &ManagedConn{
+		manager:   m,
+		key:       key,
+		conn:      irc.Client(config),
+		ready:     make(chan struct{}),
+		connected: make(chan struct{}),
+		channels:  make(map[string]bool),
+	}
+	mc.trackChannels()
+	return mc
+}
+
+func (mc *ManagedConn) isReady() bool {
+	select {
+	case <-mc.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func (mc *ManagedConn) register() {
+	registered := make(chan struct{}, 1)
+	disconnected := make(chan struct{}, 1)
+	rmConnected := mc.conn.HandleFunc(irc.CONNECTED, func(*irc.Conn, *irc.Line) {
+		select {
+		case registered <- struct{}{}:
+		default:
+		}
+	})
+	rmDisconnected := mc.conn.HandleFunc(irc.DISCONNECTED, func(*irc.Conn, *irc.Line) {
+		select {
+		case disconnected <- struct{}{}:
+		default:
+		}
+	})
+	defer rmConnected.Remove()
+	defer rmDisconnected.Remove()
+
+	if err := mc.conn.Connect(); err != nil {
+		mc.err = err
+		close(mc.ready)
+		return
+	}
+	close(mc.connected)
+
+	select {
+	case <-registered:
+	case <-disconnected:
+		mc.err = errors.New("disconnected before registration")
+	case <-time.After(registerTimeout):
+		mc.err = errors.New("registration timed out")
+		mc.conn.Quit()
+	}
+	close(mc.ready)
+}
+
+// trackChannels keeps the set of joined channels up to date, so that a
+// transfer can tell whether it still has to join its channel.
+func (mc *ManagedConn) trackChannels() {
+	mc.conn.HandleFunc(irc.JOIN, func(conn *irc.Conn, line *irc.Line) {
+		if isOwnJoin(conn, line) && len(line.Args) > 0 {
+			mc.setChannel(line.Args[0], true)
+		}
+	})
+	mc.conn.HandleFunc(irc.PART, func(conn *irc.Conn, line *irc.Line) {
+		if isOwnJoin(conn, line) && len(line.Args) > 0 {
+			mc.setChannel(line.Args[0], false)
+		}
+	})
+	mc.conn.HandleFunc(irc.KICK, func(conn *irc.Conn, line *irc.Line) {
+		if len(line.Args) > 1 && strings.EqualFold(line.Args[1], conn.Me().Nick) {
+			mc.setChannel(line.Args[0], false)
+		}
+	})
+	mc.conn.HandleFunc(irc.DISCONNECTED, func(*irc.Conn, *irc.Line) {
+		mc.mtx.Lock()
+		mc.channels = make(map[string]bool)
+		mc.mtx.Unlock()
+	})
+}
+
+func (mc *ManagedConn) setChannel(channel string, joined bool) {
+	mc.mtx.Lock()
+	defer mc.mtx.Unlock()
+	if joined {
+		mc.channels[strings.ToLower(channel)] = true
+	} else {
+		delete(mc.channels, strings.ToLower(channel))
+	}
+}
+
+// Conn returns the underlying client.
+func (mc *ManagedConn) Conn() *irc.Conn {
+	return mc.conn
+}
+
+// InChannel reports whether the connection has joined channel.
+func (mc *ManagedConn) InChannel(channel string) bool {
+	mc.mtx.Lock()
+	defer mc.mtx.Unlock()
+	return mc.channels[strings.ToLower(channel)]
+}
+
+// reconnect connects again after a disconnection. Several transfers may
+// ask at once: only the first one actually reconnects.
+func (mc *ManagedConn) reconnect() error {
+	mc.connectMtx.Lock()
+	defer mc.connectMtx.Unlock()
+	if mc.conn.Connected() {
+		return nil
+	}
+	return mc.conn.Connect()
+}
@@ -0,0 +1,131 @@
+package xdcc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// PortRange restricts the local ports used when listening for incoming DCC
+// connections (reverse DCC), so that exactly those ports can be opened on a
+// firewall or forwarded on a router. The zero value lets the OS pick any
+// free port.
+type PortRange struct {
+	Min int
+	Max int
+}
+
+var ErrNoFreePort = errors.New("no free port in the configured DCC port range")
+
+func (r PortRange) isSet() bool {
+	return r.Min > 0 && r.Max >= r.Min
+}
+
+func (r PortRange) String() string {
+	if !r.isSet() {
+		return "any"
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// listen opens a TCP listener on the first free port of the range, on the
+// given local address (nil for all addresses).
+func (r PortRange) listen(ip net.IP) (*net.TCPListener, error) {
+	if !r.isSet() {
+		return net.ListenTCP("tcp4", &net.TCPAddr{IP: ip})
+	}
+
+	for port := r.Min; port <= r.Max; port++ {
+		l, err := net.ListenTCP("tcp4", &net.TCPAddr{IP: ip, Port: port})
+		if err == nil {
+			return l, nil
+		}
+	}
+	return nil, ErrNoFreePort
+}
+
+const passiveAcceptTimeout = 2 * time.Minute
+
+func ipToUint32(ip net.IP) uint32 {
+	ip = ip.To4()
+	if ip == nil {
+		return 0
+	}
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+// outboundIP returns the local address used to reach the given server.
+func outboundIP(server string, bindIP net.IP) (net.IP, error) {
+	if bindIP != nil {
+		return bindIP, nil
+	}
+	conn, err := net.Dial("udp4", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// advertisedIP returns the address sent to bots for reverse DCC: the
+// configured external IP, the one discovered via STUN, or else the local
+// address used to reach the IRC server.
+func (transfer *XdccTransfer) advertisedIP() (net.IP, error) {
+	switch transfer.externalIP {
+	case "":
+	case ExternalIPAuto:
+		server := transfer.stunServer
+		if server == "" {
+			server = DefaultSTUNServer
+		}
+		if ip, err := discoverExternalIP(server, transfer.bindIP); err == nil {
+			return ip, nil
+		}
+	default:
+		if ip := net.ParseIP(transfer.externalIP).To4(); ip != nil {
+			return ip, nil
+		}
+		return nil, fmt.Errorf("invalid external IP: %s", transfer.externalIP)
+	}
+	return outboundIP(transfer.conn.Config().Server, transfer.bindIP)
+}
+
+// acceptPassive handles a reverse DCC offer (port 0 + token): it listens on
+// a local port, tells the bot where to connect and waits for the connection.
+func (transfer *XdccTransfer) acceptPassive(send *XdccSendRes) (net.Conn, error) {
+	l, err := transfer.listenPorts.listen(transfer.bindIP)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	ip, err := transfer.advertisedIP()
+	if err != nil {
+		return nil, err
+	}
+
+	port := l.Addr().(*net.TCPAddr).Port
+	transfer.conn.Ctcp(transfer.url.UserName, "DCC", SEND, quoteCTCPArg(send.RawFileName),
+		strconv.FormatUint(uint64(ipToUint32(ip)), 10), strconv.Itoa(port),
+		strconv.Itoa(send.FileSize), send.Token)
+
+	if err := l.SetDeadline(time.Now().Add(passiveAcceptTimeout)); err != nil {
+		return nil, err
+	}
+	return l.Accept()
+}
+
+// openDCCConn establishes the data connection for a DCC offer, either by
+// connecting to the bot or, for reverse DCC, by waiting for the bot.
+func (transfer *XdccTransfer) openDCCConn(send *XdccSendRes) (net.Conn, error) {
+	if send.isPassive() {
+		return transfer.acceptPassive(send)
+	}
+	var local *net.TCPAddr
+	if transfer.bindIP != nil {
+		local = &net.TCPAddr{IP: transfer.bindIP}
+	}
+	return net.DialTCP("tcp", local, &net.TCPAddr{IP: send.IP, Port: send.Port})
+}
@@ -0,0 +1,50 @@
+package xdcc
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+var (
+	ErrFreeSpaceUnknown = errors.New("free space unknown on this platform")
+	ErrDiskFull         = errors.New("disk full")
+)
+
+// InsufficientSpaceError is returned when the file announced by the bot
+// does not fit in the download directory.
+type InsufficientSpaceError struct {
+	Needed    uint64
+	Available uint64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space: %d bytes needed, %d available", e.Needed, e.Available)
+}
+
+// FreeSpace returns the space available in dir, or ErrFreeSpaceUnknown
+// when it cannot be determined.
+func FreeSpace(dir string) (uint64, error) {
+	if dir == "" {
+		dir = "."
+	}
+	return freeSpace(dir)
+}
+
+// checkFreeSpace fails when size bytes don't fit in dir. Platforms where
+// the free space is unknown always pass.
+func checkFreeSpace(dir string, size uint64) error {
+	free, err := FreeSpace(dir)
+	if err != nil || size <= free {
+		return nil
+	}
+	return &InsufficientSpaceError{Needed: size, Available: free}
+}
+
+// diskError makes a full disk explicit in write errors.
+func diskError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %s", ErrDiskFull, err)
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package xdcc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Steps of a transfer whose failures are reported as an OpError.
+const (
+	OpParseOffer  = "parse_offer"
+	OpConnectDCC  = "connect_dcc"
+	OpPreallocate = "preallocate"
+	OpMoveFile    = "move_file"
+)
+
+var opMessages = map[string]string{
+	OpParseOffer:  "invalid DCC offer",
+	OpConnectDCC:  "unable to open DCC connection",
+	OpPreallocate: "unable to preallocate the file",
+	OpMoveFile:    "unable to move completed file",
+}
+
+var ErrTooManyAttempts = errors.New("too many connection attempts")
+
+// OpError is the failure of a step of a transfer, with its cause. Like
+// the other typed errors of the package it lets user interfaces word the
+// failure themselves.
+type OpError struct {
+	Op  string
+	Err error
+}
+
+func (e *OpError) Error() string {
+	return opMessages[e.Op] + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// IncompleteError is returned when the bot closed the connection before
+// the whole file was received.
+type IncompleteError struct {
+	Written uint64
+	Size    uint64
+}
+
+func (e *IncompleteError) Error() string {
+	return fmt.Sprintf("connection closed after %d of %d bytes", e.Written, e.Size)
+}
@@ -0,0 +1,54 @@
+package xdcc
+
+import "sync"
+
+// eventHub fans the events of a transfer out to every subscriber, so that
+// several consumers (UI, logger, notifier...) can follow the same transfer
+// without stealing events from each other.
+type eventHub struct {
+	mtx  sync.Mutex
+	subs []chan TransferEvent
+	poll chan TransferEvent // default subscription returned by PollEvents
+}
+
+func newEventHub() *eventHub {
+	hub := &eventHub{}
+	hub.poll = hub.Subscribe()
+	return hub
+}
+
+// Subscribe returns a new channel receiving every event published from now
+// on. Slow subscribers drop events instead of blocking the transfer.
+func (hub *eventHub) Subscribe() chan TransferEvent {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	ch := make(chan TransferEvent, defaultEventChanSize)
+	hub.subs = append(hub.subs, ch)
+	return ch
+}
+
+// Unsubscribe stops delivering events to ch.
+func (hub *eventHub) Unsubscribe(ch chan TransferEvent) {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	for i, sub := range hub.subs {
+		if sub == ch {
+			hub.subs = append(hub.subs[:i], hub.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (hub *eventHub) Publish(e TransferEvent) {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	for _, ch := range hub.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
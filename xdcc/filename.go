@@ -0,0 +1,78 @@
+package xdcc
+
+import (
+	"strings"
+	"unicode"
+)
+
+const fallbackFileName = "download"
+
+// SanitizeFileName reduces a bot-supplied file name to a single safe path
+// component: directory parts, "..", control characters and characters
+// that are invalid on common filesystems are removed, so that a malicious
+// bot can't write outside the downloads directory.
+func SanitizeFileName(name string) string {
+	name = strings.Trim(name, "\"")
+
+	// keep only the last path component, whatever the separator
+	if idx := strings.LastIndexAny(name, `/\`); idx >= 0 {
+		name = name[idx+1:]
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+
+	// no hidden files, no "." or "..", no trailing dots/spaces (Windows)
+	name = strings.TrimLeft(name, ". ")
+	name = strings.TrimRight(name, ". ")
+
+	if name == "" {
+		return fallbackFileName
+	}
+	return name
+}
+
+// splitCTCPArgs splits a CTCP argument string on whitespace, keeping
+// double-quoted arguments (e.g. file names with spaces) together.
+func splitCTCPArgs(text string) []string {
+	args := make([]string, 0)
+	var current strings.Builder
+	inQuotes := false
+	hasArg := false
+
+	for _, r := range text {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case unicode.IsSpace(r) && !inQuotes:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// quoteCTCPArg quotes arguments containing spaces, see splitCTCPArgs.
+func quoteCTCPArg(arg string) string {
+	if strings.ContainsAny(arg, " \t") {
+		return `"` + arg + `"`
+	}
+	return arg
+}
@@ -0,0 +1,49 @@
+package xdcc
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// moveFile renames src to dst, copying the data when they are on
+// different filesystems (e.g. an incomplete directory on a local disk and
+// the library on a NAS).
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// copy under a temporary name so that dst only appears once complete.
+	tmp := dst + partFileSuffix
+	out, err := os.OpenFile(tmp, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return diskError(err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return diskError(err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
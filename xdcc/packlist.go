@@ -0,0 +1,199 @@
+package xdcc
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Pack is an entry of the pack list of a bot.
+type Pack struct {
+	Slot int
+	Gets int   // -1 if the bot didn't tell
+	Size int64 // -1 if the bot didn't tell
+	Name string
+}
+
+const (
+	// packListWait bounds the wait for the first line of the list, and
+	// packListIdle the silence after which the list is considered complete.
+	packListWait = 30 * time.Second
+	packListIdle = 5 * time.Second
+	joinWait     = 15 * time.Second
+)
+
+var (
+	ErrNoPackList       = errors.New("the bot didn't send a pack list")
+	ErrPackListAsFile   = errors.New("the bot sends its pack list as a file")
+	ircFormattingRegexp = regexp.MustCompile("\x03[0-9]{0,2}(,[0-9]{1,2})?|[\x02\x0f\x16\x1d\x1f]")
+	// e.g. "#12  34x [1.4G] Some.File.mkv", the usual iroffer format.
+	packLineRegexp = regexp.MustCompile(`^#(\d+)\s+(?:(\d+)x\s+)?\[\s*([\d.]+\s*[KMGT]?)B?\s*\]\s+(.+?)\s*$`)
+)
+
+// parsePackLine parses a line of an "xdcc list" reply; other lines (the
+// header, the bandwidth summary...) are not packs.
+func parsePackLine(text string) (Pack, bool) {
+	text = strings.TrimSpace(ircFormattingRegexp.ReplaceAllString(text, ""))
+	m := packLineRegexp.FindStringSubmatch(text)
+	if m == nil {
+		return Pack{}, false
+	}
+	slot, err := strconv.Atoi(m[1])
+	if err != nil {
+		return Pack{}, false
+	}
+	gets := -1
+	if m[2] != "" {
+		gets, _ = strconv.Atoi(m[2])
+	}
+	return Pack{Slot: slot, Gets: gets, Size: parsePackSize(m[3]), Name: m[4]}, true
+}
+
+// parsePackSize parses sizes such as "1.4G" or "700M", -1 if invalid.
+func parsePackSize(s string) int64 {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	mult := float64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			s = s[:n-1]
+		}
+	}
+	size, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return -1
+	}
+	return int64(size * mult)
+}
+
+// ListPacks asks the bot of c.File for its pack list ("xdcc list") and
+// collects the packs it announces by message or notice. The list is
+// complete once the bot stayed quiet for a few seconds. The connection is
+// shared through c.Connections when set.
+func ListPacks(c Config) ([]Pack, error) {
+	manager := c.Connections
+	if manager == nil {
+		manager = NewConnManager(0)
+		defer manager.Close()
+	}
+
+	mc, err := acquireListConn(c, manager)
+	if err != nil {
+		return nil, err
+	}
+	defer manager.Release(mc)
+	conn := mc.Conn()
+	bot := c.File.UserName
+
+	lines := make(chan string, 256)
+	asFile := make(chan struct{}, 1)
+	joined := make(chan struct{}, 1)
+	fromBot := func(line *irc.Line) bool {
+		return !line.Public() && strings.EqualFold(line.Nick, bot)
+	}
+	onMessage := func(conn *irc.Conn, line *irc.Line) {
+		if !fromBot(line) {
+			return
+		}
+		select {
+		case lines <- line.Text():
+		default:
+		}
+	}
+	removers := []irc.Remover{
+		conn.HandleFunc(irc.PRIVMSG, onMessage),
+		conn.HandleFunc(irc.NOTICE, onMessage),
+		conn.HandleFunc(irc.CTCP, func(conn *irc.Conn, line *irc.Line) {
+			if len(line.Args) > 0 && line.Args[0] == "DCC" && fromBot(line) {
+				select {
+				case asFile <- struct{}{}:
+				default:
+				}
+			}
+		}),
+		conn.HandleFunc(irc.JOIN, func(conn *irc.Conn, line *irc.Line) {
+			if isOwnJoin(conn, line) && len(line.Args) > 0 && containsChannel(c.File.Channels(), line.Args[0]) {
+				select {
+				case joined <- struct{}{}:
+				default:
+				}
+			}
+		}),
+	}
+	defer func() {
+		for _, r := range removers {
+			r.Remove()
+		}
+	}()
+
+	// many bots only answer users sitting in their channel.
+	if channels := c.File.Channels(); len(channels) > 0 && !mc.InChannel(channels[0]) {
+		conn.Join(channels[0])
+		select {
+		case <-joined:
+		case <-time.After(joinWait):
+		}
+	}
+	conn.Privmsg(bot, "xdcc list")
+
+	packs := make([]Pack, 0)
+	timeout := time.NewTimer(packListWait)
+	defer timeout.Stop()
+	for {
+		select {
+		case text := <-lines:
+			if pack, ok := parsePackLine(text); ok {
+				packs = append(packs, pack)
+			}
+			if !timeout.Stop() {
+				<-timeout.C
+			}
+			timeout.Reset(packListIdle)
+		case <-asFile:
+			if len(packs) == 0 {
+				return nil, ErrPackListAsFile
+			}
+		case <-timeout.C:
+			if len(packs) == 0 {
+				return nil, ErrNoPackList
+			}
+			return packs, nil
+		}
+	}
+}
+
+// acquireListConn connects like a transfer does: TLS first, then TLS
+// without certificate check, then plain text unless TLS is required.
+func acquireListConn(c Config, manager *ConnManager) (*ManagedConn, error) {
+	attempts := [][2]bool{{true, false}, {true, true}}
+	if !c.SSLOnly && !c.File.SSL {
+		attempts = append(attempts, [2]bool{false, false})
+	}
+	c.Connections = manager
+
+	var err error
+	for _, a := range attempts {
+		t := newXdccTransfer(c, a[0], a[1], newEventHub())
+		if t.bindErr != nil {
+			return nil, t.bindErr
+		}
+		var mc *ManagedConn
+		if mc, err = manager.Acquire(t.ircConfig); err == nil {
+			return mc, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package xdcc
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate reserves size bytes on disk for file, failing with ENOSPC
+// when the disk can't hold it.
+func preallocate(file *os.File, size int64) error {
+	err := syscall.Fallocate(int(file.Fd()), 0, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return file.Truncate(size)
+	}
+	return err
+}
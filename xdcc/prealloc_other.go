@@ -0,0 +1,11 @@
+//go:build !linux
+
+package xdcc
+
+import "os"
+
+// preallocate extends file to size bytes. On platforms without fallocate
+// this doesn't guarantee the space is reserved.
+func preallocate(file *os.File, size int64) error {
+	return file.Truncate(size)
+}
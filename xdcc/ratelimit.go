@@ -0,0 +1,203 @@
+package xdcc
+
+import (
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"xdcc-tui/util"
+)
+
+// rebalanceInterval is how often a RateLimiter recomputes the share of
+// each transfer from their recent throughput.
+const rebalanceInterval = time.Second
+
+// minStreamRate keeps a transfer that received nothing lately able to
+// pick up speed again, in bytes/s.
+const minStreamRate = 4 * 1024
+
+// RateLimiter caps the combined speed of the transfers sharing it. The
+// budget is split between the transfers by weight, and what a transfer
+// can't use (a slow bot) goes to the others, so that a fast transfer
+// doesn't starve the ones that started later.
+type RateLimiter struct {
+	mtx          sync.Mutex
+	rate         float64 // bytes/s, 0 for unlimited
+	streams      map[*limitedReader]struct{}
+	lastBalanced time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate bytes per second in
+// total; 0 means unlimited.
+func NewRateLimiter(rate int64) *RateLimiter {
+	return &RateLimiter{
+		rate:    float64(util.MaxInt64(rate, 0)),
+		streams: make(map[*limitedReader]struct{}),
+	}
+}
+
+// SetRate changes the total rate, 0 removing the limit.
+func (l *RateLimiter) SetRate(rate int64) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.rate = float64(util.MaxInt64(rate, 0))
+	l.rebalanceLocked(time.Now())
+}
+
+// Rate returns the total rate in bytes/s, 0 when unlimited.
+func (l *RateLimiter) Rate() int64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return int64(l.rate)
+}
+
+// limitedReader is a transfer's stream throttled by a RateLimiter. Its
+// fields are guarded by the limiter's mutex.
+type limitedReader struct {
+	limiter *RateLimiter
+	r       io.Reader
+	weight  float64
+
+	alloc  float64 // bytes/s currently allowed
+	tokens float64
+	last   time.Time
+	used   float64 // bytes read since the last rebalance
+}
+
+// reader throttles r as one of the transfers sharing the limit; a higher
+// weight gets a larger share. It must be closed once the transfer ends.
+func (l *RateLimiter) reader(r io.Reader, weight int) *limitedReader {
+	if weight < 1 {
+		weight = 1
+	}
+	lr := &limitedReader{limiter: l, r: r, weight: float64(weight), last: time.Now()}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.streams[lr] = struct{}{}
+	l.rebalanceLocked(time.Now())
+	return lr
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	l := lr.limiter
+	l.mtx.Lock()
+	if alloc := lr.alloc; alloc > 0 {
+		// read at most a tenth of a second worth of data at once, so that
+		// the pace stays smooth.
+		if max := int(math.Max(alloc/10, 512)); len(p) > max {
+			p = p[:max]
+		}
+	}
+	l.mtx.Unlock()
+
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		lr.take(n)
+	}
+	return n, err
+}
+
+// take accounts for n bytes received and sleeps until the stream is back
+// within its allocation.
+func (lr *limitedReader) take(n int) {
+	l := lr.limiter
+	l.mtx.Lock()
+	now := time.Now()
+	lr.used += float64(n)
+	if now.Sub(l.lastBalanced) >= rebalanceInterval {
+		l.rebalanceLocked(now)
+	}
+	if lr.alloc <= 0 {
+		lr.last = now
+		l.mtx.Unlock()
+		return
+	}
+	lr.tokens += now.Sub(lr.last).Seconds() * lr.alloc
+	// allow bursts of a quarter of a second at most.
+	lr.tokens = math.Min(lr.tokens, lr.alloc/4)
+	lr.tokens -= float64(n)
+	lr.last = now
+	wait := time.Duration(-lr.tokens / lr.alloc * float64(time.Second))
+	l.mtx.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Allocation returns the rate in bytes/s the stream is allowed, 0 when
+// unlimited.
+func (lr *limitedReader) Allocation() float64 {
+	lr.limiter.mtx.Lock()
+	defer lr.limiter.mtx.Unlock()
+	return lr.alloc
+}
+
+// Close removes the stream from the limiter, giving its share back.
+func (lr *limitedReader) Close() {
+	l := lr.limiter
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	delete(l.streams, lr)
+	l.rebalanceLocked(time.Now())
+}
+
+// rebalanceLocked splits the rate by weight between the streams, max-min
+// fair: a stream that used clearly less than its share last period only
+// keeps a bit more than what it used, the rest is shared by the others.
+func (l *RateLimiter) rebalanceLocked(now time.Time) {
+	elapsed := now.Sub(l.lastBalanced).Seconds()
+	l.lastBalanced = now
+
+	if l.rate <= 0 {
+		for s := range l.streams {
+			s.alloc = 0
+			s.used = 0
+		}
+		return
+	}
+
+	// the demand of each stream, +Inf when it could use more.
+	demand := make(map[*limitedReader]float64, len(l.streams))
+	for s := range l.streams {
+		demand[s] = math.Inf(1)
+		if s.alloc > 0 && elapsed >= rebalanceInterval.Seconds()/2 && elapsed < 10*rebalanceInterval.Seconds() {
+			if used := s.used / elapsed; used < 0.9*s.alloc {
+				demand[s] = math.Max(used*1.25, minStreamRate)
+			}
+		}
+		s.used = 0
+	}
+
+	// water-filling: satisfy the smallest demands first, splitting what
+	// is left by weight.
+	remaining := l.rate
+	pending := make(map[*limitedReader]struct{}, len(l.streams))
+	for s := range l.streams {
+		pending[s] = struct{}{}
+	}
+	for len(pending) > 0 {
+		var weights float64
+		for s := range pending {
+			weights += s.weight
+		}
+		satisfied := false
+		for s := range pending {
+			if share := remaining * s.weight / weights; demand[s] <= share {
+				s.alloc = demand[s]
+				remaining -= demand[s]
+				delete(pending, s)
+				satisfied = true
+			}
+		}
+		if satisfied {
+			continue
+		}
+		for s := range pending {
+			s.alloc = remaining * s.weight / weights
+		}
+		break
+	}
+}
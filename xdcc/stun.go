@@ -0,0 +1,126 @@
+package xdcc
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultSTUNServer is queried to discover the external address when
+// Config.ExternalIP is ExternalIPAuto.
+const DefaultSTUNServer = "stun.l.google.com:19302"
+
+// ExternalIPAuto asks for the external IP to be discovered via STUN.
+const ExternalIPAuto = "auto"
+
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingSuccess  = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunHeaderSize      = 20
+	stunAttrMapped      = 0x0001
+	stunAttrXorMapped   = 0x0020
+	stunFamilyIPv4      = 0x01
+	stunResponseTimeout = 3 * time.Second
+)
+
+var errSTUNResponse = errors.New("invalid STUN response")
+
+var (
+	stunMtx   sync.Mutex
+	stunCache = make(map[string]net.IP)
+)
+
+// discoverExternalIP returns the public IPv4 address seen by the STUN
+// server when sending from localIP (nil for the default route). Results
+// are cached for the lifetime of the process.
+func discoverExternalIP(server string, localIP net.IP) (net.IP, error) {
+	stunMtx.Lock()
+	defer stunMtx.Unlock()
+
+	key := server + "|" + localIP.String()
+	if ip, ok := stunCache[key]; ok {
+		return ip, nil
+	}
+
+	ip, err := stunQuery(server, localIP)
+	if err != nil {
+		return nil, err
+	}
+	stunCache[key] = ip
+	return ip, nil
+}
+
+func stunQuery(server string, localIP net.IP) (net.IP, error) {
+	dialer := net.Dialer{}
+	if localIP != nil {
+		dialer.LocalAddr = &net.UDPAddr{IP: localIP}
+	}
+	conn, err := dialer.Dial("udp4", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(stunResponseTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, 512)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	return parseSTUNResponse(resp[:n], req[8:20])
+}
+
+func parseSTUNResponse(resp []byte, txID []byte) (net.IP, error) {
+	if len(resp) < stunHeaderSize ||
+		binary.BigEndian.Uint16(resp[0:]) != stunBindingSuccess ||
+		string(resp[8:20]) != string(txID) {
+		return nil, errSTUNResponse
+	}
+
+	attrs := resp[stunHeaderSize:]
+	var mapped net.IP
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:]))
+		if len(attrs) < 4+attrLen {
+			break
+		}
+		value := attrs[4 : 4+attrLen]
+
+		if attrLen >= 8 && value[1] == stunFamilyIPv4 {
+			switch attrType {
+			case stunAttrXorMapped:
+				var ip [4]byte
+				binary.BigEndian.PutUint32(ip[:], binary.BigEndian.Uint32(value[4:8])^stunMagicCookie)
+				return net.IP(ip[:]), nil
+			case stunAttrMapped:
+				mapped = net.IP(append([]byte{}, value[4:8]...))
+			}
+		}
+
+		// attributes are padded to 4 bytes
+		attrs = attrs[4+(attrLen+3)&^3:]
+	}
+
+	if mapped == nil {
+		return nil, errSTUNResponse
+	}
+	return mapped, nil
+}
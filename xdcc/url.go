@@ -1,14 +1,19 @@
 package xdcc
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type IRCFile struct {
 	Network  string
+	Port     int  // 0 means the default port for the connection type
+	SSL      bool // set by the ircs:// scheme
 	Channel  string
 	UserName string
 	Slot     int
@@ -22,22 +27,84 @@ type IRCBot struct {
 
 const ircFileURLFields = 4
 
+const (
+	ircScheme  = "irc://"
+	ircsScheme = "ircs://"
+)
+
 func parseSlot(slotStr string) (int, error) {
-	if strings.HasPrefix(slotStr, "#") {
-		strconv.Atoi(strings.TrimPrefix(slotStr, "#"))
-	}
-	return strconv.Atoi(slotStr)
+	return strconv.Atoi(strings.TrimPrefix(slotStr, "#"))
 }
 
 var ErrInvalidURL = errors.New("invalid IRC url")
 
-// url has the following format: irc://network/channel/bot/slot
+var (
+	aliasMtx       sync.RWMutex
+	networkAliases = make(map[string]string)
+)
+
+// RegisterNetworkAlias makes ParseURL resolve alias (e.g. "rizon") to the
+// given network address (e.g. "irc.rizon.net" or "irc.rizon.net:6697").
+func RegisterNetworkAlias(alias, network string) {
+	aliasMtx.Lock()
+	defer aliasMtx.Unlock()
+	networkAliases[strings.ToLower(alias)] = network
+}
+
+func resolveNetworkAlias(network string) string {
+	aliasMtx.RLock()
+	defer aliasMtx.RUnlock()
+	if resolved, ok := networkAliases[strings.ToLower(network)]; ok {
+		return resolved
+	}
+	return network
+}
+
+func splitHostPort(network string) (string, int, error) {
+	idx := strings.LastIndex(network, ":")
+	if idx < 0 || idx < strings.LastIndex(network, "]") {
+		return network, 0, nil
+	}
+	port, err := strconv.Atoi(network[idx+1:])
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, ErrInvalidURL
+	}
+	return network[:idx], port, nil
+}
+
+func normalizeChannels(channels string) string {
+	list := make([]string, 0)
+	for _, ch := range strings.Split(channels, ",") {
+		ch = strings.TrimSpace(ch)
+		if ch == "" {
+			continue
+		}
+		if !strings.HasPrefix(ch, "#") && !strings.HasPrefix(ch, "&") {
+			ch = "#" + ch
+		}
+		list = append(list, ch)
+	}
+	return strings.Join(list, ",")
+}
+
+// url has the following format: irc[s]://network[:port]/channel[,channel...]/bot/[#]slot
+// The ircs scheme requests a TLS connection. Network may be an alias
+// registered with RegisterNetworkAlias.
 func ParseURL(url string) (*IRCFile, error) {
-	if !strings.HasPrefix(url, "irc://") {
+	url = strings.TrimSpace(strings.ReplaceAll(url, "%23", "#"))
+
+	var ssl bool
+	switch {
+	case strings.HasPrefix(url, ircScheme):
+		url = strings.TrimPrefix(url, ircScheme)
+	case strings.HasPrefix(url, ircsScheme):
+		url = strings.TrimPrefix(url, ircsScheme)
+		ssl = true
+	default:
 		return nil, ErrInvalidURL
 	}
 
-	fields := strings.Split(strings.TrimPrefix(url, "irc://"), "/")
+	fields := strings.Split(strings.TrimSuffix(url, "/"), "/")
 	if len(fields) != ircFileURLFields {
 		return nil, ErrInvalidURL
 	}
@@ -47,23 +114,94 @@ func ParseURL(url string) (*IRCFile, error) {
 		return nil, err
 	}
 
+	network, port, err := splitHostPort(resolveNetworkAlias(fields[0]))
+	if err != nil {
+		return nil, err
+	}
+
 	fileUrl := &IRCFile{
-		Network:  fields[0],
-		Channel:  fields[1],
+		Network:  network,
+		Port:     port,
+		SSL:      ssl,
+		Channel:  normalizeChannels(fields[1]),
 		UserName: fields[2],
 		Slot:     slot,
 	}
 
-	if !strings.HasPrefix(fileUrl.Channel, "#") {
-		fileUrl.Channel = "#" + fileUrl.Channel
+	if fileUrl.Network == "" || fileUrl.Channel == "" || fileUrl.UserName == "" {
+		return nil, ErrInvalidURL
 	}
 	return fileUrl, nil
 }
 
+// URLListError reports an invalid line of an url list.
+type URLListError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *URLListError) Error() string {
+	return fmt.Sprintf("line %d: %q: %s", e.Line, e.Text, e.Err)
+}
+
+func (e *URLListError) Unwrap() error {
+	return e.Err
+}
+
+// ParseURLList reads one url per line; blank lines and lines starting
+// with "#" are ignored. Invalid lines are reported as *URLListError
+// without stopping the parsing; the returned error is a read error.
+func ParseURLList(r io.Reader) ([]*IRCFile, []error, error) {
+	files := make([]*IRCFile, 0)
+	invalid := make([]error, 0)
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		file, err := ParseURL(text)
+		if err != nil {
+			invalid = append(invalid, &URLListError{Line: line, Text: text, Err: err})
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, invalid, scanner.Err()
+}
+
+// Channels returns the list of channels to join before requesting the file.
+func (url *IRCFile) Channels() []string {
+	return strings.Split(url.Channel, ",")
+}
+
+// Address returns the server address to dial, including the port if one
+// was given in the url.
+func (url *IRCFile) Address() string {
+	if url.Port == 0 {
+		return url.Network
+	}
+	return url.Network + ":" + strconv.Itoa(url.Port)
+}
+
+// BotKey identifies the bot serving the file across channels, e.g. to
+// limit the requests sent to the same bot.
+func (url *IRCFile) BotKey() string {
+	return strings.ToLower(url.Network + "/" + url.UserName)
+}
+
 func (url *IRCFile) GetBot() IRCBot {
 	return IRCBot{Network: url.Network, Channel: url.Channel, Name: url.UserName}
 }
 
 func (url *IRCFile) String() string {
-	return fmt.Sprintf("irc://%s/%s/%s/%d", url.Network, url.Channel, url.UserName, url.Slot)
+	scheme := ircScheme
+	if url.SSL {
+		scheme = ircsScheme
+	}
+	return fmt.Sprintf("%s%s/%s/%s/%d", scheme, url.Address(), url.Channel, url.UserName, url.Slot)
 }
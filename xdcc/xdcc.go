@@ -2,19 +2,25 @@ package xdcc
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
-	"log"
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	irc "github.com/fluffle/goirc/client"
+
+	"xdcc-tui/util"
 )
 
 const IRCClientUserName = "xdcc-cli"
@@ -28,19 +34,38 @@ type CTCPResponse interface {
 	Name() string
 }
 
+// DefaultRequestTemplate is the request understood by most bots.
+const DefaultRequestTemplate = "xdcc send #{slot}"
+
 type XdccSendReq struct {
 	Slot int
+	Bot  string
+	// Template is the request text; {slot} and {bot} are replaced with
+	// the pack number and the bot name. Empty means DefaultRequestTemplate.
+	Template string
 }
 
 func (send *XdccSendReq) String() string {
-	return fmt.Sprintf("xdcc send #%d", send.Slot)
+	template := send.Template
+	if template == "" {
+		template = DefaultRequestTemplate
+	}
+	return strings.NewReplacer(
+		"{slot}", strconv.Itoa(send.Slot),
+		"{bot}", send.Bot,
+	).Replace(template)
 }
 
 type XdccSendRes struct {
-	FileName string
-	IP       net.IP
-	Port     int
-	FileSize int
+	// FileName is the offered name made safe for local paths, see
+	// SanitizeFileName; RawFileName is the name as offered, which the
+	// replies to the bot must repeat.
+	FileName    string
+	RawFileName string
+	IP          net.IP
+	Port        int
+	FileSize    int
+	Token       string // only set for reverse DCC offers
 }
 
 func uint32ToIP(n int) net.IP {
@@ -51,18 +76,22 @@ func uint32ToIP(n int) net.IP {
 	return net.IPv4(a, b, c, d)
 }
 
-const XdccSendResArgs = 4
+const (
+	XdccSendResArgs        = 4
+	XdccPassiveSendResArgs = 5
+)
 
 func (send *XdccSendRes) Name() string {
 	return SEND
 }
 
 func (send *XdccSendRes) Parse(args []string) error {
-	if len(args) != XdccSendResArgs {
+	if len(args) != XdccSendResArgs && len(args) != XdccPassiveSendResArgs {
 		return errors.New("invalid number of arguments")
 	}
 
-	send.FileName = args[0]
+	send.RawFileName = args[0]
+	send.FileName = SanitizeFileName(args[0])
 
 	ipUint32, err := strconv.Atoi(args[1])
 
@@ -82,28 +111,90 @@ func (send *XdccSendRes) Parse(args []string) error {
 	if err != nil {
 		return err
 	}
+
+	if len(args) == XdccPassiveSendResArgs {
+		send.Token = args[4]
+	}
+	return nil
+}
+
+// isPassive reports whether the bot asked us to listen (reverse DCC).
+func (send *XdccSendRes) isPassive() bool {
+	return send.Port == 0 && send.Token != ""
+}
+
+// XdccAcceptRes is the answer of a bot agreeing to resume a file at
+// Position, see XdccTransfer.resume.
+type XdccAcceptRes struct {
+	FileName string
+	Port     int
+	Position int
+	Token    string // only set for reverse DCC offers
+}
+
+const (
+	XdccAcceptResArgs        = 3
+	XdccPassiveAcceptResArgs = 4
+)
+
+func (accept *XdccAcceptRes) Name() string {
+	return ACCEPT
+}
+
+func (accept *XdccAcceptRes) Parse(args []string) error {
+	if len(args) != XdccAcceptResArgs && len(args) != XdccPassiveAcceptResArgs {
+		return errors.New("invalid number of arguments")
+	}
+
+	accept.FileName = SanitizeFileName(args[0])
+
+	var err error
+	accept.Port, err = strconv.Atoi(args[1])
+
+	if err != nil {
+		return err
+	}
+
+	accept.Position, err = strconv.Atoi(args[2])
+
+	if err != nil {
+		return err
+	}
+
+	if len(args) == XdccPassiveAcceptResArgs {
+		accept.Token = args[3]
+	}
 	return nil
 }
 
 const (
 	SEND    = "SEND"
+	RESUME  = "RESUME"
+	ACCEPT  = "ACCEPT"
 	VERSION = "\x01VERSION\x01"
 )
 
+// parseCTCPRes parses the text of a DCC CTCP message. Unsupported
+// commands are ignored and yield a nil response.
 func parseCTCPRes(text string) (CTCPResponse, error) {
-	fields := strings.Fields(text)
+	fields := splitCTCPArgs(text)
+	if len(fields) == 0 {
+		return nil, nil
+	}
 
 	var resp CTCPResponse = nil
 
 	switch strings.TrimSpace(fields[0]) {
 	case SEND:
 		resp = &XdccSendRes{}
+	case ACCEPT:
+		resp = &XdccAcceptRes{}
 	case VERSION:
 		return nil, nil
 	}
 
 	if resp == nil {
-		return nil, errors.New("invalid command: " + fields[0])
+		return nil, nil
 	}
 
 	err := resp.Parse(fields[1:])
@@ -116,181 +207,659 @@ func parseCTCPRes(text string) (CTCPResponse, error) {
 const defaultEventChanSize = 1024
 
 func (transfer *XdccTransfer) Start() error {
-	return transfer.conn.Connect()
+	if transfer.bindErr != nil {
+		return transfer.bindErr
+	}
+	transfer.notifyEvent(&TransferResolvingEvent{Host: transfer.url.Network})
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	_, err := net.DefaultResolver.LookupHost(ctx, transfer.url.Network)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", transfer.url.Network, err)
+	}
+
+	transfer.notifyEvent(&TransferConnectingEvent{Server: transfer.url.Address()})
+	if transfer.manager == nil {
+		return transfer.connect()
+	}
+
+	mc, err := transfer.manager.AcquireNotify(transfer.ircConfig, func() {
+		transfer.notifyEvent(&TransferRegisteringEvent{})
+	})
+	if err != nil {
+		return err
+	}
+	transfer.mtx.Lock()
+	transfer.shared = mc
+	transfer.conn = mc.Conn()
+	transfer.mtx.Unlock()
+	transfer.setupHandlers(transfer.url.Channels(), transfer.url.UserName)
+
+	// the connection is already registered: CONNECTED will not fire, and
+	// JOIN only for channels not joined yet.
+	transfer.notifyEvent(&TransferRegisteredEvent{Nick: transfer.conn.Me().Nick})
+	for _, channel := range transfer.url.Channels() {
+		if mc.InChannel(channel) {
+			transfer.request(channel)
+			break
+		}
+		transfer.conn.Join(channel)
+	}
+	return nil
 }
 
 type TransferEvent interface{}
 
 type TransferAbortedEvent struct {
 	Error string
+	Err   error // the error behind Error, see OpError
+}
+
+// TransferResolvingEvent is sent while the address of the IRC server is
+// looked up, first thing of a transfer.
+type TransferResolvingEvent struct {
+	Host string
+}
+
+// TransferConnectingEvent is sent when the IRC connection is being opened.
+type TransferConnectingEvent struct {
+	Server string
 }
 
-const maxConnAttempts = 5
+// TransferRegisteringEvent is sent once connected to the IRC server, while
+// it has yet to accept the client.
+type TransferRegisteringEvent struct{}
+
+// TransferRegisteredEvent is sent once the IRC server accepted the client.
+type TransferRegisteredEvent struct {
+	Nick string
+}
+
+// TransferRequestedEvent is sent after the XDCC request went out to the bot.
+type TransferRequestedEvent struct {
+	Bot  string
+	Slot int
+}
+
+// TransferReconnectingEvent is sent when the IRC connection dropped and a
+// new connection attempt will be made after Delay.
+type TransferReconnectingEvent struct {
+	Attempt int
+	Delay   time.Duration
+}
+
+// TransferRejectedEvent is sent when the bot refuses the request. Err is a
+// *BotError matching one of the Err* values (ErrQueueFull, ErrBanned...).
+type TransferRejectedEvent struct {
+	Err error
+}
+
+// TransferQueuedEvent is sent when the bot put the request in its queue,
+// and again for each position notice it sends while waiting. Position,
+// Total and Remaining are 0 when the bot didn't report them.
+type TransferQueuedEvent struct {
+	Position  int
+	Total     int
+	Remaining time.Duration
+	Message   string
+}
+
+const maxConnAttempts = 8
+
+// resolveTimeout bounds the lookup of the IRC server address.
+const resolveTimeout = 15 * time.Second
 
 type Transfer interface {
 	Start() error
+	// Stop aborts the transfer: it quits IRC, closes the DCC connection
+	// and flushes what has been downloaded so far to disk.
+	Stop()
 	PollEvents() chan TransferEvent
+	// Subscribe returns an additional event channel; every subscriber
+	// receives all events published after subscribing.
+	Subscribe() chan TransferEvent
+	Unsubscribe(ch chan TransferEvent)
 }
 
 type retryTransfer struct {
 	*XdccTransfer
-	conf Config
+	conf   Config
+	events *eventHub
 }
 
 func (t *retryTransfer) Start() error {
-	t1 := newXdccTransfer(t.conf, true, false)
-	if err := t1.conn.Connect(); err == nil {
+	t1 := newXdccTransfer(t.conf, true, false, t.events)
+	if err := t1.Start(); err == nil {
 		t.XdccTransfer = t1
 		return nil
 	}
 
-	t2 := newXdccTransfer(t.conf, true, true)
-	if err := t1.conn.Connect(); err == nil {
+	t2 := newXdccTransfer(t.conf, true, true, t.events)
+	if err := t2.Start(); err == nil {
 		t.XdccTransfer = t2
 		return nil
 	}
 
-	t.XdccTransfer = newXdccTransfer(t.conf, false, false)
-	return t.XdccTransfer.conn.Connect()
+	t.XdccTransfer = newXdccTransfer(t.conf, false, false, t.events)
+	return t.XdccTransfer.Start()
+}
+
+func (t *retryTransfer) Stop() {
+	if t.XdccTransfer != nil {
+		t.XdccTransfer.Stop()
+	}
 }
 
 func (t *retryTransfer) PollEvents() chan TransferEvent {
-	return t.XdccTransfer.PollEvents()
+	return t.events.poll
+}
+
+func (t *retryTransfer) Subscribe() chan TransferEvent {
+	return t.events.Subscribe()
+}
+
+func (t *retryTransfer) Unsubscribe(ch chan TransferEvent) {
+	t.events.Unsubscribe(ch)
 }
 
 type XdccTransfer struct {
-	filePath     string
-	url          IRCFile
-	conn         *irc.Conn
-	connAttempts int
-	started      bool
-	events       chan TransferEvent
+	filePath      string
+	destination   func(string) string
+	incompleteDir string
+	url           IRCFile
+	conn          *irc.Conn
+	ircConfig     *irc.Config
+	connAttempts  int // guarded by mtx, reset by the CONNECTED handler
+	started       bool
+	requested     bool
+	listenPorts   PortRange
+	expectedSize  uint64
+	preallocate   bool
+	bufSize       int
+	limiter       *RateLimiter
+	rateWeight    int
+	events        *eventHub
+
+	requestTemplate  string
+	requestInChannel bool
+	externalIP       string
+	stunServer       string
+	bindIP           net.IP
+	bindErr          error
+
+	manager    *ConnManager
+	shared     *ManagedConn
+	removers   []irc.Remover
+	detachOnce sync.Once
+
+	mtx     sync.Mutex
+	stopped bool
+	offered bool // a DCC offer has been accepted
+	dccConn net.Conn
+	dccDone chan struct{} // closed when the download goroutine exits
+	accepts chan *XdccAcceptRes
+	halted  chan struct{} // closed by Stop
 }
 
 type Config struct {
 	File    IRCFile
 	OutPath string
 	SSLOnly bool
+
+	// Destination returns the path of the file announced by the bot; its
+	// directory is created if needed. Nil saves to OutPath.
+	Destination func(fileName string) string
+
+	// IncompleteDir receives files while they are downloaded; they are
+	// moved to their destination once complete. Empty writes them next
+	// to the destination.
+	IncompleteDir string
+
+	// ServerPassword is sent with PASS during registration (bouncers,
+	// password-protected networks). Empty means no PASS is sent.
+	ServerPassword string
+
+	// ListenPorts restricts the local ports used for reverse DCC.
+	ListenPorts PortRange
+
+	// ExpectedSize is the size reported by the search provider, used to
+	// detect suspicious downloads. 0 disables the check.
+	ExpectedSize int64
+
+	// Preallocate reserves the announced size on disk before downloading,
+	// reducing fragmentation and failing fast when the disk is too small.
+	Preallocate bool
+
+	// BufferSize is the size in bytes of the read/write buffer of the
+	// download loop. 0 selects defaultDownloadBufSize.
+	BufferSize int
+
+	// RequestTemplate is the message asking the bot for the pack, see
+	// XdccSendReq. RequestInChannel sends it to the channel instead of
+	// the bot (e.g. "!pack {slot}" triggers).
+	RequestTemplate  string
+	RequestInChannel bool
+
+	// ExternalIP is the address advertised to bots for reverse DCC, for
+	// users behind NAT. ExternalIPAuto discovers it via STUNServer (or
+	// DefaultSTUNServer); empty uses the local address.
+	ExternalIP string
+	STUNServer string
+
+	// BindAddress binds IRC and DCC sockets to a local IP address or to
+	// the address of a network interface (e.g. a VPN's "tun0").
+	BindAddress string
+
+	// Connections shares IRC connections between transfers. When nil the
+	// transfer opens, and quits, its own connection.
+	Connections *ConnManager
+
+	// RateLimiter caps the combined speed of the transfers sharing it;
+	// RateWeight is the share of this transfer relative to the others
+	// (1 when unset). Nil leaves the speed unlimited.
+	RateLimiter *RateLimiter
+	RateWeight  int
+
+	// Nick is the nickname registered on new connections; empty picks a
+	// random one.
+	Nick string
 }
 
 func NewTransfer(c Config) Transfer {
-	if c.SSLOnly {
-		return newXdccTransfer(c, true, false)
+	if c.SSLOnly || c.File.SSL {
+		return newXdccTransfer(c, true, false, newEventHub())
 	}
 
 	return &retryTransfer{
-		conf: c,
+		conf:   c,
+		events: newEventHub(),
 	}
 }
 
-func newXdccTransfer(c Config, enableSSL bool, skipCertificateCheck bool) *XdccTransfer {
+func newXdccTransfer(c Config, enableSSL bool, skipCertificateCheck bool, events *eventHub) *XdccTransfer {
 	rand.Seed(time.Now().UTC().UnixNano())
 	nick := IRCClientUserName + strconv.Itoa(int(rand.Uint32()))
+	if c.Nick != "" {
+		nick = c.Nick
+	}
 
 	file := c.File
 
 	config := irc.NewConfig(nick)
 	config.SSL = enableSSL
 	config.SSLConfig = &tls.Config{ServerName: file.Network, InsecureSkipVerify: skipCertificateCheck}
-	config.Server = file.Network
+	config.Server = file.Address()
+	config.Pass = c.ServerPassword
+
+	var bindIP net.IP
+	var bindErr error
+	if c.BindAddress != "" {
+		bindIP, bindErr = resolveBindAddress(c.BindAddress)
+		if bindErr == nil {
+			config.LocalAddr = net.JoinHostPort(bindIP.String(), "0")
+		}
+	}
 	config.NewNick = func(nick string) string {
 		return nick + "" + strconv.Itoa(int(rand.Uint32()))
 	}
 
-	conn := irc.Client(config)
+	if c.BufferSize <= 0 {
+		c.BufferSize = defaultDownloadBufSize
+	}
 
 	t := &XdccTransfer{
-		conn:         conn,
-		url:          file,
-		filePath:     c.OutPath,
-		started:      false,
-		connAttempts: 0,
-		events:       make(chan TransferEvent, defaultEventChanSize),
-	}
-	t.setupHandlers(file.Channel, file.UserName, file.Slot)
+		ircConfig:     config,
+		url:           file,
+		filePath:      c.OutPath,
+		destination:   c.Destination,
+		incompleteDir: c.IncompleteDir,
+		listenPorts:   c.ListenPorts,
+		expectedSize:  uint64(util.MaxInt64(c.ExpectedSize, 0)),
+		preallocate:   c.Preallocate,
+		bufSize:       c.BufferSize,
+		started:       false,
+		connAttempts:  0,
+		events:        events,
+		dccDone:       make(chan struct{}),
+		accepts:       make(chan *XdccAcceptRes, 1),
+		halted:        make(chan struct{}),
+
+		requestTemplate:  c.RequestTemplate,
+		requestInChannel: c.RequestInChannel,
+		externalIP:       c.ExternalIP,
+		stunServer:       c.STUNServer,
+		bindIP:           bindIP,
+		bindErr:          bindErr,
+		manager:          c.Connections,
+		limiter:          c.RateLimiter,
+		rateWeight:       c.RateWeight,
+	}
+	if t.manager == nil {
+		t.conn = irc.Client(config)
+		t.setupHandlers(file.Channels(), file.UserName)
+	}
 	return t
 }
 
-func (transfer *XdccTransfer) send(req CTCPRequest) {
-	transfer.conn.Privmsg(transfer.url.UserName, req.String())
+// send delivers the request to the bot, or to channel for bots that are
+// triggered by channel messages.
+func (transfer *XdccTransfer) send(req CTCPRequest, channel string) {
+	target := transfer.url.UserName
+	if transfer.requestInChannel {
+		target = channel
+	}
+	transfer.conn.Privmsg(target, req.String())
+}
+
+// request asks the bot for the pack once per connection.
+func (transfer *XdccTransfer) request(channel string) {
+	transfer.mtx.Lock()
+	if transfer.started || transfer.requested {
+		transfer.mtx.Unlock()
+		return
+	}
+	transfer.requested = true
+	transfer.mtx.Unlock()
+
+	transfer.send(&XdccSendReq{
+		Slot:     transfer.url.Slot,
+		Bot:      transfer.url.UserName,
+		Template: transfer.requestTemplate,
+	}, channel)
+	transfer.notifyEvent(&TransferRequestedEvent{Bot: transfer.url.UserName, Slot: transfer.url.Slot})
 }
 
-func (transfer *XdccTransfer) setupHandlers(channel string, userName string, slot int) {
-	conn := transfer.conn
+// handle registers a handler that is removed again when the transfer
+// stops, as shared connections outlive their transfers.
+func (transfer *XdccTransfer) handle(name string, fn irc.HandlerFunc) {
+	transfer.removers = append(transfer.removers, transfer.conn.HandleFunc(name, fn))
+}
 
-	// e.g. join channel on connect.
-	conn.HandleFunc(irc.CONNECTED,
+func (transfer *XdccTransfer) setupHandlers(channels []string, userName string) {
+	// e.g. join channels on connect.
+	transfer.handle(irc.CONNECTED,
 		func(conn *irc.Conn, line *irc.Line) {
+			transfer.mtx.Lock()
 			transfer.connAttempts = 0
-			conn.Join(channel)
+			transfer.mtx.Unlock()
+			transfer.notifyEvent(&TransferRegisteredEvent{Nick: conn.Me().Nick})
+			for _, channel := range channels {
+				conn.Join(channel)
+			}
 		})
 
-	conn.HandleFunc(irc.ERROR, func(conn *irc.Conn, line *irc.Line) {
-
-	})
-
-	// send xdcc send on successfull join
-	conn.HandleFunc(irc.JOIN,
+	// send xdcc send on the first successfull join
+	transfer.handle(irc.JOIN,
 		func(conn *irc.Conn, line *irc.Line) {
-			if strings.EqualFold(line.Args[0], channel) && !transfer.started {
-				transfer.send(&XdccSendReq{Slot: slot})
+			if !isOwnJoin(conn, line) || !containsChannel(channels, line.Args[0]) {
+				return
 			}
+			transfer.request(line.Args[0])
 		})
 
-	conn.HandleFunc(irc.PRIVMSG, func(conn *irc.Conn, line *irc.Line) {})
+	handleBotMessage := func(conn *irc.Conn, line *irc.Line) {
+		if line.Public() || !strings.EqualFold(line.Nick, userName) || transfer.started {
+			return
+		}
+		transfer.handleBotReply(ParseBotReply(line.Text()))
+	}
+	transfer.handle(irc.PRIVMSG, handleBotMessage)
+	transfer.handle(irc.NOTICE, handleBotMessage)
 
-	conn.HandleFunc(irc.CTCP,
+	transfer.handle(irc.CTCP,
 		func(conn *irc.Conn, line *irc.Line) {
+			if len(line.Args) == 0 || line.Args[0] != "DCC" || !strings.EqualFold(line.Nick, userName) {
+				return
+			}
 			res, err := parseCTCPRes(line.Text())
 			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(1) // TODO: correct clean up
+				err = &OpError{Op: OpParseOffer, Err: err}
+				transfer.notifyEvent(&TransferAbortedEvent{Error: err.Error(), Err: err})
+				transfer.Stop()
+				return
 			}
 			transfer.handleCTCPRes(res)
 		})
 
-	conn.HandleFunc(irc.DISCONNECTED,
+	transfer.handle(irc.DISCONNECTED,
 		func(conn *irc.Conn, line *irc.Line) {
-			var err error = nil
-
-			if transfer.connAttempts < maxConnAttempts {
-				time.Sleep(time.Second)
-
-				err = conn.Connect()
+			if transfer.isStopped() || transfer.isFinished() {
+				return
 			}
 
-			if (err != nil || transfer.connAttempts >= maxConnAttempts) && !transfer.started {
-				transfer.notifyEvent(&TransferAbortedEvent{Error: err.Error()})
+			// the request is lost with the connection unless the bot
+			// already started sending: ask again once rejoined.
+			transfer.mtx.Lock()
+			if !transfer.started {
+				transfer.requested = false
 			}
+			transfer.mtx.Unlock()
+			go transfer.reconnect()
+		})
+}
+
+const (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = time.Minute
+)
+
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectBaseDelay << attempt
+	if delay <= 0 || delay > reconnectMaxDelay {
+		return reconnectMaxDelay
+	}
+	return delay
+}
 
+// reconnect re-establishes the IRC connection with exponential backoff.
+// Channels are rejoined and the pending request re-issued by the
+// CONNECTED and JOIN handlers.
+func (transfer *XdccTransfer) reconnect() {
+	for !transfer.isStopped() {
+		// the CONNECTED handler resets the attempts from another goroutine.
+		transfer.mtx.Lock()
+		attempts, started := transfer.connAttempts, transfer.started
+		if attempts < maxConnAttempts {
 			transfer.connAttempts++
+		}
+		transfer.mtx.Unlock()
+
+		if attempts >= maxConnAttempts {
+			if !started {
+				transfer.abort(ErrTooManyAttempts)
+				transfer.detach()
+			}
+			return
+		}
+
+		delay := reconnectDelay(attempts)
+		transfer.notifyEvent(&TransferReconnectingEvent{Attempt: attempts + 1, Delay: delay})
+		time.Sleep(delay)
+
+		if transfer.isStopped() {
+			return
+		}
+		if err := transfer.connect(); err == nil {
+			return
+		}
+	}
+}
+
+func (transfer *XdccTransfer) connect() error {
+	var err error
+	if transfer.shared != nil {
+		err = transfer.shared.reconnect()
+	} else {
+		err = transfer.conn.Connect()
+	}
+	if err == nil {
+		transfer.notifyEvent(&TransferRegisteringEvent{})
+	}
+	return err
+}
+
+// isFinished reports whether the DCC download has ended.
+func (transfer *XdccTransfer) isFinished() bool {
+	select {
+	case <-transfer.dccDone:
+		return true
+	default:
+		return false
+	}
+}
+
+func (transfer *XdccTransfer) handleBotReply(reply BotReply) {
+	switch {
+	case reply.Kind == BotReplyQueued:
+		transfer.notifyEvent(&TransferQueuedEvent{
+			Position:  reply.Position,
+			Total:     reply.Total,
+			Remaining: reply.Remaining,
+			Message:   reply.Text,
 		})
+	case reply.Fatal():
+		transfer.notifyEvent(&TransferRejectedEvent{Err: reply.Err()})
+		transfer.Stop()
+	}
+}
+
+func isOwnJoin(conn *irc.Conn, line *irc.Line) bool {
+	return line.Nick == "" || strings.EqualFold(line.Nick, conn.Me().Nick)
+}
+
+func containsChannel(channels []string, channel string) bool {
+	for _, ch := range channels {
+		if strings.EqualFold(ch, channel) {
+			return true
+		}
+	}
+	return false
 }
 
 func (transfer *XdccTransfer) PollEvents() chan TransferEvent {
-	return transfer.events
+	return transfer.events.poll
+}
+
+func (transfer *XdccTransfer) Subscribe() chan TransferEvent {
+	return transfer.events.Subscribe()
+}
+
+func (transfer *XdccTransfer) Unsubscribe(ch chan TransferEvent) {
+	transfer.events.Unsubscribe(ch)
 }
 
 type TransferProgessEvent struct {
-	TransferBytes uint64
-	TransferRate  float32
+	TransferBytes uint64  // bytes received since the previous event
+	TransferRate  float32 // instantaneous rate in bytes/s
+
+	BytesCompleted uint64        // bytes received so far
+	FileSize       uint64        // total size announced by the bot
+	SmoothedRate   float64       // exponentially weighted rate in bytes/s
+	ETA            time.Duration // estimated time remaining, 0 if unknown
+	RateLimit      float64       // bytes/s allowed by the rate limiter, 0 if unlimited
 }
 
-const downloadBufSize = 1024
+// speedSmoothing is the weight given to the newest sample by rateEWMA.
+const speedSmoothing = 0.3
+
+// rateEWMA is an exponentially weighted moving average of transfer rates,
+// used to avoid wildly jumping speed and ETA figures.
+type rateEWMA struct {
+	value float64
+	init  bool
+}
+
+func (e *rateEWMA) Add(sample float64) float64 {
+	if !e.init {
+		e.value = sample
+		e.init = true
+	} else {
+		e.value = speedSmoothing*sample + (1-speedSmoothing)*e.value
+	}
+	return e.value
+}
+
+func estimateETA(remaining uint64, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second))
+}
+
+// partFileSuffix is appended to the name of files being downloaded; the
+// file is renamed to its final name only once complete, so that other tools
+// never pick up half-written files.
+const partFileSuffix = ".part"
+
+// incompletePath is the partial file in dir of a download saved to
+// finalPath. The same name may go to several destinations, so a hash of
+// finalPath keeps their partial files apart, and the next attempt of a
+// download finds its own one to resume.
+func incompletePath(dir, finalPath string) string {
+	h := fnv.New32a()
+	h.Write([]byte(finalPath))
+	return filepath.Join(dir, fmt.Sprintf("%s.%08x%s", filepath.Base(finalPath), h.Sum32(), partFileSuffix))
+}
+
+// defaultDownloadBufSize is the read/write buffer used by the download
+// loop when Config.BufferSize is not set. Small reads cap throughput well
+// below line speed on fast links.
+const defaultDownloadBufSize = 64 * 1024
+
+// sendAck writes a DCC acknowledgement: the number of bytes received so
+// far as a 32-bit big-endian integer (wrapping for files over 4GiB).
+func sendAck(conn net.Conn, received int) error {
+	var ack [4]byte
+	binary.BigEndian.PutUint32(ack[:], uint32(received))
+	_, err := conn.Write(ack[:])
+	return err
+}
 
 type TransferStartedEvent struct {
 	FileName string
 	FileSize uint64
+	Offset   uint64 // bytes kept from an earlier attempt
 }
 
-type TransferCompletedEvent struct{}
+type TransferCompletedEvent struct {
+	FileName     string
+	Path         string // final location of the file
+	BytesWritten uint64
+	SizeMismatch bool // see TransferSizeMismatchEvent
+}
 
-func (transfer *XdccTransfer) notifyEvent(e TransferEvent) {
-	select {
-	case transfer.events <- e:
-	default:
-		break
+// TransferSizeMismatchEvent warns that the number of bytes received differs
+// from the size announced in the DCC offer or reported by the provider.
+type TransferSizeMismatchEvent struct {
+	Announced uint64 // size from the DCC offer
+	Expected  uint64 // size reported by the search provider, 0 if unknown
+	Written   uint64
+}
+
+// expectedSizeTolerance is the relative difference accepted between the
+// (rounded) provider-reported size and the received bytes.
+const expectedSizeTolerance = 0.05
+
+// checkSize returns a mismatch event if written differs from the announced
+// size or is too far from the provider-reported one.
+func checkSize(announced, expected, written uint64) *TransferSizeMismatchEvent {
+	mismatch := written != announced
+	if expected > 0 {
+		diff := float64(written) - float64(expected)
+		if diff < 0 {
+			diff = -diff
+		}
+		mismatch = mismatch || diff/float64(expected) > expectedSizeTolerance
+	}
+
+	if !mismatch {
+		return nil
 	}
+	return &TransferSizeMismatchEvent{Announced: announced, Expected: expected, Written: written}
+}
+
+func (transfer *XdccTransfer) notifyEvent(e TransferEvent) {
+	transfer.events.Publish(e)
 }
 
 type SpeedMonitorReader struct {
@@ -327,62 +896,347 @@ func (monitor *SpeedMonitorReader) Read(buf []byte) (int, error) {
 	return n, err
 }
 
+const stopTimeout = 5 * time.Second
+
+func (transfer *XdccTransfer) Stop() {
+	transfer.mtx.Lock()
+	if transfer.stopped {
+		transfer.mtx.Unlock()
+		return
+	}
+	transfer.stopped = true
+	close(transfer.halted)
+	dccConn := transfer.dccConn
+	transfer.mtx.Unlock()
+
+	transfer.detach()
+
+	if dccConn != nil {
+		dccConn.Close()
+		select {
+		case <-transfer.dccDone:
+		case <-time.After(stopTimeout):
+		}
+	}
+}
+
+// detach gives the IRC connection back once the transfer no longer needs
+// it: shared connections are released to the ConnManager, our own is quit.
+func (transfer *XdccTransfer) detach() {
+	transfer.detachOnce.Do(func() {
+		transfer.mtx.Lock()
+		shared := transfer.shared
+		transfer.mtx.Unlock()
+
+		if shared != nil {
+			for _, r := range transfer.removers {
+				r.Remove()
+			}
+			transfer.manager.Release(shared)
+		} else if transfer.conn != nil && transfer.conn.Connected() {
+			transfer.conn.Quit()
+		}
+	})
+}
+
+func (transfer *XdccTransfer) isStopped() bool {
+	transfer.mtx.Lock()
+	defer transfer.mtx.Unlock()
+	return transfer.stopped
+}
+
+// setDCCConn records the data connection so that Stop can close it. It
+// returns false if the transfer has already been stopped.
+func (transfer *XdccTransfer) setDCCConn(conn net.Conn) bool {
+	transfer.mtx.Lock()
+	defer transfer.mtx.Unlock()
+	if transfer.stopped {
+		return false
+	}
+	transfer.dccConn = conn
+	return true
+}
+
+func (transfer *XdccTransfer) abort(err error) {
+	if !transfer.isStopped() {
+		transfer.notifyEvent(&TransferAbortedEvent{Error: err.Error(), Err: err})
+	}
+}
+
+// closeFile flushes buffered data and makes sure it reached the disk.
+func closeFile(file *os.File, w *bufio.Writer) error {
+	flushErr := w.Flush()
+	syncErr := file.Sync()
+	closeErr := file.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+	if syncErr != nil {
+		return syncErr
+	}
+	return closeErr
+}
+
+// openPartFile opens the partial file of a download at offset. The data
+// before offset is kept for a resumed download; a download from the start
+// truncates the file and, with prealloc, reserves size bytes for it.
+func openPartFile(path string, offset, size int64, prealloc bool) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		// anything past offset was not acknowledged to the bot.
+		if err := file.Truncate(offset); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if prealloc && size > 0 {
+		if err := preallocate(file, size); err != nil {
+			file.Close()
+			return nil, &OpError{Op: OpPreallocate, Err: err}
+		}
+	}
+	return file, nil
+}
+
 func (transfer *XdccTransfer) handleXdccSendRes(send *XdccSendRes) {
+	transfer.mtx.Lock()
+	if transfer.offered || transfer.stopped {
+		transfer.mtx.Unlock()
+		return
+	}
+	transfer.offered = true
+	transfer.mtx.Unlock()
+
 	go func() {
-		conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{IP: send.IP, Port: send.Port})
+		defer transfer.detach()
+		defer close(transfer.dccDone)
+
+		finalPath := filepath.Join(transfer.filePath, send.FileName)
+		if transfer.destination != nil {
+			finalPath = transfer.destination(send.FileName)
+		}
+		if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+			transfer.abort(err)
+			return
+		}
+
+		// the file is written next to its destination, or in the
+		// incomplete directory and moved once complete.
+		partPath := finalPath + partFileSuffix
+		if transfer.incompleteDir != "" {
+			if err := os.MkdirAll(transfer.incompleteDir, 0755); err != nil {
+				transfer.abort(err)
+				return
+			}
+			partPath = incompletePath(transfer.incompleteDir, finalPath)
+		}
+		dir := filepath.Dir(partPath)
+
+		offset := transfer.resume(send, partPath)
+		if transfer.isStopped() {
+			return
+		}
+
+		if send.FileSize > 0 {
+			if err := checkFreeSpace(dir, uint64(int64(send.FileSize)-offset)); err != nil {
+				transfer.abort(err)
+				return
+			}
+		}
+
+		conn, err := transfer.openDCCConn(send)
 		if err != nil {
-			log.Fatalf("unable to reach host %s:%d", send.IP.String(), send.Port)
+			transfer.abort(&OpError{Op: OpConnectDCC, Err: err})
 			return
 		}
+		defer conn.Close()
 
-		file, err := os.OpenFile(transfer.filePath+"/"+send.FileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		fileWriter := bufio.NewWriter(file)
+		if !transfer.setDCCConn(conn) {
+			return
+		}
 
+		file, err := openPartFile(partPath, offset, int64(send.FileSize), transfer.preallocate)
 		if err != nil {
-			log.Fatal(err.Error())
+			transfer.abort(err)
 			return
 		}
+		fileWriter := bufio.NewWriterSize(file, transfer.bufSize)
 
 		transfer.notifyEvent(&TransferStartedEvent{
 			FileName: send.FileName,
 			FileSize: uint64(send.FileSize),
+			Offset:   uint64(offset),
 		})
+		transfer.mtx.Lock()
 		transfer.started = true
+		transfer.mtx.Unlock()
+
+		fileSize := uint64(send.FileSize)
+		completed := uint64(offset)
+		var avg rateEWMA
+		var src io.Reader = conn
+		var limited *limitedReader
+		if transfer.limiter != nil {
+			limited = transfer.limiter.reader(conn, transfer.rateWeight)
+			defer limited.Close()
+			src = limited
+		}
+		reader := NewSpeedMonitorReader(src, func(dowloadedAmount int, speed float64) {
+			completed += uint64(dowloadedAmount)
+			smoothed := avg.Add(speed)
+
+			var remaining uint64
+			if completed < fileSize {
+				remaining = fileSize - completed
+			}
+
+			var allowed float64
+			if limited != nil {
+				allowed = limited.Allocation()
+			}
 
-		reader := NewSpeedMonitorReader(conn, func(dowloadedAmount int, speed float64) {
 			transfer.notifyEvent(&TransferProgessEvent{
-				TransferRate:  float32(speed),
-				TransferBytes: uint64(dowloadedAmount),
+				TransferRate:   float32(speed),
+				TransferBytes:  uint64(dowloadedAmount),
+				BytesCompleted: completed,
+				FileSize:       fileSize,
+				SmoothedRate:   smoothed,
+				ETA:            estimateETA(remaining, smoothed),
+				RateLimit:      allowed,
 			})
 		})
 
-		// download loop
-		downloadedBytesTotal := 0
-		buf := make([]byte, downloadBufSize)
+		// download loop; the acknowledgements count the bytes of the
+		// file, those of a resumed download included.
+		downloadedBytesTotal := int(offset)
+		lastAck := downloadedBytesTotal
+		// a stopped or failed download keeps only the bytes received, to
+		// be resumed: the preallocated tail goes.
+		closePart := func() error {
+			if transfer.preallocate && downloadedBytesTotal < send.FileSize {
+				fileWriter.Flush()
+				file.Truncate(int64(downloadedBytesTotal))
+			}
+			return closeFile(file, fileWriter)
+		}
+		buf := make([]byte, transfer.bufSize)
 		for downloadedBytesTotal < send.FileSize {
 			n, err := reader.Read(buf)
 
-			if err != nil {
-				log.Fatal(err.Error())
+			if err == io.EOF && n == 0 {
+				break
+			}
+
+			if err != nil && err != io.EOF {
+				closePart()
+				transfer.abort(err)
 				return
 			}
 
 			if _, err := fileWriter.Write(buf[:n]); err != nil {
-				log.Fatal(err.Error())
+				closePart()
+				transfer.abort(diskError(err))
 				return
 			}
 
 			downloadedBytesTotal += n
+
+			// acknowledge once per buffer instead of once per read
+			if downloadedBytesTotal-lastAck >= transfer.bufSize || downloadedBytesTotal >= send.FileSize {
+				sendAck(conn, downloadedBytesTotal)
+				lastAck = downloadedBytesTotal
+			}
+		}
+
+		if err := closePart(); err != nil {
+			transfer.abort(diskError(err))
+			return
+		}
+
+		written := uint64(downloadedBytesTotal)
+		mismatch := checkSize(fileSize, transfer.expectedSize, written)
+		if mismatch != nil {
+			transfer.notifyEvent(mismatch)
+		}
+
+		if written < fileSize {
+			transfer.abort(&IncompleteError{Written: written, Size: fileSize})
+			return
+		}
+
+		if err := moveFile(partPath, finalPath); err != nil {
+			transfer.abort(&OpError{Op: OpMoveFile, Err: err})
+			return
 		}
-		fileWriter.Flush()
 
-		transfer.notifyEvent(&TransferCompletedEvent{})
+		transfer.notifyEvent(&TransferCompletedEvent{
+			FileName:     send.FileName,
+			Path:         finalPath,
+			BytesWritten: written,
+			SizeMismatch: mismatch != nil,
+		})
 	}()
 }
 
+const resumeTimeout = 30 * time.Second
+
+// resume asks the bot to continue the partial file left at partPath by an
+// earlier attempt and returns the offset it agreed to, 0 to download the
+// whole file again.
+func (transfer *XdccTransfer) resume(send *XdccSendRes, partPath string) int64 {
+	info, err := os.Stat(partPath)
+	if err != nil || info.Size() == 0 || info.Size() >= int64(send.FileSize) {
+		return 0
+	}
+
+	position := strconv.FormatInt(info.Size(), 10)
+	args := []string{RESUME, quoteCTCPArg(send.RawFileName), strconv.Itoa(send.Port), position}
+	if send.isPassive() {
+		args = append(args, send.Token)
+	}
+	transfer.conn.Ctcp(transfer.url.UserName, "DCC", args...)
+
+	timeout := time.NewTimer(resumeTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case accept := <-transfer.accepts:
+			if accept.Port != send.Port || accept.Token != send.Token {
+				continue
+			}
+			if accept.Position < 0 || int64(accept.Position) > info.Size() {
+				return 0
+			}
+			return int64(accept.Position)
+		case <-timeout.C:
+			// bots without resume support ignore the request
+			return 0
+		case <-transfer.halted:
+			return 0
+		}
+	}
+}
+
 func (transfer *XdccTransfer) handleCTCPRes(resp CTCPResponse) {
 	switch r := resp.(type) {
 	case *XdccSendRes:
 		transfer.handleXdccSendRes(r)
+	case *XdccAcceptRes:
+		select {
+		case transfer.accepts <- r:
+		default:
+		}
 	}
 }